@@ -0,0 +1,682 @@
+// Package dbus contains a minimal D-Bus client. It only implements what is
+// needed by the modules in this repository: method calls with unix file
+// descriptor passing over unix sockets and answering incoming method calls,
+// which is enough to implement simple services in tests.
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Message types.
+const (
+	TypeMethodCall   byte = 1
+	TypeMethodReturn byte = 2
+	TypeError        byte = 3
+	TypeSignal       byte = 4
+)
+
+// Header field codes.
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+	fieldUnixFDs     byte = 9
+)
+
+// maxMessageSize is the maximum size of a message allowed by the D-Bus
+// specification.
+const maxMessageSize = 128 << 20
+
+// maxUnixFDs limits the number of file descriptors per message.
+const maxUnixFDs = 16
+
+// DefaultSystemBusAddress is the address of the system bus if
+// DBUS_SYSTEM_BUS_ADDRESS is not set.
+const DefaultSystemBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+// ErrClosed is returned by calls on a closed connection.
+var ErrClosed = errors.New("dbus: connection closed")
+
+// Error is an error reply to a method call.
+type Error struct {
+	// Name is the error name, e.g. "org.freedesktop.DBus.Error.AccessDenied".
+	Name string
+
+	// Message is the optional human readable error message.
+	Message string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+
+	return e.Name + ": " + e.Message
+}
+
+// Message is a D-Bus message.
+type Message struct {
+	Type        byte
+	Serial      uint32
+	ReplySerial uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	Destination string
+	Sender      string
+	Signature   Signature
+	Body        []interface{}
+
+	// Files contains the unix file descriptors passed with the message.
+	Files []*os.File
+}
+
+// Conn is a connection to a message bus.
+type Conn struct {
+	conn   *net.UnixConn
+	r      *bufio.Reader
+	fds    []int
+	closed chan struct{}
+	once   sync.Once
+
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	serial  uint32
+	calls   map[uint32]chan *Message
+	handler func(*Message)
+	err     error
+}
+
+// SystemBus connects to the system bus at the address from the
+// DBUS_SYSTEM_BUS_ADDRESS environment variable, falling back to
+// DefaultSystemBusAddress.
+func SystemBus() (*Conn, error) {
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if address == "" {
+		address = DefaultSystemBusAddress
+	}
+
+	return Dial(address)
+}
+
+// Dial connects to the message bus at address, authenticates and registers
+// with the bus. Only unix socket addresses are supported. If address lists
+// multiple addresses separated by semicolons, the first one that can be
+// connected to is used.
+func Dial(address string) (*Conn, error) {
+	var err error
+
+	for _, addr := range strings.Split(address, ";") {
+		var conn *net.UnixConn
+		if conn, err = dialUnix(addr); err != nil {
+			continue
+		}
+
+		c := &Conn{
+			conn:   conn,
+			closed: make(chan struct{}),
+			calls:  make(map[uint32]chan *Message),
+		}
+		c.r = bufio.NewReader(readerFunc(c.readMsg))
+
+		if err = c.auth(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		go c.readLoop()
+
+		if _, err = c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	return nil, err
+}
+
+func dialUnix(address string) (*net.UnixConn, error) {
+	transport, params := splitAddress(address)
+	if transport != "unix" {
+		return nil, fmt.Errorf("dbus: unsupported address %q", address)
+	}
+
+	var path string
+
+	switch {
+	case params["path"] != "":
+		path = params["path"]
+	case params["abstract"] != "":
+		path = "@" + params["abstract"]
+	default:
+		return nil, fmt.Errorf("dbus: unsupported address %q", address)
+	}
+
+	return net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+}
+
+// splitAddress splits a D-Bus server address like "unix:path=/run/bus" into
+// its transport and unescaped key-value params.
+func splitAddress(address string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(address, ":", 2)
+	if len(parts) != 2 {
+		return "", params
+	}
+
+	for _, kv := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(kv, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		params[kv[0]] = unescape(kv[1])
+	}
+
+	return parts[0], params
+}
+
+// unescape decodes the %xx escapes of address values.
+func unescape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if x, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(x))
+				i += 2
+				continue
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// auth performs the EXTERNAL authentication handshake and negotiates unix
+// file descriptor passing.
+func (c *Conn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+
+	if line, err := c.readLine(); err != nil {
+		return err
+	} else if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication failed: %s", line)
+	}
+
+	if _, err := c.conn.Write([]byte("NEGOTIATE_UNIX_FD\r\n")); err != nil {
+		return err
+	}
+
+	if line, err := c.readLine(); err != nil {
+		return err
+	} else if line != "AGREE_UNIX_FD" {
+		return fmt.Errorf("dbus: unix fd passing is not supported: %s", line)
+	}
+
+	_, err := c.conn.Write([]byte("BEGIN\r\n"))
+
+	return err
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+// readMsg reads from the socket and queues the file descriptors that are
+// passed along. File descriptors are sent together with the first byte of
+// the message they belong to, so they are always queued before the message
+// is decoded.
+func (c *Conn) readMsg(p []byte) (int, error) {
+	oob := make([]byte, syscall.CmsgSpace(maxUnixFDs*4))
+
+	n, oobn, _, _, err := c.conn.ReadMsgUnix(p, oob)
+	if n < 0 {
+		n = 0
+	}
+
+	if oobn > 0 {
+		msgs, perr := syscall.ParseSocketControlMessage(oob[:oobn])
+		if perr != nil {
+			return n, perr
+		}
+
+		for _, msg := range msgs {
+			fds, perr := syscall.ParseUnixRights(&msg)
+			if perr != nil {
+				return n, perr
+			}
+
+			c.fds = append(c.fds, fds...)
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the connection. Pending calls fail with ErrClosed.
+func (c *Conn) Close() error {
+	err := ErrClosed
+
+	c.once.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// HandleCalls sets the func which is called for every incoming method call.
+// The handler must reply to the call using Reply or ReplyError. Without a
+// handler, method calls are answered with an UnknownMethod error.
+func (c *Conn) HandleCalls(handler func(call *Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handler = handler
+}
+
+// RequestName requests the well-known name for the connection and fails if
+// the connection does not become its primary owner.
+func (c *Conn) RequestName(name string) error {
+	reply, err := c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "RequestName", "su", name, uint32(0))
+	if err != nil {
+		return err
+	}
+
+	// DBUS_REQUEST_NAME_REPLY_PRIMARY_OWNER
+	if len(reply.Body) != 1 || reply.Body[0] != uint32(1) {
+		return fmt.Errorf("dbus: name %q is already taken", name)
+	}
+
+	return nil
+}
+
+// Call calls a method and waits for the reply. The args are encoded
+// according to sig. Error replies are returned as *Error.
+func (c *Conn) Call(dest string, path ObjectPath, iface, member string, sig Signature, args ...interface{}) (*Message, error) {
+	msg := &Message{
+		Type:        TypeMethodCall,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: dest,
+		Signature:   sig,
+		Body:        args,
+	}
+
+	ch := make(chan *Message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.serial++
+	msg.Serial = c.serial
+	c.calls[msg.Serial] = ch
+	c.mu.Unlock()
+
+	if err := c.send(msg); err != nil {
+		c.mu.Lock()
+		delete(c.calls, msg.Serial)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	reply, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+
+	if reply.Type == TypeError {
+		closeFiles(reply.Files)
+
+		e := &Error{Name: reply.ErrorName}
+		if len(reply.Body) > 0 {
+			e.Message, _ = reply.Body[0].(string)
+		}
+
+		return nil, e
+	}
+
+	return reply, nil
+}
+
+// Reply sends a method return for call. The args are encoded according to
+// sig.
+func (c *Conn) Reply(call *Message, sig Signature, args ...interface{}) error {
+	return c.sendReply(&Message{
+		Type:        TypeMethodReturn,
+		ReplySerial: call.Serial,
+		Destination: call.Sender,
+		Signature:   sig,
+		Body:        args,
+	})
+}
+
+// ReplyError sends an error reply for call.
+func (c *Conn) ReplyError(call *Message, name, message string) error {
+	return c.sendReply(&Message{
+		Type:        TypeError,
+		ReplySerial: call.Serial,
+		Destination: call.Sender,
+		ErrorName:   name,
+		Signature:   "s",
+		Body:        []interface{}{message},
+	})
+}
+
+func (c *Conn) sendReply(msg *Message) error {
+	c.mu.Lock()
+	c.serial++
+	msg.Serial = c.serial
+	c.mu.Unlock()
+
+	return c.send(msg)
+}
+
+func (c *Conn) send(msg *Message) error {
+	b, files, err := msg.marshal()
+	if err != nil {
+		return err
+	}
+
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	_, _, err = c.conn.WriteMsgUnix(b, oob, nil)
+
+	return err
+}
+
+// readLoop reads messages until the connection is closed and dispatches
+// them.
+func (c *Conn) readLoop() {
+	var err error
+
+	for {
+		var msg *Message
+		if msg, err = c.readMessage(); err != nil {
+			break
+		}
+
+		c.dispatch(msg)
+	}
+
+	select {
+	case <-c.closed:
+		err = ErrClosed
+	default:
+		if errors.Is(err, io.EOF) {
+			err = ErrClosed
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = err
+
+	for serial, ch := range c.calls {
+		close(ch)
+		delete(c.calls, serial)
+	}
+
+	for _, fd := range c.fds {
+		syscall.Close(fd)
+	}
+}
+
+func (c *Conn) dispatch(msg *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch msg.Type {
+	case TypeMethodReturn, TypeError:
+		if ch, ok := c.calls[msg.ReplySerial]; ok {
+			delete(c.calls, msg.ReplySerial)
+			ch <- msg
+			return
+		}
+	case TypeMethodCall:
+		if c.handler != nil {
+			go c.handler(msg)
+			return
+		}
+
+		go c.ReplyError(msg, "org.freedesktop.DBus.Error.UnknownMethod", "no handler")
+	}
+
+	closeFiles(msg.Files)
+}
+
+func (c *Conn) readMessage() (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: invalid byte order %q", fixed[0])
+	}
+
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := 16 + int(fieldsLen)
+	headerLen += (8 - headerLen%8) % 8
+
+	if fieldsLen > maxMessageSize || bodyLen > maxMessageSize || headerLen+int(bodyLen) > maxMessageSize {
+		return nil, errors.New("dbus: message too large")
+	}
+
+	b := make([]byte, headerLen+int(bodyLen))
+	copy(b, fixed)
+
+	if _, err := io.ReadFull(c.r, b[16:]); err != nil {
+		return nil, err
+	}
+
+	return unmarshal(order, b, headerLen, c.takeFDs)
+}
+
+// takeFDs takes the first n queued file descriptors.
+func (c *Conn) takeFDs(n int) ([]*os.File, error) {
+	if n > len(c.fds) {
+		return nil, fmt.Errorf("dbus: expected %d unix fds, got %d", n, len(c.fds))
+	}
+
+	files := make([]*os.File, n)
+	for i, fd := range c.fds[:n] {
+		files[i] = os.NewFile(uintptr(fd), "dbus-fd")
+	}
+
+	c.fds = c.fds[n:]
+
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// marshal encodes the message and returns the file descriptors that need to
+// be passed along.
+func (m *Message) marshal() ([]byte, []*os.File, error) {
+	body := &encoder{order: binary.LittleEndian}
+	if err := body.encode(string(m.Signature), m.Body...); err != nil {
+		return nil, nil, err
+	}
+
+	fields := []interface{}{}
+
+	addField := func(code byte, sig Signature, value interface{}) {
+		fields = append(fields, []interface{}{code, Variant{Signature: sig, Value: value}})
+	}
+
+	if m.Path != "" {
+		addField(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		addField(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		addField(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		addField(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		addField(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		addField(fieldDestination, "s", m.Destination)
+	}
+	if m.Signature != "" {
+		addField(fieldSignature, "g", m.Signature)
+	}
+	if len(body.files) > 0 {
+		addField(fieldUnixFDs, "u", uint32(len(body.files)))
+	}
+
+	header := &encoder{order: binary.LittleEndian}
+	header.buf = append(header.buf, 'l', m.Type, 0, 1)
+	header.uint32(uint32(len(body.buf)))
+	header.uint32(m.Serial)
+
+	if err := header.encode("a(yv)", fields); err != nil {
+		return nil, nil, err
+	}
+
+	header.align(8)
+
+	return append(header.buf, body.buf...), body.files, nil
+}
+
+// unmarshal decodes a message. The header including the padding to the body
+// is headerLen bytes long.
+func unmarshal(order binary.ByteOrder, b []byte, headerLen int, takeFDs func(int) ([]*os.File, error)) (*Message, error) {
+	m := &Message{
+		Type:   b[1],
+		Serial: order.Uint32(b[8:]),
+	}
+
+	header := &decoder{order: order, buf: b[:headerLen], pos: 12}
+
+	values, err := header.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+
+	var numFDs uint32
+
+	for _, field := range values[0].([]interface{}) {
+		field := field.([]interface{})
+		value := field[1].(Variant).Value
+
+		var ok bool
+
+		switch field[0].(byte) {
+		case fieldPath:
+			m.Path, ok = value.(ObjectPath)
+		case fieldInterface:
+			m.Interface, ok = value.(string)
+		case fieldMember:
+			m.Member, ok = value.(string)
+		case fieldErrorName:
+			m.ErrorName, ok = value.(string)
+		case fieldReplySerial:
+			m.ReplySerial, ok = value.(uint32)
+		case fieldDestination:
+			m.Destination, ok = value.(string)
+		case fieldSender:
+			m.Sender, ok = value.(string)
+		case fieldSignature:
+			m.Signature, ok = value.(Signature)
+		case fieldUnixFDs:
+			numFDs, ok = value.(uint32)
+		default:
+			// Unknown header fields must be ignored.
+			ok = true
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("dbus: invalid header field %d", field[0])
+		}
+	}
+
+	if numFDs > maxUnixFDs {
+		return nil, fmt.Errorf("dbus: too many unix fds: %d", numFDs)
+	}
+
+	if m.Files, err = takeFDs(int(numFDs)); err != nil {
+		return nil, err
+	}
+
+	body := &decoder{order: order, buf: b[headerLen:], files: m.Files}
+
+	if m.Body, err = body.decode(string(m.Signature)); err != nil {
+		closeFiles(m.Files)
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,164 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/dbus/dbustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoding(t *testing.T) {
+	sig := "ybnqiuxtdsogva(ss)a{sv}(yv)"
+	values := []interface{}{
+		byte(7), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 0.5,
+		"foo", ObjectPath("/org/example"), Signature("a(ss)"),
+		Variant{Signature: "as", Value: []interface{}{"a", "b"}},
+		[]interface{}{[]interface{}{"a", "b"}, []interface{}{"c", "d"}},
+		[]interface{}{[]interface{}{"key", Variant{Signature: "u", Value: uint32(1)}}},
+		[]interface{}{byte(1), Variant{Signature: "x", Value: int64(2)}},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		e := &encoder{order: order}
+		require.NoError(t, e.encode(sig, values...))
+
+		d := &decoder{order: order, buf: e.buf}
+
+		decoded, err := d.decode(sig)
+		require.NoError(t, err)
+		assert.Equal(t, values, decoded)
+		assert.Equal(t, len(e.buf), d.pos)
+	}
+}
+
+func TestEncoding_Errors(t *testing.T) {
+	e := &encoder{order: binary.LittleEndian}
+	assert.Error(t, e.encode("s", 1))
+	assert.Error(t, e.encode("ss", "foo"))
+	assert.Error(t, e.encode("(s", []interface{}{"foo"}))
+
+	// Variants nesting variants are limited although the signature is flat.
+	buf := []byte{}
+	for i := 0; i < 2*maxDepth; i++ {
+		buf = append(buf, 1, 'v', 0)
+	}
+
+	d := &decoder{order: binary.LittleEndian, buf: buf}
+	_, err := d.decode("v")
+	assert.Error(t, err)
+
+	d = &decoder{order: binary.LittleEndian, buf: []byte{0xff, 0xff, 0, 0}}
+	_, err = d.decode("as")
+	assert.Error(t, err)
+}
+
+func TestMessage(t *testing.T) {
+	msg := &Message{
+		Type:        TypeMethodCall,
+		Serial:      3,
+		Path:        "/org/example",
+		Interface:   "org.example.Iface",
+		Member:      "Method",
+		Destination: "org.example",
+		Signature:   "su",
+		Body:        []interface{}{"foo", uint32(42)},
+	}
+
+	b, files, err := msg.marshal()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	headerLen := len(b) - 12 // "foo" and uint32 are 12 bytes
+
+	decoded, err := unmarshal(binary.LittleEndian, b, headerLen, func(n int) ([]*os.File, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+}
+
+func TestSplitAddress(t *testing.T) {
+	transport, params := splitAddress("unix:path=/tmp/dbus%2dtest,guid=123")
+	assert.Equal(t, "unix", transport)
+	assert.Equal(t, map[string]string{"path": "/tmp/dbus-test", "guid": "123"}, params)
+}
+
+// startDaemon starts a private dbus-daemon. The test is skipped if
+// dbus-daemon is not installed.
+func startDaemon(t *testing.T) *dbustest.Daemon {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	d, err := dbustest.StartDaemon()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+func TestConn(t *testing.T) {
+	d := startDaemon(t)
+
+	service, err := Dial(d.Address)
+	require.NoError(t, err)
+	defer service.Close()
+
+	require.NoError(t, service.RequestName("org.example.Test"))
+
+	service.HandleCalls(func(call *Message) {
+		switch call.Member {
+		case "Pipe":
+			r, w, err := os.Pipe()
+			require.NoError(t, err)
+			defer r.Close()
+			defer w.Close()
+
+			_, _ = w.Write([]byte(call.Body[0].(string)))
+			assert.NoError(t, service.Reply(call, "h", r))
+		default:
+			assert.NoError(t, service.ReplyError(call, "org.example.Error", "unknown method "+call.Member))
+		}
+	})
+
+	client, err := Dial(d.Address)
+	require.NoError(t, err)
+
+	reply, err := client.Call("org.example.Test", "/org/example", "org.example.Test", "Pipe", "s", "hello")
+	require.NoError(t, err)
+	require.Len(t, reply.Files, 1)
+	assert.Equal(t, reply.Files[0], reply.Body[0])
+
+	f := reply.Files[0]
+	defer f.Close()
+
+	// The service closed its copy of the write end already.
+	buf, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	_, err = client.Call("org.example.Test", "/org/example", "org.example.Test", "Foo", "")
+	assert.Equal(t, &Error{Name: "org.example.Error", Message: "unknown method Foo"}, err)
+
+	require.NoError(t, client.Close())
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Call("org.example.Test", "/org/example", "org.example.Test", "Foo", "")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("call on closed connection did not return")
+	}
+}
@@ -0,0 +1,92 @@
+// Package dbustest provides a private D-Bus daemon for tests.
+package dbustest
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const daemonConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>custom</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// Daemon is a private dbus-daemon for use in tests. Services like logind can
+// be stubbed by connecting to it using dbus.Dial, requesting their
+// well-known name via Conn.RequestName and answering calls using
+// Conn.HandleCalls.
+type Daemon struct {
+	cmd *exec.Cmd
+	dir string
+
+	// Address is the bus address of the daemon.
+	Address string
+}
+
+// StartDaemon starts a private dbus-daemon which listens on a socket in a
+// temporary directory.
+func StartDaemon() (*Daemon, error) {
+	dir, err := ioutil.TempDir("", "barista-dbus")
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{dir: dir}
+
+	config := filepath.Join(dir, "bus.conf")
+	socket := filepath.Join(dir, "bus.sock")
+
+	if err := ioutil.WriteFile(config, []byte(fmt.Sprintf(daemonConfig, socket)), 0600); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	d.cmd = exec.Command("dbus-daemon", "--nofork", "--print-address", "--config-file="+config)
+
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	if err := d.cmd.Start(); err != nil {
+		d.cmd = nil
+		d.Close()
+		return nil, err
+	}
+
+	// The address is printed once the daemon accepts connections.
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("dbustest: reading daemon address: %v", err)
+	}
+
+	d.Address = strings.TrimSpace(address)
+
+	return d, nil
+}
+
+// Close stops the daemon and removes its socket.
+func (d *Daemon) Close() error {
+	if d.cmd != nil {
+		_ = d.cmd.Process.Kill()
+		_ = d.cmd.Wait()
+	}
+
+	return os.RemoveAll(d.dir)
+}
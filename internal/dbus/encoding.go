@@ -0,0 +1,486 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// maxDepth limits the nesting of containers in signatures as required by the
+// D-Bus specification.
+const maxDepth = 64
+
+// ObjectPath is a D-Bus object path, e.g. "/org/freedesktop/login1".
+type ObjectPath string
+
+// Signature is a D-Bus type signature, e.g. "a(ssssuu)".
+type Signature string
+
+// Variant is a value together with its signature.
+type Variant struct {
+	Signature Signature
+	Value     interface{}
+}
+
+// nextType splits the first complete type off sig.
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", errors.New("dbus: empty signature")
+	}
+
+	depth := 0
+
+	for i := 0; i < len(sig); i++ {
+		switch sig[i] {
+		case 'a':
+			continue
+		case '(', '{':
+			depth++
+		case ')', '}':
+			depth--
+		}
+
+		if depth > maxDepth {
+			return "", "", fmt.Errorf("dbus: signature %q is nested too deeply", sig)
+		}
+
+		if depth < 0 {
+			return "", "", fmt.Errorf("dbus: invalid signature %q", sig)
+		}
+
+		if depth == 0 {
+			return sig[:i+1], sig[i+1:], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("dbus: invalid signature %q", sig)
+}
+
+// alignment returns the alignment of the type sig starts with.
+func alignment(sig string) int {
+	switch sig[0] {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
+
+// encoder marshals values into the D-Bus wire format. Alignment is relative
+// to the start of buf, so buf must start at an 8-byte boundary of the
+// message.
+type encoder struct {
+	order binary.ByteOrder
+	buf   []byte
+	files []*os.File
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	e.order.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+// encode encodes args according to sig.
+func (e *encoder) encode(sig string, args ...interface{}) error {
+	for _, arg := range args {
+		typ, rest, err := nextType(sig)
+		if err != nil {
+			return err
+		}
+
+		if err := e.encodeValue(typ, arg); err != nil {
+			return err
+		}
+
+		sig = rest
+	}
+
+	if sig != "" {
+		return fmt.Errorf("dbus: missing values for signature %q", sig)
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeValue(sig string, v interface{}) error {
+	e.align(alignment(sig))
+
+	var ok bool
+
+	switch sig[0] {
+	case 'y':
+		var b byte
+		if b, ok = v.(byte); ok {
+			e.buf = append(e.buf, b)
+		}
+	case 'b':
+		var b bool
+		if b, ok = v.(bool); ok {
+			x := uint32(0)
+			if b {
+				x = 1
+			}
+			e.uint32(x)
+		}
+	case 'n', 'q':
+		var x uint16
+		switch v := v.(type) {
+		case int16:
+			x, ok = uint16(v), true
+		case uint16:
+			x, ok = v, true
+		}
+		if ok {
+			e.buf = append(e.buf, 0, 0)
+			e.order.PutUint16(e.buf[len(e.buf)-2:], x)
+		}
+	case 'i', 'u':
+		var x uint32
+		switch v := v.(type) {
+		case int32:
+			x, ok = uint32(v), true
+		case uint32:
+			x, ok = v, true
+		}
+		if ok {
+			e.uint32(x)
+		}
+	case 'x', 't', 'd':
+		var x uint64
+		switch v := v.(type) {
+		case int64:
+			x, ok = uint64(v), true
+		case uint64:
+			x, ok = v, true
+		case float64:
+			x, ok = math.Float64bits(v), true
+		}
+		if ok {
+			e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+			e.order.PutUint64(e.buf[len(e.buf)-8:], x)
+		}
+	case 's', 'o':
+		var s string
+		switch v := v.(type) {
+		case string:
+			s, ok = v, true
+		case ObjectPath:
+			s, ok = string(v), true
+		}
+		if ok {
+			e.uint32(uint32(len(s)))
+			e.buf = append(append(e.buf, s...), 0)
+		}
+	case 'g':
+		var s string
+		switch v := v.(type) {
+		case string:
+			s, ok = v, true
+		case Signature:
+			s, ok = string(v), true
+		}
+		if ok {
+			if len(s) > 255 {
+				return fmt.Errorf("dbus: signature %q is too long", s)
+			}
+			e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+		}
+	case 'h':
+		var f *os.File
+		if f, ok = v.(*os.File); ok {
+			e.uint32(uint32(len(e.files)))
+			e.files = append(e.files, f)
+		}
+	case 'v':
+		var variant Variant
+		if variant, ok = v.(Variant); ok {
+			if err := e.encodeValue("g", variant.Signature); err != nil {
+				return err
+			}
+			return e.encode(string(variant.Signature), variant.Value)
+		}
+	case 'a':
+		var elems []interface{}
+		if elems, ok = v.([]interface{}); ok {
+			return e.encodeArray(sig[1:], elems)
+		}
+	case '(', '{':
+		var fields []interface{}
+		if fields, ok = v.([]interface{}); ok {
+			return e.encode(sig[1:len(sig)-1], fields...)
+		}
+	default:
+		return fmt.Errorf("dbus: unsupported type %q", sig)
+	}
+
+	if !ok {
+		return fmt.Errorf("dbus: cannot encode %T as %q", v, sig)
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeArray(elemSig string, elems []interface{}) error {
+	e.uint32(0)
+	lenPos := len(e.buf) - 4
+
+	// The length does not include the padding to the first element.
+	e.align(alignment(elemSig))
+	start := len(e.buf)
+
+	for _, elem := range elems {
+		if err := e.encodeValue(elemSig, elem); err != nil {
+			return err
+		}
+	}
+
+	e.order.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+
+	return nil
+}
+
+// decoder unmarshals values from the D-Bus wire format. Alignment is
+// relative to the start of buf.
+type decoder struct {
+	order binary.ByteOrder
+	buf   []byte
+	pos   int
+	files []*os.File
+	depth int
+}
+
+var errShortBuffer = errors.New("dbus: message is truncated")
+
+func (d *decoder) align(n int) error {
+	pos := (d.pos + n - 1) / n * n
+	if pos > len(d.buf) {
+		return errShortBuffer
+	}
+
+	d.pos = pos
+
+	return nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint32(b), nil
+}
+
+// decode decodes all values of sig.
+func (d *decoder) decode(sig string) ([]interface{}, error) {
+	var values []interface{}
+
+	for sig != "" {
+		typ, rest, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.decodeValue(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+		sig = rest
+	}
+
+	return values, nil
+}
+
+func (d *decoder) decodeValue(sig string) (interface{}, error) {
+	if err := d.align(alignment(sig)); err != nil {
+		return nil, err
+	}
+
+	switch sig[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		x, err := d.uint32()
+		return x != 0, err
+	case 'n', 'q':
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		x := d.order.Uint16(b)
+		if sig[0] == 'n' {
+			return int16(x), nil
+		}
+		return x, nil
+	case 'i':
+		x, err := d.uint32()
+		return int32(x), err
+	case 'u':
+		return d.uint32()
+	case 'x', 't', 'd':
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		x := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(x), nil
+		case 'd':
+			return math.Float64frombits(x), nil
+		default:
+			return x, nil
+		}
+	case 's', 'o':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'o' {
+			return ObjectPath(b[:n]), nil
+		}
+		return string(b[:n]), nil
+	case 'g':
+		return d.signature()
+	case 'h':
+		i, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if int(i) >= len(d.files) {
+			return nil, fmt.Errorf("dbus: unix fd index %d out of range", i)
+		}
+		return d.files[i], nil
+	case 'v':
+		return d.variant()
+	case 'a':
+		return d.array(sig[1:])
+	case '(', '{':
+		return d.nested(func() (interface{}, error) {
+			return d.decode(sig[1 : len(sig)-1])
+		})
+	default:
+		return nil, fmt.Errorf("dbus: unsupported type %q", sig)
+	}
+}
+
+func (d *decoder) signature() (Signature, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return "", err
+	}
+
+	b, err = d.read(int(b[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+
+	return Signature(b[:len(b)-1]), nil
+}
+
+func (d *decoder) variant() (interface{}, error) {
+	sig, err := d.signature()
+	if err != nil {
+		return nil, err
+	}
+
+	typ, rest, err := nextType(string(sig))
+	if err != nil {
+		return nil, err
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("dbus: variant signature %q is not a single type", sig)
+	}
+
+	return d.nested(func() (interface{}, error) {
+		v, err := d.decodeValue(typ)
+		return Variant{Signature: sig, Value: v}, err
+	})
+}
+
+func (d *decoder) array(elemSig string) (interface{}, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.align(alignment(elemSig)); err != nil {
+		return nil, err
+	}
+
+	end := d.pos + int(n)
+	if end > len(d.buf) {
+		return nil, errShortBuffer
+	}
+
+	return d.nested(func() (interface{}, error) {
+		elems := []interface{}{}
+
+		for d.pos < end {
+			elem, err := d.decodeValue(elemSig)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, elem)
+		}
+
+		if d.pos != end {
+			return nil, errors.New("dbus: array length mismatch")
+		}
+
+		return elems, nil
+	})
+}
+
+// nested runs fn one container level deeper. Variants can nest arbitrarily
+// deep without the signature telling, so the depth is also limited here.
+func (d *decoder) nested(fn func() (interface{}, error)) (interface{}, error) {
+	if d.depth >= maxDepth {
+		return nil, errors.New("dbus: message is nested too deeply")
+	}
+
+	d.depth++
+	defer func() { d.depth-- }()
+
+	return fn()
+}
@@ -1,8 +1,10 @@
 package exec
 
 import (
+	"bytes"
 	"fmt"
 	"os/exec"
+	"sync"
 )
 
 // CommandOutputFunc is a func which takes a command name and an optional
@@ -13,6 +15,23 @@ type CommandOutputFunc func(cmd Cmd) ([]byte, error)
 // number of args and runs it, returning any errors.
 type CommandRunFunc func(cmd Cmd) error
 
+// CommandStartFunc is a func which takes a command name and an optional
+// number of args and starts it without waiting for it to complete.
+type CommandStartFunc func(cmd Cmd) (Process, error)
+
+// Process is a process that was started using CommandStart.
+type Process interface {
+	// Pid returns the process id.
+	Pid() int
+
+	// Wait waits for the process to exit. Any returned error will usually
+	// be of type *ExitError.
+	Wait() error
+
+	// Kill causes the process to exit immediately.
+	Kill() error
+}
+
 var (
 	// commandOutputFn is pointing to the function that will be called by
 	// CommandOutput. Can be overridden using FakeCommandOutput.
@@ -21,6 +40,10 @@ var (
 	// commandRunFn is pointing to the function that will be called by
 	// CommandRun. Can be overridden using FakeCommandRun.
 	commandRunFn = commandRun
+
+	// commandStartFn is pointing to the function that will be called by
+	// CommandStart. Can be overridden using FakeCommandStart.
+	commandStartFn = commandStart
 )
 
 // CommandOutput runs the a command with given args and returns its standard
@@ -32,7 +55,7 @@ var (
 // In tests the behaviour can be changed. See the documentation of the
 // FakeCommandOutput func.
 func CommandOutput(name string, args ...string) ([]byte, error) {
-	return commandOutputFn(Cmd{name, args})
+	return commandOutputFn(Cmd{Name: name, Args: args})
 }
 
 // commandOutput is a CommandOutputFunc which directly calls
@@ -52,15 +75,75 @@ func commandOutput(cmd Cmd) ([]byte, error) {
 // In tests the behaviour can be changed. See the documentation of the
 // FakeCommandRun func.
 func CommandRun(name string, args ...string) error {
-	return commandRunFn(Cmd{name, args})
+	return commandRunFn(Cmd{Name: name, Args: args})
+}
+
+// CommandRunInput runs a command with given args and passes input to its
+// standard input. Any returned error will usually be of type *ExitError.
+//
+// In tests the behaviour can be changed using FakeCommandRun. The input is
+// available via the Stdin field of the faked Cmd.
+func CommandRunInput(input []byte, name string, args ...string) error {
+	return commandRunFn(Cmd{Name: name, Args: args, Stdin: input})
 }
 
 // commandRun is a CommandRunFunc which directly calls
 // exec.Command(name, args...).Run() and returns the result.
 func commandRun(cmd Cmd) error {
-	err := exec.Command(cmd.Name, cmd.Args...).Run()
+	c := exec.Command(cmd.Name, cmd.Args...)
+	if cmd.Stdin != nil {
+		c.Stdin = bytes.NewReader(cmd.Stdin)
+	}
+
+	return convertExitError(c.Run())
+}
+
+// CommandStart starts a command with given args but does not wait for it to
+// complete. The returned Process can be used to wait for or kill the
+// process. On Linux the process receives SIGTERM when the bar exits. For
+// that, processes are started on an OS thread which stays locked to a
+// dedicated goroutine.
+//
+// In the normal case, this just internally calls
+// exec.Command(name, args...).Start().
+//
+// In tests the behaviour can be changed. See the documentation of the
+// FakeCommandStart func.
+func CommandStart(name string, args ...string) (Process, error) {
+	return commandStartFn(Cmd{Name: name, Args: args})
+}
+
+// commandStart is a CommandStartFunc which directly calls
+// exec.Command(name, args...).Start() and returns the started process.
+func commandStart(cmd Cmd) (Process, error) {
+	c := exec.Command(cmd.Name, cmd.Args...)
+
+	if err := start(c); err != nil {
+		return nil, err
+	}
+
+	return &process{cmd: c}, nil
+}
+
+// process wraps an *exec.Cmd that was started to satisfy the Process
+// interface.
+type process struct {
+	cmd *exec.Cmd
+}
+
+// Pid implements Process.
+func (p *process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Wait implements Process.
+func (p *process) Wait() error {
+	return convertExitError(p.cmd.Wait())
+}
 
-	return convertExitError(err)
+// Kill implements Process.
+func (p *process) Kill() error {
+	return p.cmd.Process.Kill()
 }
 
 // FakeCommandOutput replaces all calls of CommandOutput with given fn in
@@ -115,11 +198,97 @@ func FakeCommandRun(fn CommandRunFunc) func() {
 	return func() { commandRunFn = currentFn }
 }
 
+// FakeCommandStart replaces all calls of CommandStart with given fn in tests.
+// The returned func must be called after the tests are finished to restore
+// CommandStart to avoid unexpected behaviour. See FakeProcess for a Process
+// implementation that can be used in tests.
+//
+// 	 fakeCommandStartFn := func(cmd exec.Cmd) (exec.Process, error) {
+// 		 if cmd.Matches("foo", "--bar") {
+// 			 return exec.NewFakeProcess(42), nil
+// 		 }
+//
+// 		 return nil, errors.New("unexpected command")
+// 	 }
+//
+// 	 restore := FakeCommandStart(fakeCommandStartFn)
+// 	 defer restore()
+func FakeCommandStart(fn CommandStartFunc) func() {
+	currentFn := commandStartFn
+	commandStartFn = fn
+
+	return func() { commandStartFn = currentFn }
+}
+
+// FakeProcess is a fake Process for use in tests. It runs until it is killed
+// or Exit is called.
+type FakeProcess struct {
+	pid    int
+	done   chan struct{}
+	once   sync.Once
+	err    error
+	killed bool
+	mu     sync.Mutex
+}
+
+// NewFakeProcess creates a new *FakeProcess with given pid.
+func NewFakeProcess(pid int) *FakeProcess {
+	return &FakeProcess{
+		pid:  pid,
+		done: make(chan struct{}),
+	}
+}
+
+// Pid implements Process.
+func (p *FakeProcess) Pid() int {
+	return p.pid
+}
+
+// Wait implements Process.
+func (p *FakeProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Kill implements Process.
+func (p *FakeProcess) Kill() error {
+	p.mu.Lock()
+	p.killed = true
+	p.mu.Unlock()
+
+	p.Exit(&ExitError{
+		ProcessState: &FakeProcessState{
+			ExitStatus:   -1,
+			ErrorMessage: "signal: killed",
+		},
+	})
+
+	return nil
+}
+
+// Killed returns true if Kill was called on the process.
+func (p *FakeProcess) Killed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.killed
+}
+
+// Exit makes the process exit with given error. Subsequent calls are no-ops.
+func (p *FakeProcess) Exit(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
 // Cmd is a container type which wrap the command name and args. It has some
 // methods attached to it which help matching commands in tests.
 type Cmd struct {
 	Name string
 	Args []string
+
+	// Stdin is passed to the standard input of the command if not nil.
+	Stdin []byte
 }
 
 // ArgsMatch returns true if the command's args match the provided ones
@@ -0,0 +1,39 @@
+package exec
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+var (
+	starterOnce sync.Once
+	starts      = make(chan func())
+)
+
+// start starts c with a parent death signal, so that processes started via
+// CommandStart do not outlive the bar. The kernel sends the signal once the
+// OS thread which started the process exits, not the whole process. Processes
+// are therefore started on a goroutine which stays locked to its thread for
+// the lifetime of the bar.
+func start(c *exec.Cmd) error {
+	c.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+
+	starterOnce.Do(func() {
+		go func() {
+			// The goroutine never returns and never unlocks the
+			// thread, so the runtime never exits it.
+			runtime.LockOSThread()
+
+			for fn := range starts {
+				fn()
+			}
+		}()
+	})
+
+	errCh := make(chan error, 1)
+	starts <- func() { errCh <- c.Start() }
+
+	return <-errCh
+}
@@ -0,0 +1,17 @@
+package exec
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandStart_ParentDeathSignal(t *testing.T) {
+	p, err := CommandStart("true")
+	require.NoError(t, err)
+	defer p.Wait()
+
+	assert.Equal(t, syscall.SIGTERM, p.(*process).cmd.SysProcAttr.Pdeathsig)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import "os/exec"
+
+// start starts c. Platforms other than Linux do not support parent death
+// signals, so the process may outlive the bar.
+func start(c *exec.Cmd) error {
+	return c.Start()
+}
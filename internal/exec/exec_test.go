@@ -107,3 +107,65 @@ func TestConvertExitError(t *testing.T) {
 
 	assert.Equal(t, expectedError, convertExitError(exitError))
 }
+
+func TestFakeCommandStart(t *testing.T) {
+	proc := NewFakeProcess(42)
+
+	restore := FakeCommandStart(func(cmd Cmd) (Process, error) {
+		if cmd.Matches("foo", "--bar") {
+			return proc, nil
+		}
+
+		return nil, errors.New("some error")
+	})
+	defer restore()
+
+	_, err := CommandStart("foo")
+	require.Error(t, err)
+
+	p, err := CommandStart("foo", "--bar")
+	require.NoError(t, err)
+	assert.Equal(t, 42, p.Pid())
+	assert.False(t, proc.Killed())
+
+	require.NoError(t, p.Kill())
+	assert.True(t, proc.Killed())
+
+	err = p.Wait()
+	require.Error(t, err)
+	assert.Equal(t, "signal: killed", err.Error())
+}
+
+func TestCommandStart(t *testing.T) {
+	p, err := CommandStart("sh", "-c", "exit 3")
+	require.NoError(t, err)
+	assert.NotEqual(t, 0, p.Pid())
+
+	err = p.Wait()
+	require.Error(t, err)
+
+	exitError, ok := err.(*ExitError)
+	require.True(t, ok)
+	assert.Equal(t, 3, exitError.ExitCode())
+}
+
+func TestCommandRunInput(t *testing.T) {
+	require.NoError(t, CommandRunInput([]byte("foo"), "sh", "-c", `test "$(cat)" = foo`))
+
+	err := CommandRunInput([]byte("bar"), "sh", "-c", `test "$(cat)" = foo`)
+	require.Error(t, err)
+
+	exitError, ok := err.(*ExitError)
+	require.True(t, ok)
+	assert.Equal(t, 1, exitError.ExitCode())
+
+	var cmds []Cmd
+
+	defer FakeCommandRun(func(cmd Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})()
+
+	require.NoError(t, CommandRunInput([]byte("foo"), "cat"))
+	assert.Equal(t, []Cmd{{Name: "cat", Stdin: []byte("foo")}}, cmds)
+}
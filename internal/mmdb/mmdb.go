@@ -0,0 +1,433 @@
+// Package mmdb contains a minimal reader for MaxMind DB files as used by the
+// GeoLite2 and GeoIP2 databases. See
+// https://maxmind.github.io/MaxMind-DB/ for the format specification.
+//
+// The ip module only needs a handful of fields for a single lookup per
+// refresh, so this reader is used instead of depending on
+// github.com/oschwald/maxminddb-golang and its golang.org/x/sys dependency.
+// Values are decoded into generic maps and slices, struct decoding and
+// network iteration are not supported.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+)
+
+// metadataMarker precedes the metadata section at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// ErrInvalidDatabase is returned if the database is malformed.
+var ErrInvalidDatabase = errors.New("mmdb: invalid database")
+
+// Metadata contains the database metadata.
+type Metadata struct {
+	// DatabaseType describes the database, e.g. "GeoLite2-City".
+	DatabaseType string
+
+	// IPVersion is either 4 or 6.
+	IPVersion int
+
+	// NodeCount is the number of nodes in the search tree.
+	NodeCount uint32
+
+	// RecordSize is the size of a search tree record in bits.
+	RecordSize int
+}
+
+// Reader looks up records in a MaxMind DB.
+type Reader struct {
+	buf      []byte
+	tree     []byte
+	data     []byte
+	metadata Metadata
+	ipv4Node uint32
+}
+
+// Open reads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(buf)
+}
+
+// New creates a new *Reader for the database in buf.
+func New(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+
+	meta := buf[i+len(metadataMarker):]
+
+	value, _, err := decoder{buf: meta}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{buf: buf}
+	r.metadata.DatabaseType, _ = m["database_type"].(string)
+	r.metadata.IPVersion = int(toUint64(m["ip_version"]))
+	r.metadata.NodeCount = uint32(toUint64(m["node_count"]))
+	r.metadata.RecordSize = int(toUint64(m["record_size"]))
+
+	switch r.metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.metadata.RecordSize)
+	}
+
+	treeSize := int(r.metadata.NodeCount) * r.metadata.RecordSize / 4
+	if treeSize+16 > i {
+		return nil, fmt.Errorf("%w: search tree exceeds file size", ErrInvalidDatabase)
+	}
+
+	r.tree = buf[:treeSize]
+	r.data = buf[treeSize+16 : i]
+
+	if r.metadata.IPVersion == 6 {
+		// IPv4 addresses are stored in the ::/96 subtree of IPv6 databases.
+		for j := 0; j < 96 && r.ipv4Node < r.metadata.NodeCount; j++ {
+			r.ipv4Node = r.record(r.ipv4Node, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// Metadata returns the database metadata.
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup returns the record for ip. Maps are returned as
+// map[string]interface{}, arrays as []interface{}, strings as string,
+// unsigned integers as uint64 (or *big.Int for uint128), signed integers as
+// int32, floating point numbers as float32 or float64, booleans as bool and
+// byte sequences as []byte. Returns nil if the database does not contain a
+// record for ip.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	addr := ip.To4()
+	node := r.ipv4Node
+
+	if addr == nil {
+		if r.metadata.IPVersion == 4 {
+			return nil, fmt.Errorf("mmdb: cannot look up IPv6 address %s in IPv4 database", ip)
+		}
+
+		addr = ip.To16()
+		node = 0
+
+		if addr == nil {
+			return nil, fmt.Errorf("mmdb: invalid IP %v", ip)
+		}
+	}
+
+	nodeCount := r.metadata.NodeCount
+
+	for i := 0; i < len(addr)*8 && node < nodeCount; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == nodeCount {
+		return nil, nil
+	}
+
+	if node < nodeCount {
+		return nil, fmt.Errorf("%w: search tree too deep", ErrInvalidDatabase)
+	}
+
+	offset := int(node-nodeCount) - 16
+	if offset < 0 || offset >= len(r.data) {
+		return nil, fmt.Errorf("%w: data offset %d out of bounds", ErrInvalidDatabase, offset)
+	}
+
+	value, _, err := decoder{buf: r.data}.decode(offset)
+	return value, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node uint32, bit byte) uint32 {
+	size := r.metadata.RecordSize
+	b := r.tree[int(node)*size/4:]
+
+	switch size {
+	case 24:
+		if bit == 1 {
+			b = b[3:]
+		}
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		if bit == 1 {
+			b = b[4:]
+		}
+		return binary.BigEndian.Uint32(b)
+	}
+}
+
+// Data types.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDepth limits the nesting of maps and arrays to protect against
+// malicious databases.
+const maxDepth = 512
+
+// decoder decodes values from the data section. Pointers are relative to the
+// start of buf.
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) bytes(offset, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+n > len(d.buf) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+
+	return d.buf[offset : offset+n], nil
+}
+
+// decode decodes the value at offset and returns it together with the offset
+// of the next value.
+func (d decoder) decode(offset int) (interface{}, int, error) {
+	return d.decodeValue(offset, 0, false)
+}
+
+// decodeValue decodes the value at offset which is nested depth levels deep
+// in maps and arrays. Pointers may not point to other pointers, which
+// together with the depth limit guarantees that decoding terminates.
+func (d decoder) decodeValue(offset, depth int, viaPointer bool) (interface{}, int, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: data structure nested too deeply", ErrInvalidDatabase)
+	}
+
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctrl := b[0]
+	offset++
+
+	typ := int(ctrl >> 5)
+
+	if typ == typePointer {
+		if viaPointer {
+			return nil, 0, fmt.Errorf("%w: pointer to pointer", ErrInvalidDatabase)
+		}
+
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		value, _, err := d.decodeValue(pointer, depth, true)
+		return value, next, err
+	}
+
+	if typ == typeExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		typ = 7 + int(b[0])
+		offset++
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		offset += n
+
+		switch n {
+		case 1:
+			size = 29 + int(b[0])
+		case 2:
+			size = 285 + (int(b[0])<<8 | int(b[1]))
+		default:
+			size = 65821 + (int(b[0])<<16 | int(b[1])<<8 | int(b[2]))
+		}
+	}
+
+	switch typ {
+	case typeMap, typeArray:
+		// Every element takes at least one byte, which prevents huge
+		// allocations for bogus sizes.
+		if size > len(d.buf)-offset {
+			return nil, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+
+		for i := 0; i < size; i++ {
+			key, next, err := d.decodeValue(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidDatabase)
+			}
+
+			m[k], offset, err = d.decodeValue(next, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, size)
+
+		for i := range a {
+			a[i], offset, err = d.decodeValue(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEnd:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", ErrInvalidDatabase, typ)
+	}
+
+	b, err = d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: invalid double size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: invalid float size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrInvalidDatabase, typ)
+	}
+}
+
+// pointer decodes the pointer with control byte ctrl whose remaining bytes
+// start at offset. Returns the pointer and the offset after the pointer.
+func (d decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&0x3) + 1
+
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v := int(ctrl & 0x7)
+	if n == 4 {
+		v = 0
+	}
+
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+
+	return v, offset + n, nil
+}
+
+// toUint64 converts unsigned integer values to uint64. Returns 0 for other
+// types.
+func toUint64(v interface{}) uint64 {
+	u, _ := v.(uint64)
+	return u
+}
+
+// Path returns the value at the given path of map keys within value, e.g.
+// Path(record, "country", "iso_code"). Returns nil if the path does not
+// exist.
+func Path(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = m[key]
+	}
+
+	return value
+}
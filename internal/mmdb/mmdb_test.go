@@ -0,0 +1,180 @@
+package mmdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			w := newTestWriter(ipVersion, recordSize)
+			w.insert("203.0.113.0/24", map[string]interface{}{
+				"country": map[string]interface{}{"iso_code": "DE"},
+			})
+			w.insert("198.51.100.7/32", "single")
+			if ipVersion == 6 {
+				w.insert("2001:db8::/32", map[string]interface{}{"asn": uint32(64496)})
+			}
+
+			r, err := New(w.bytes())
+			require.NoError(t, err)
+
+			assert.Equal(t, Metadata{
+				DatabaseType: "Test",
+				IPVersion:    ipVersion,
+				NodeCount:    uint32(len(w.nodes)),
+				RecordSize:   recordSize,
+			}, r.Metadata())
+
+			record, err := r.Lookup(net.ParseIP("203.0.113.42"))
+			require.NoError(t, err)
+			assert.Equal(t, "DE", Path(record, "country", "iso_code"))
+			assert.Nil(t, Path(record, "city", "names", "en"))
+
+			record, err = r.Lookup(net.ParseIP("198.51.100.7"))
+			require.NoError(t, err)
+			assert.Equal(t, "single", record)
+
+			record, err = r.Lookup(net.ParseIP("198.51.100.8"))
+			require.NoError(t, err)
+			assert.Nil(t, record)
+
+			record, err = r.Lookup(net.ParseIP("2001:db8::1"))
+			if ipVersion == 4 {
+				require.Error(t, err)
+				continue
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, uint64(64496), Path(record, "asn"))
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	long := strings.Repeat("x", 300)
+
+	value := map[string]interface{}{
+		"array":  []interface{}{"a", uint16(1), true},
+		"bool":   false,
+		"bytes":  []byte{1, 2, 3},
+		"double": 1.5,
+		"int32":  int32(-7),
+		"long":   long,
+		"uint64": uint64(1) << 40,
+	}
+
+	decoded, next, err := decoder{buf: encode(value)}.decode(0)
+	require.NoError(t, err)
+	assert.Equal(t, len(encode(value)), next)
+	assert.Equal(t, map[string]interface{}{
+		"array":  []interface{}{"a", uint64(1), true},
+		"bool":   false,
+		"bytes":  []byte{1, 2, 3},
+		"double": 1.5,
+		"int32":  int32(-7),
+		"long":   long,
+		"uint64": uint64(1) << 40,
+	}, decoded)
+}
+
+func TestDecode_Pointer(t *testing.T) {
+	buf := encode("target")
+	start := len(buf)
+
+	// Map with one key whose value is a pointer to offset 0.
+	buf = append(buf, 0xe1)
+	buf = append(buf, encode("key")...)
+	buf = append(buf, 0x20, 0x00)
+	buf = append(buf, encode("after")...)
+
+	d := decoder{buf: buf}
+
+	value, next, err := d.decode(start)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"key": "target"}, value)
+
+	value, _, err = d.decode(next)
+	require.NoError(t, err)
+	assert.Equal(t, "after", value)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{
+			name: "pointer to pointer",
+			buf:  []byte{0x20, 0x02, 0x20, 0x00},
+		},
+		{
+			name: "array containing a pointer to itself",
+			buf:  []byte{0x01, 0x04, 0x20, 0x00},
+		},
+		{
+			name: "map size exceeds data",
+			buf:  []byte{0xff, 0xff, 0xff, 0xff},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := decoder{buf: test.buf}.decode(0)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidDatabase))
+		})
+	}
+}
+
+func TestDecode_Uint128(t *testing.T) {
+	buf := []byte{0x02, 0x03, 0x01, 0x00}
+
+	value, _, err := decoder{buf: buf}.decode(0)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(256), value)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New([]byte("foo"))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "metadata not found"))
+
+	buf := append([]byte(nil), metadataMarker...)
+	buf = append(buf, encode(map[string]interface{}{"record_size": uint16(16)})...)
+
+	_, err = New(buf)
+	require.EqualError(t, err, "mmdb: invalid database: unsupported record size 16")
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmdb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := newTestWriter(6, 28)
+	w.insert("203.0.113.0/24", "foo")
+
+	path := filepath.Join(dir, "test.mmdb")
+	require.NoError(t, ioutil.WriteFile(path, w.bytes(), 0644))
+
+	r, err := Open(path)
+	require.NoError(t, err)
+
+	record, err := r.Lookup(net.ParseIP("203.0.113.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", record)
+
+	_, err = Open(filepath.Join(dir, "nonexistent.mmdb"))
+	require.Error(t, err)
+}
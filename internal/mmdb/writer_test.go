@@ -0,0 +1,210 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"sort"
+)
+
+// testWriter builds MaxMind DB files for tests.
+type testWriter struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]testRecord
+	data       bytes.Buffer
+}
+
+type testRecord struct {
+	kind  int // 0: empty, 1: node, 2: data
+	value int
+}
+
+func newTestWriter(ipVersion, recordSize int) *testWriter {
+	return &testWriter{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		nodes:      make([][2]testRecord, 1),
+	}
+}
+
+// insert adds a record for the network in CIDR notation.
+func (w *testWriter) insert(cidr string, value interface{}) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	ip := network.IP
+	ones, _ := network.Mask.Size()
+
+	if w.ipVersion == 6 && ip.To4() != nil {
+		// IPv4 networks are stored in the ::/96 subtree.
+		ip = append(make(net.IP, 12), ip.To4()...)
+		ones += 96
+	}
+
+	offset := w.data.Len()
+	w.data.Write(encode(value))
+
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+
+		if i == ones-1 {
+			w.nodes[node][bit] = testRecord{kind: 2, value: offset}
+			break
+		}
+
+		rec := w.nodes[node][bit]
+		if rec.kind != 1 {
+			w.nodes = append(w.nodes, [2]testRecord{})
+			rec = testRecord{kind: 1, value: len(w.nodes) - 1}
+			w.nodes[node][bit] = rec
+		}
+
+		node = rec.value
+	}
+}
+
+func (w *testWriter) bytes() []byte {
+	var buf bytes.Buffer
+
+	nodeCount := len(w.nodes)
+
+	value := func(rec testRecord) uint32 {
+		switch rec.kind {
+		case 1:
+			return uint32(rec.value)
+		case 2:
+			return uint32(nodeCount + 16 + rec.value)
+		default:
+			return uint32(nodeCount)
+		}
+	}
+
+	for _, node := range w.nodes {
+		left, right := value(node[0]), value(node[1])
+
+		switch w.recordSize {
+		case 24:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.WriteByte(byte(left>>20)&0xf0 | byte(right>>24)&0x0f)
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			_ = binary.Write(&buf, binary.BigEndian, left)
+			_ = binary.Write(&buf, binary.BigEndian, right)
+		}
+	}
+
+	buf.Write(make([]byte, 16))
+	buf.Write(w.data.Bytes())
+	buf.Write(metadataMarker)
+	buf.Write(encode(map[string]interface{}{
+		"database_type": "Test",
+		"ip_version":    uint16(w.ipVersion),
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(w.recordSize),
+	}))
+
+	return buf.Bytes()
+}
+
+// encode encodes value in the MaxMind DB data format.
+func encode(value interface{}) []byte {
+	var buf bytes.Buffer
+
+	switch v := value.(type) {
+	case string:
+		writeControl(&buf, typeString, len(v))
+		buf.WriteString(v)
+	case []byte:
+		writeControl(&buf, typeBytes, len(v))
+		buf.Write(v)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		writeControl(&buf, typeBool, n)
+	case float64:
+		writeControl(&buf, typeDouble, 8)
+		_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		writeUint(&buf, typeUint16, uint64(v))
+	case uint32:
+		writeUint(&buf, typeUint32, uint64(v))
+	case uint64:
+		writeUint(&buf, typeUint64, v)
+	case int32:
+		writeControl(&buf, typeInt32, 4)
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	case []interface{}:
+		writeControl(&buf, typeArray, len(v))
+		for _, elem := range v {
+			buf.Write(encode(elem))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeControl(&buf, typeMap, len(v))
+		for _, key := range keys {
+			buf.Write(encode(key))
+			buf.Write(encode(v[key]))
+		}
+	default:
+		panic("unsupported type")
+	}
+
+	return buf.Bytes()
+}
+
+func writeUint(buf *bytes.Buffer, typ int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+
+	writeControl(buf, typ, len(b))
+	buf.Write(b)
+}
+
+func writeControl(buf *bytes.Buffer, typ, size int) {
+	var ctrl byte
+	var ext []byte
+
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+	} else {
+		ctrl = byte(typ << 5)
+	}
+
+	var sizeBytes []byte
+
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		ctrl |= 31
+		size -= 65821
+		sizeBytes = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+
+	buf.WriteByte(ctrl)
+	buf.Write(ext)
+	buf.Write(sizeBytes)
+}
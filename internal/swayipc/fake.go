@@ -0,0 +1,158 @@
+package swayipc
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+)
+
+// Message is a message received by the FakeServer.
+type Message struct {
+	Type    uint32
+	Payload []byte
+}
+
+// FakeServer is a fake sway IPC server for use in tests. It listens on a
+// unix socket and answers requests using the registered handlers. Subscribe
+// requests are always successful.
+//
+//	s, err := swayipc.NewFakeServer(filepath.Join(dir, "sway.sock"))
+//	s.Handle(swayipc.GetInputs, func(payload []byte) []byte {
+//		return []byte(`[]`)
+//	})
+type FakeServer struct {
+	mu       sync.Mutex
+	listener net.Listener
+	handlers map[uint32]func(payload []byte) []byte
+	requests []Message
+	conns    map[*Conn]bool // value is true for subscribed connections
+	wg       sync.WaitGroup
+}
+
+// NewFakeServer creates a new *FakeServer listening on the unix socket at
+// path.
+func NewFakeServer(path string) (*FakeServer, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FakeServer{
+		listener: l,
+		handlers: make(map[uint32]func(payload []byte) []byte),
+		conns:    make(map[*Conn]bool),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Path returns the path of the socket.
+func (s *FakeServer) Path() string {
+	return s.listener.Addr().String()
+}
+
+// Handle registers fn to answer requests of type typ. A successful command
+// result is sent for RunCommand requests without handler.
+func (s *FakeServer) Handle(typ uint32, fn func(payload []byte) []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[typ] = fn
+}
+
+// Requests returns all requests received by the server.
+func (s *FakeServer) Requests() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.requests...)
+}
+
+// SendEvent sends an event to all subscribed clients.
+func (s *FakeServer) SendEvent(typ uint32, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c, subscribed := range s.conns {
+		if subscribed {
+			_ = c.write(typ, payload)
+		}
+	}
+}
+
+// Close stops the server and closes all connections.
+func (s *FakeServer) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *FakeServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &Conn{conn: conn}
+
+		s.mu.Lock()
+		s.conns[c] = false
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConn(c)
+	}
+}
+
+func (s *FakeServer) handleConn(c *Conn) {
+	defer s.wg.Done()
+	defer c.Close()
+
+	for {
+		typ, payload, err := c.read()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Message{Type: typ, Payload: payload})
+		handler, ok := s.handlers[typ]
+		s.mu.Unlock()
+
+		var reply []byte
+
+		switch {
+		case ok:
+			reply = handler(payload)
+		case typ == Subscribe:
+			reply, _ = json.Marshal(map[string]bool{"success": true})
+		case typ == RunCommand:
+			reply, _ = json.Marshal([]map[string]bool{{"success": true}})
+		default:
+			reply = []byte(`null`)
+		}
+
+		s.mu.Lock()
+		err = c.write(typ, reply)
+		if typ == Subscribe {
+			s.conns[c] = true
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
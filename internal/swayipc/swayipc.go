@@ -0,0 +1,230 @@
+// Package swayipc contains a minimal client for the IPC protocol of sway,
+// which is compatible with the i3 IPC protocol. It only implements what is
+// needed by the modules in this repository.
+package swayipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// magic is the prefix of every IPC message.
+const magic = "i3-ipc"
+
+// Message types.
+const (
+	RunCommand uint32 = 0
+	Subscribe  uint32 = 2
+	GetTree    uint32 = 4
+	GetInputs  uint32 = 100
+)
+
+// eventMask is set on the type of messages that are events.
+const eventMask = 1 << 31
+
+// Event types.
+const (
+	WindowEvent uint32 = eventMask | 3
+	InputEvent  uint32 = eventMask | 21
+)
+
+// order is the byte order of message headers. Sway uses the native byte
+// order of the host.
+var order = nativeOrder()
+
+func nativeOrder() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}
+
+// Event is an event received from sway after subscribing to it.
+type Event struct {
+	// Type is the event type, e.g. InputEvent.
+	Type uint32
+
+	// Payload is the JSON encoded event.
+	Payload []byte
+}
+
+// SocketPath returns the path of the IPC socket from the SWAYSOCK or I3SOCK
+// environment variables.
+func SocketPath() (string, error) {
+	for _, name := range []string{"SWAYSOCK", "I3SOCK"} {
+		if path := os.Getenv(name); path != "" {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("swayipc: SWAYSOCK is not set")
+}
+
+// Conn is a connection to the IPC socket of sway.
+type Conn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Dial connects to the IPC socket at path. If path is empty, SocketPath is
+// used.
+func Dial(path string) (*Conn, error) {
+	if path == "" {
+		var err error
+		if path, err = SocketPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Request sends a message of type typ with payload and returns the payload
+// of the reply.
+func (c *Conn) Request(typ uint32, payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(typ, payload); err != nil {
+		return nil, err
+	}
+
+	replyType, reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if replyType != typ {
+		return nil, fmt.Errorf("swayipc: unexpected reply type %d for request %d", replyType, typ)
+	}
+
+	return reply, nil
+}
+
+// Command runs sway commands and returns an error if any of them failed.
+func (c *Conn) Command(command string) error {
+	reply, err := c.Request(RunCommand, []byte(command))
+	if err != nil {
+		return err
+	}
+
+	var results []struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+
+	if err := json.Unmarshal(reply, &results); err != nil {
+		return err
+	}
+
+	var errs []string
+
+	for _, result := range results {
+		if !result.Success {
+			errs = append(errs, result.Error)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("swayipc: command %q failed: %s", command, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to events, e.g. "input". Afterwards the connection
+// only delivers events, so it must not be used for requests anymore. The
+// returned channel is closed when the connection is closed.
+func (c *Conn) Subscribe(events ...string) (<-chan Event, error) {
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.Request(Subscribe, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+
+	if err := json.Unmarshal(reply, &result); err != nil {
+		return nil, err
+	}
+
+	if !result.Success {
+		return nil, fmt.Errorf("swayipc: failed to subscribe to %v", events)
+	}
+
+	ch := make(chan Event, 16)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			typ, payload, err := c.read()
+			if err != nil {
+				return
+			}
+
+			if typ&eventMask == 0 {
+				continue
+			}
+
+			ch <- Event{Type: typ, Payload: payload}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (c *Conn) write(typ uint32, payload []byte) error {
+	msg := make([]byte, len(magic)+8, len(magic)+8+len(payload))
+	copy(msg, magic)
+	order.PutUint32(msg[len(magic):], uint32(len(payload)))
+	order.PutUint32(msg[len(magic)+4:], typ)
+	msg = append(msg, payload...)
+
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *Conn) read() (uint32, []byte, error) {
+	header := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, nil, err
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return 0, nil, errors.New("swayipc: invalid magic")
+	}
+
+	payload := make([]byte, order.Uint32(header[len(magic):]))
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return order.Uint32(header[len(magic)+4:]), payload, nil
+}
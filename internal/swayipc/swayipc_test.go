@@ -0,0 +1,109 @@
+package swayipc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeServer(t *testing.T) *FakeServer {
+	dir, err := ioutil.TempDir("", "swayipc")
+	require.NoError(t, err)
+
+	s, err := NewFakeServer(filepath.Join(dir, "sway.sock"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+
+	return s
+}
+
+func TestConn_Request(t *testing.T) {
+	s := newFakeServer(t)
+
+	s.Handle(GetInputs, func(payload []byte) []byte {
+		return []byte(`[{"identifier":"kbd"}]`)
+	})
+
+	c, err := Dial(s.Path())
+	require.NoError(t, err)
+	defer c.Close()
+
+	reply, err := c.Request(GetInputs, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"identifier":"kbd"}]`, string(reply))
+}
+
+func TestConn_Command(t *testing.T) {
+	s := newFakeServer(t)
+
+	c, err := Dial(s.Path())
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Command("input type:keyboard xkb_switch_layout 1"))
+
+	s.Handle(RunCommand, func(payload []byte) []byte {
+		return []byte(`[{"success":true},{"success":false,"error":"Unknown command"}]`)
+	})
+
+	err = c.Command("foo; bar")
+	require.EqualError(t, err, `swayipc: command "foo; bar" failed: Unknown command`)
+
+	requests := s.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, Message{Type: RunCommand, Payload: []byte("input type:keyboard xkb_switch_layout 1")}, requests[0])
+}
+
+func TestConn_Subscribe(t *testing.T) {
+	s := newFakeServer(t)
+
+	c, err := Dial(s.Path())
+	require.NoError(t, err)
+
+	events, err := c.Subscribe("input")
+	require.NoError(t, err)
+
+	assert.Equal(t, Message{Type: Subscribe, Payload: []byte(`["input"]`)}, s.Requests()[0])
+
+	s.SendEvent(InputEvent, []byte(`{"change":"xkb_layout"}`))
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, Event{Type: InputEvent, Payload: []byte(`{"change":"xkb_layout"}`)}, ev)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+
+	c.Close()
+
+	for range events {
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	for _, name := range []string{"SWAYSOCK", "I3SOCK"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		}
+		os.Unsetenv(name)
+	}
+
+	_, err := SocketPath()
+	require.Error(t, err)
+
+	os.Setenv("I3SOCK", "/run/i3.sock")
+	defer os.Unsetenv("I3SOCK")
+
+	path, err := SocketPath()
+	require.NoError(t, err)
+	assert.Equal(t, "/run/i3.sock", path)
+}
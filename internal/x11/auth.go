@@ -0,0 +1,111 @@
+package x11
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Xauthority address families.
+const (
+	familyInternet  = 0
+	familyInternet6 = 6
+	familyLocal     = 256
+	familyWild      = 65535
+
+	cookieAuthName = "MIT-MAGIC-COOKIE-1"
+)
+
+// readAuth looks up the MIT-MAGIC-COOKIE-1 for the display conn is
+// connected to in the Xauthority file. Returns empty values if there is none.
+func readAuth(conn net.Conn, number string) (string, []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+
+		path = filepath.Join(home, ".Xauthority")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+
+	family, address := authAddress(conn)
+
+	data, err := findCookie(f, family, address, number)
+	if err != nil || data == nil {
+		return "", nil
+	}
+
+	return cookieAuthName, data
+}
+
+// authAddress returns the Xauthority family and address of the X server conn
+// is connected to. Like Xlib, connections to the loopback address are looked
+// up as local connections using the hostname.
+func authAddress(conn net.Conn) (uint16, string) {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		if ip := addr.IP.To4(); ip != nil {
+			return familyInternet, string(ip)
+		}
+
+		return familyInternet6, string(addr.IP.To16())
+	}
+
+	hostname, _ := os.Hostname()
+
+	return familyLocal, hostname
+}
+
+// findCookie parses Xauthority entries from r and returns the cookie for
+// the display with given family, address and number. Returns nil if no
+// matching entry was found.
+func findCookie(r io.Reader, family uint16, address, number string) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	for {
+		var entryFamily uint16
+		if err := binary.Read(br, binary.BigEndian, &entryFamily); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		fields := make([][]byte, 4)
+		for i := range fields {
+			var length uint16
+			if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+				return nil, err
+			}
+
+			fields[i] = make([]byte, length)
+			if _, err := io.ReadFull(br, fields[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		entryAddress, displayNumber, name, data := string(fields[0]), string(fields[1]), string(fields[2]), fields[3]
+
+		if name != cookieAuthName {
+			continue
+		}
+
+		if entryFamily != familyWild && (entryFamily != family || entryAddress != address) {
+			continue
+		}
+
+		if displayNumber != "" && displayNumber != number {
+			continue
+		}
+
+		return data, nil
+	}
+}
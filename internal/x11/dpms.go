@@ -0,0 +1,172 @@
+package x11
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DPMSExtension is the name of the DPMS extension.
+const DPMSExtension = "DPMS"
+
+// DPMS power levels.
+const (
+	DPMSModeOn      uint16 = 0
+	DPMSModeStandby uint16 = 1
+	DPMSModeSuspend uint16 = 2
+	DPMSModeOff     uint16 = 3
+)
+
+// DPMS minor opcodes.
+const (
+	dpmsGetVersion  = 0
+	dpmsGetTimeouts = 2
+	dpmsSetTimeouts = 3
+	dpmsEnable      = 4
+	dpmsDisable     = 5
+	dpmsForceLevel  = 6
+	dpmsInfo        = 7
+	dpmsSelectInput = 8
+)
+
+// dpmsInfoNotifyMask selects DPMSInfoNotify events.
+const dpmsInfoNotifyMask = 1
+
+// DPMSInfo contains the current DPMS state.
+type DPMSInfo struct {
+	// PowerLevel is the current power level of the monitor, one of the
+	// DPMSMode* constants.
+	PowerLevel uint16
+
+	// Enabled is true if DPMS is enabled.
+	Enabled bool
+}
+
+// DPMSTimeouts contains the DPMS timeouts. A zero timeout disables the
+// respective mode.
+type DPMSTimeouts struct {
+	Standby time.Duration
+	Suspend time.Duration
+	Off     time.Duration
+}
+
+func (c *Conn) dpmsRequest(minor byte, body []byte) ([]byte, error) {
+	ext, err := c.QueryExtension(DPMSExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Request(ext.MajorOpcode, minor, body)
+}
+
+func (c *Conn) dpmsRequestChecked(minor byte, body []byte) error {
+	ext, err := c.QueryExtension(DPMSExtension)
+	if err != nil {
+		return err
+	}
+
+	return c.RequestChecked(ext.MajorOpcode, minor, body)
+}
+
+// DPMSVersion returns the version of the DPMS extension supported by the X
+// server.
+func (c *Conn) DPMSVersion() (major, minor uint16, err error) {
+	body := make([]byte, 4)
+	order.PutUint16(body, 1)
+	order.PutUint16(body[2:], 2)
+
+	reply, err := c.dpmsRequest(dpmsGetVersion, body)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return order.Uint16(reply[8:]), order.Uint16(reply[10:]), nil
+}
+
+// DPMSInfo retrieves the current DPMS state.
+func (c *Conn) DPMSInfo() (DPMSInfo, error) {
+	reply, err := c.dpmsRequest(dpmsInfo, nil)
+	if err != nil {
+		return DPMSInfo{}, err
+	}
+
+	info := DPMSInfo{
+		PowerLevel: order.Uint16(reply[8:]),
+		Enabled:    reply[10] != 0,
+	}
+
+	return info, nil
+}
+
+// DPMSEnable enables DPMS.
+func (c *Conn) DPMSEnable() error {
+	return c.dpmsRequestChecked(dpmsEnable, nil)
+}
+
+// DPMSDisable disables DPMS.
+func (c *Conn) DPMSDisable() error {
+	return c.dpmsRequestChecked(dpmsDisable, nil)
+}
+
+// DPMSForceLevel forces the monitor into given power level immediately.
+func (c *Conn) DPMSForceLevel(level uint16) error {
+	body := make([]byte, 4)
+	order.PutUint16(body, level)
+
+	return c.dpmsRequestChecked(dpmsForceLevel, body)
+}
+
+// DPMSGetTimeouts retrieves the DPMS timeouts.
+func (c *Conn) DPMSGetTimeouts() (DPMSTimeouts, error) {
+	reply, err := c.dpmsRequest(dpmsGetTimeouts, nil)
+	if err != nil {
+		return DPMSTimeouts{}, err
+	}
+
+	timeouts := DPMSTimeouts{
+		Standby: time.Duration(order.Uint16(reply[8:])) * time.Second,
+		Suspend: time.Duration(order.Uint16(reply[10:])) * time.Second,
+		Off:     time.Duration(order.Uint16(reply[12:])) * time.Second,
+	}
+
+	return timeouts, nil
+}
+
+// DPMSSetTimeouts sets the DPMS timeouts. Timeouts are truncated to seconds.
+// The X server rejects timeouts that are not in ascending order unless they
+// are zero. An error is returned for negative timeouts and timeouts longer
+// than 65535 seconds, which the protocol cannot represent.
+func (c *Conn) DPMSSetTimeouts(timeouts DPMSTimeouts) error {
+	body := make([]byte, 8)
+
+	for i, timeout := range []time.Duration{timeouts.Standby, timeouts.Suspend, timeouts.Off} {
+		seconds := timeout / time.Second
+		if seconds < 0 || seconds > math.MaxUint16 {
+			return fmt.Errorf("x11: DPMS timeout %s is out of range", timeout)
+		}
+
+		order.PutUint16(body[2*i:], uint16(seconds))
+	}
+
+	return c.dpmsRequestChecked(dpmsSetTimeouts, body)
+}
+
+// DPMSSelectInput subscribes to DPMSInfoNotify events which are sent
+// whenever the DPMS state or power level changes. Requires DPMS extension
+// version 1.2 or newer.
+func (c *Conn) DPMSSelectInput() error {
+	body := make([]byte, 4)
+	order.PutUint32(body, dpmsInfoNotifyMask)
+
+	return c.dpmsRequestChecked(dpmsSelectInput, body)
+}
+
+// IsDPMSInfoNotify returns true if ev is a DPMSInfoNotify event.
+func (c *Conn) IsDPMSInfoNotify(ev []byte) bool {
+	c.mu.Lock()
+	ext, ok := c.extensions[DPMSExtension]
+	c.mu.Unlock()
+
+	// DPMSInfoNotify is a generic event with event type 0.
+	return ok && len(ev) >= 10 && ev[0]&0x7f == 35 && ev[1] == ext.MajorOpcode && order.Uint16(ev[8:]) == 0
+}
@@ -0,0 +1,134 @@
+package x11
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDPMS emulates the DPMS extension of the fake X server.
+type fakeDPMS struct {
+	enabled  bool
+	level    uint16
+	timeouts [3]uint16
+	selected uint32
+}
+
+func newFakeDPMSServer(t *testing.T) (*fakeServer, *fakeDPMS, *Conn) {
+	s, c := newFakeServer(t)
+
+	s.addExtension(DPMSExtension, Extension{MajorOpcode: 147})
+
+	dpms := &fakeDPMS{enabled: true, timeouts: [3]uint16{600, 600, 600}}
+
+	s.handle(147, func(req request) response {
+		reply := make([]byte, 32)
+
+		switch req.data {
+		case dpmsGetVersion:
+			binary.LittleEndian.PutUint16(reply[8:], 1)
+			binary.LittleEndian.PutUint16(reply[10:], 2)
+		case dpmsGetTimeouts:
+			for i, timeout := range dpms.timeouts {
+				binary.LittleEndian.PutUint16(reply[8+i*2:], timeout)
+			}
+		case dpmsSetTimeouts:
+			for i := range dpms.timeouts {
+				dpms.timeouts[i] = binary.LittleEndian.Uint16(req.body[i*2:])
+			}
+			return response{}
+		case dpmsEnable:
+			dpms.enabled = true
+			return response{}
+		case dpmsDisable:
+			dpms.enabled = false
+			return response{}
+		case dpmsForceLevel:
+			level := binary.LittleEndian.Uint16(req.body)
+			if level > DPMSModeOff {
+				return response{errCode: 2}
+			}
+			dpms.level = level
+			return response{}
+		case dpmsInfo:
+			binary.LittleEndian.PutUint16(reply[8:], dpms.level)
+			if dpms.enabled {
+				reply[10] = 1
+			}
+		case dpmsSelectInput:
+			dpms.selected = binary.LittleEndian.Uint32(req.body)
+			return response{}
+		default:
+			return response{errCode: 1}
+		}
+
+		return response{reply: reply}
+	})
+
+	return s, dpms, c
+}
+
+func TestDPMS(t *testing.T) {
+	_, dpms, c := newFakeDPMSServer(t)
+
+	major, minor, err := c.DPMSVersion()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1), major)
+	assert.Equal(t, uint16(2), minor)
+
+	info, err := c.DPMSInfo()
+	require.NoError(t, err)
+	assert.Equal(t, DPMSInfo{Enabled: true, PowerLevel: DPMSModeOn}, info)
+
+	require.NoError(t, c.DPMSDisable())
+	assert.False(t, dpms.enabled)
+
+	require.NoError(t, c.DPMSEnable())
+	assert.True(t, dpms.enabled)
+
+	require.NoError(t, c.DPMSForceLevel(DPMSModeOff))
+
+	info, err = c.DPMSInfo()
+	require.NoError(t, err)
+	assert.Equal(t, DPMSInfo{Enabled: true, PowerLevel: DPMSModeOff}, info)
+
+	require.Error(t, c.DPMSForceLevel(42))
+
+	timeouts, err := c.DPMSGetTimeouts()
+	require.NoError(t, err)
+	assert.Equal(t, DPMSTimeouts{Standby: 10 * time.Minute, Suspend: 10 * time.Minute, Off: 10 * time.Minute}, timeouts)
+
+	timeouts = DPMSTimeouts{Standby: time.Minute, Suspend: 2 * time.Minute, Off: 3 * time.Minute}
+	require.NoError(t, c.DPMSSetTimeouts(timeouts))
+	assert.Equal(t, [3]uint16{60, 120, 180}, dpms.timeouts)
+
+	timeouts = DPMSTimeouts{Standby: time.Minute, Suspend: 2 * time.Minute, Off: 20 * time.Hour}
+	require.EqualError(t, c.DPMSSetTimeouts(timeouts), "x11: DPMS timeout 20h0m0s is out of range")
+	assert.Equal(t, [3]uint16{60, 120, 180}, dpms.timeouts, "timeouts are not truncated")
+
+	require.NoError(t, c.DPMSSelectInput())
+	assert.Equal(t, uint32(1), dpms.selected)
+}
+
+func TestIsDPMSInfoNotify(t *testing.T) {
+	s, _, c := newFakeDPMSServer(t)
+
+	require.NoError(t, c.DPMSSelectInput())
+
+	ev := make([]byte, 32)
+	ev[0] = 35
+	ev[1] = 147
+	s.sendEvent(ev)
+
+	assert.True(t, c.IsDPMSInfoNotify(<-c.Events()))
+
+	ev = make([]byte, 32)
+	ev[0] = 35
+	ev[1] = 148
+	s.sendEvent(ev)
+
+	assert.False(t, c.IsDPMSInfoNotify(<-c.Events()))
+}
@@ -0,0 +1,169 @@
+package x11
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Core opcodes used for properties.
+const (
+	opChangeWindowAttributes = 2
+	opInternAtom             = 16
+	opGetProperty            = 20
+)
+
+// propertyNotify is the code of the core PropertyNotify event.
+const propertyNotify = 28
+
+const (
+	cwEventMask        = 1 << 11
+	propertyChangeMask = 1 << 22
+)
+
+// AnyPropertyType can be passed to GetProperty to match properties of any
+// type.
+const AnyPropertyType = 0
+
+// Property is the value of a window property.
+type Property struct {
+	// Type is the atom of the property type.
+	Type uint32
+
+	// Format is the format of the property value, i.e. 8, 16 or 32 bits per
+	// item.
+	Format byte
+
+	// Value is the raw property value.
+	Value []byte
+}
+
+// Uint32s returns the property value as a list of 32 bit values, e.g. atoms
+// or window ids. Returns nil if the property format is not 32.
+func (p Property) Uint32s() []uint32 {
+	if p.Format != 32 {
+		return nil
+	}
+
+	values := make([]uint32, len(p.Value)/4)
+	for i := range values {
+		values[i] = order.Uint32(p.Value[i*4:])
+	}
+
+	return values
+}
+
+// Strings returns the property value as a list of null-terminated strings,
+// e.g. for WM_CLASS. Returns nil if the property format is not 8.
+func (p Property) Strings() []string {
+	if p.Format != 8 {
+		return nil
+	}
+
+	value := bytes.TrimSuffix(p.Value, []byte{0})
+	if len(value) == 0 {
+		return nil
+	}
+
+	parts := bytes.Split(value, []byte{0})
+
+	strs := make([]string, len(parts))
+	for i, part := range parts {
+		strs[i] = string(part)
+	}
+
+	return strs
+}
+
+// Atom returns the atom for name, creating it if it does not exist yet.
+// Atoms are cached for the lifetime of the connection.
+func (c *Conn) Atom(name string) (uint32, error) {
+	c.mu.Lock()
+	atom, ok := c.atoms[name]
+	c.mu.Unlock()
+
+	if ok {
+		return atom, nil
+	}
+
+	body := make([]byte, 4, 4+pad(len(name)))
+	order.PutUint16(body, uint16(len(name)))
+	body = append(body, name...)
+
+	reply, err := c.Request(opInternAtom, 0, body)
+	if err != nil {
+		return 0, err
+	}
+
+	atom = order.Uint32(reply[8:])
+	if atom == 0 {
+		return 0, fmt.Errorf("x11: failed to intern atom %s", name)
+	}
+
+	c.mu.Lock()
+	c.atoms[name] = atom
+	c.mu.Unlock()
+
+	return atom, nil
+}
+
+// GetProperty retrieves the property with given name of window. A property
+// with a zero Type is returned if the window does not have the property.
+func (c *Conn) GetProperty(window uint32, name string) (Property, error) {
+	property, err := c.Atom(name)
+	if err != nil {
+		return Property{}, err
+	}
+
+	body := make([]byte, 20)
+	order.PutUint32(body, window)
+	order.PutUint32(body[4:], property)
+	order.PutUint32(body[8:], AnyPropertyType)
+	order.PutUint32(body[12:], 0)
+	order.PutUint32(body[16:], 1<<16) // maximum length in 4 byte units
+
+	reply, err := c.Request(opGetProperty, 0, body)
+	if err != nil {
+		return Property{}, err
+	}
+
+	p := Property{
+		Type:   order.Uint32(reply[8:]),
+		Format: reply[1],
+	}
+
+	n := int(order.Uint32(reply[16:])) * int(p.Format) / 8
+	if n > len(reply)-32 {
+		return Property{}, fmt.Errorf("x11: invalid length %d for property %s", n, name)
+	}
+
+	p.Value = reply[32 : 32+n]
+
+	return p, nil
+}
+
+// SelectPropertyChanges subscribes to PropertyNotify events which are sent
+// whenever a property of window changes. This replaces all other events
+// selected by the connection for window.
+func (c *Conn) SelectPropertyChanges(window uint32) error {
+	body := make([]byte, 12)
+	order.PutUint32(body, window)
+	order.PutUint32(body[4:], cwEventMask)
+	order.PutUint32(body[8:], propertyChangeMask)
+
+	return c.RequestChecked(opChangeWindowAttributes, 0, body)
+}
+
+// IsPropertyNotify returns true if ev is a PropertyNotify event for the
+// property with given name of window. The atom for name must have been
+// retrieved via Atom or GetProperty before, otherwise false is returned.
+func (c *Conn) IsPropertyNotify(ev []byte, window uint32, name string) bool {
+	c.mu.Lock()
+	atom, ok := c.atoms[name]
+	c.mu.Unlock()
+
+	if !ok || len(ev) < 32 || ev[0]&0x7f != propertyNotify {
+		return false
+	}
+
+	return order.Uint32(ev[4:]) == window && order.Uint32(ev[8:]) == atom
+}
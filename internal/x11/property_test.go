@@ -0,0 +1,170 @@
+package x11
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type propertyKey struct {
+	window uint32
+	atom   uint32
+}
+
+// handleProperties installs InternAtom and GetProperty handlers on the fake
+// server which serve the provided properties. Atoms are allocated on demand.
+func handleProperties(s *fakeServer, properties map[uint32]map[string]Property) {
+	atoms := make(map[string]uint32)
+	values := make(map[propertyKey]Property)
+
+	atom := func(name string) uint32 {
+		if _, ok := atoms[name]; !ok {
+			atoms[name] = uint32(len(atoms) + 1)
+		}
+		return atoms[name]
+	}
+
+	for window, props := range properties {
+		for name, prop := range props {
+			values[propertyKey{window, atom(name)}] = prop
+		}
+	}
+
+	s.handle(opInternAtom, func(req request) response {
+		n := binary.LittleEndian.Uint16(req.body)
+		reply := make([]byte, 32)
+		binary.LittleEndian.PutUint32(reply[8:], atom(string(req.body[4:4+n])))
+		return response{reply: reply}
+	})
+
+	s.handle(opGetProperty, func(req request) response {
+		key := propertyKey{
+			window: binary.LittleEndian.Uint32(req.body),
+			atom:   binary.LittleEndian.Uint32(req.body[4:]),
+		}
+
+		prop := values[key]
+
+		reply := make([]byte, 32, 32+pad(len(prop.Value)))
+		reply[1] = prop.Format
+		binary.LittleEndian.PutUint32(reply[8:], prop.Type)
+		if prop.Format != 0 {
+			binary.LittleEndian.PutUint32(reply[16:], uint32(len(prop.Value)*8/int(prop.Format)))
+		}
+		reply = append(reply, padded(prop.Value)...)
+
+		return response{reply: reply}
+	})
+}
+
+func uint32Property(values ...uint32) Property {
+	value := make([]byte, len(values)*4)
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(value[i*4:], v)
+	}
+
+	return Property{Type: 33, Format: 32, Value: value}
+}
+
+func TestGetProperty(t *testing.T) {
+	s, c := newFakeServer(t)
+
+	handleProperties(s, map[uint32]map[string]Property{
+		c.Root(): {
+			"_NET_ACTIVE_WINDOW": uint32Property(0x400001),
+		},
+		0x400001: {
+			"WM_CLASS": {Type: 31, Format: 8, Value: []byte("mpv\x00mpv-Class\x00")},
+		},
+	})
+
+	prop, err := c.GetProperty(c.Root(), "_NET_ACTIVE_WINDOW")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0x400001}, prop.Uint32s())
+	assert.Nil(t, prop.Strings())
+
+	prop, err = c.GetProperty(0x400001, "WM_CLASS")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mpv", "mpv-Class"}, prop.Strings())
+	assert.Nil(t, prop.Uint32s())
+
+	prop, err = c.GetProperty(0x400001, "_NET_WM_STATE")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), prop.Type)
+	assert.Empty(t, prop.Value)
+}
+
+func TestAtom(t *testing.T) {
+	s, c := newFakeServer(t)
+
+	handleProperties(s, nil)
+
+	foo, err := c.Atom("FOO")
+	require.NoError(t, err)
+
+	bar, err := c.Atom("BAR")
+	require.NoError(t, err)
+	assert.NotEqual(t, foo, bar)
+
+	atom, err := c.Atom("FOO")
+	require.NoError(t, err)
+	assert.Equal(t, foo, atom)
+
+	s.Lock()
+	defer s.Unlock()
+	assert.Len(t, s.requests, 2, "atoms are cached")
+}
+
+func TestSelectPropertyChanges(t *testing.T) {
+	s, c := newFakeServer(t)
+
+	handleProperties(s, nil)
+
+	var selected []byte
+
+	s.handle(opChangeWindowAttributes, func(req request) response {
+		s.Lock()
+		defer s.Unlock()
+		selected = req.body
+		return response{}
+	})
+
+	require.NoError(t, c.SelectPropertyChanges(c.Root()))
+
+	s.Lock()
+	assert.Equal(t, []byte{0xab, 0x01, 0, 0, 0, 0x08, 0, 0, 0, 0, 0x40, 0}, selected)
+	s.Unlock()
+
+	atom, err := c.Atom("_NET_ACTIVE_WINDOW")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		window   uint32
+		atom     uint32
+		code     byte
+		expected bool
+	}{
+		{name: "active window changed", window: c.Root(), atom: atom, code: propertyNotify, expected: true},
+		{name: "sent event", window: c.Root(), atom: atom, code: propertyNotify | 0x80, expected: true},
+		{name: "other window", window: 0x400001, atom: atom, code: propertyNotify},
+		{name: "other property", window: c.Root(), atom: atom + 1, code: propertyNotify},
+		{name: "other event", window: c.Root(), atom: atom, code: 22},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ev := make([]byte, 32)
+			ev[0] = test.code
+			binary.LittleEndian.PutUint32(ev[4:], test.window)
+			binary.LittleEndian.PutUint32(ev[8:], test.atom)
+			s.sendEvent(ev)
+
+			assert.Equal(t, test.expected, c.IsPropertyNotify(<-c.Events(), c.Root(), "_NET_ACTIVE_WINDOW"))
+		})
+	}
+
+	assert.False(t, c.IsPropertyNotify(make([]byte, 32), c.Root(), "UNKNOWN"))
+}
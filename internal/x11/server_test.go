@@ -0,0 +1,189 @@
+package x11
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// request is a request received by the fake X server.
+type request struct {
+	seq    uint16
+	opcode byte
+	data   byte
+	body   []byte
+}
+
+// response is returned by request handlers of the fake X server. If errCode
+// is non-zero an error is sent, otherwise reply is sent if it is non-nil.
+type response struct {
+	reply   []byte
+	errCode byte
+}
+
+// fakeServer is a minimal fake X server which speaks just enough of the
+// protocol to test the client.
+type fakeServer struct {
+	sync.Mutex
+	t          *testing.T
+	conn       net.Conn
+	root       uint32
+	extensions map[string]Extension
+	handlers   map[byte]func(req request) response
+	requests   []request
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *Conn) {
+	client, server := net.Pipe()
+
+	s := &fakeServer{
+		t:          t,
+		conn:       server,
+		root:       0x1ab,
+		extensions: make(map[string]Extension),
+		handlers:   make(map[byte]func(req request) response),
+	}
+
+	s.handle(43, func(req request) response {
+		return response{reply: make([]byte, 32)}
+	})
+
+	s.handle(98, func(req request) response {
+		reply := make([]byte, 32)
+		n := binary.LittleEndian.Uint16(req.body)
+
+		s.Lock()
+		ext, ok := s.extensions[string(req.body[4:4+n])]
+		s.Unlock()
+
+		if ok {
+			reply[8] = 1
+			reply[9] = ext.MajorOpcode
+			reply[10] = ext.FirstEvent
+			reply[11] = ext.FirstError
+		}
+
+		return response{reply: reply}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve()
+	}()
+
+	c, err := NewConn(client, "MIT-MAGIC-COOKIE-1", []byte("secret"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+
+	return s, c
+}
+
+func (s *fakeServer) handle(opcode byte, fn func(req request) response) {
+	s.Lock()
+	defer s.Unlock()
+	s.handlers[opcode] = fn
+}
+
+func (s *fakeServer) addExtension(name string, ext Extension) {
+	s.Lock()
+	defer s.Unlock()
+	s.extensions[name] = ext
+}
+
+// sendEvent sends a 32 byte event, or a generic event if extra data is
+// provided.
+func (s *fakeServer) sendEvent(ev []byte) {
+	_, err := s.conn.Write(ev)
+	require.NoError(s.t, err)
+}
+
+func (s *fakeServer) serve() {
+	setup := make([]byte, 12)
+	if _, err := io.ReadFull(s.conn, setup); err != nil {
+		return
+	}
+
+	authLen := pad(int(binary.LittleEndian.Uint16(setup[6:]))) + pad(int(binary.LittleEndian.Uint16(setup[8:])))
+	if _, err := io.ReadFull(s.conn, make([]byte, authLen)); err != nil {
+		return
+	}
+
+	vendor := padded([]byte("fake"))
+	data := make([]byte, 32, 32+len(vendor)+8+40)
+	binary.LittleEndian.PutUint16(data[16:], 4)
+	data[20] = 1 // number of screens
+	data[21] = 1 // number of pixmap formats
+	data = append(data, vendor...)
+	data = append(data, make([]byte, 8)...)
+	screen := make([]byte, 40)
+	binary.LittleEndian.PutUint32(screen, s.root)
+	data = append(data, screen...)
+
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.LittleEndian.PutUint16(header[2:], 11)
+	binary.LittleEndian.PutUint16(header[6:], uint16(len(data)/4))
+
+	if _, err := s.conn.Write(append(header, data...)); err != nil {
+		return
+	}
+
+	var seq uint16
+
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			return
+		}
+
+		body := make([]byte, int(binary.LittleEndian.Uint16(header[2:]))*4-4)
+		if _, err := io.ReadFull(s.conn, body); err != nil {
+			return
+		}
+
+		seq++
+
+		req := request{seq: seq, opcode: header[0], data: header[1], body: body}
+
+		s.Lock()
+		s.requests = append(s.requests, req)
+		handler, ok := s.handlers[req.opcode]
+		s.Unlock()
+
+		resp := response{errCode: 1}
+		if ok {
+			resp = handler(req)
+		}
+
+		var out []byte
+
+		switch {
+		case resp.errCode != 0:
+			out = make([]byte, 32)
+			out[1] = resp.errCode
+			out[10] = req.opcode
+			binary.LittleEndian.PutUint16(out[8:], uint16(req.data))
+		case resp.reply != nil:
+			out = resp.reply
+			out[0] = 1
+			binary.LittleEndian.PutUint32(out[4:], uint32((len(out)-32)/4))
+		default:
+			continue
+		}
+
+		binary.LittleEndian.PutUint16(out[2:], seq)
+
+		if _, err := s.conn.Write(out); err != nil {
+			return
+		}
+	}
+}
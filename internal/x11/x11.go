@@ -0,0 +1,422 @@
+// Package x11 contains a minimal client for the X11 protocol. It only
+// implements what is needed by the modules in this repository, i.e.
+// connection setup, a handful of core requests and the extensions used by
+// them. All requests are sent in little endian byte order.
+//
+// It is used instead of github.com/jezek/xgb because xgb does not have
+// bindings for the XKB extension, which the keyboard module needs, and
+// mixing two X clients for the DPMS and keyboard modules is worse than
+// maintaining the few requests implemented here.
+package x11
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned for requests on a closed connection.
+var ErrClosed = errors.New("x11: connection closed")
+
+// order is the byte order used for all requests and replies.
+var order = binary.LittleEndian
+
+// Error is an error reported by the X server.
+type Error struct {
+	// Code is the error code.
+	Code byte
+
+	// BadValue is the offending value, e.g. a resource id.
+	BadValue uint32
+
+	// MajorOpcode and MinorOpcode identify the failed request.
+	MajorOpcode byte
+	MinorOpcode uint16
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("x11: error %d for request %d.%d (bad value %d)", e.Code, e.MajorOpcode, e.MinorOpcode, e.BadValue)
+}
+
+// Extension contains information about an X extension.
+type Extension struct {
+	// MajorOpcode is the major opcode for requests of the extension.
+	MajorOpcode byte
+
+	// FirstEvent is the first event code of the extension.
+	FirstEvent byte
+
+	// FirstError is the first error code of the extension.
+	FirstError byte
+}
+
+type packet struct {
+	data []byte
+	err  error
+}
+
+// Conn is a connection to an X server.
+type Conn struct {
+	conn net.Conn
+	root uint32
+
+	mu         sync.Mutex
+	seq        uint16
+	pending    map[uint16]chan packet
+	extensions map[string]Extension
+	atoms      map[string]uint32
+	err        error
+
+	events chan []byte
+}
+
+// Dial connects to the X server of display. If display is empty, the
+// DISPLAY environment variable is used. Authorization data is read from the
+// file referenced by the XAUTHORITY environment variable or ~/.Xauthority.
+func Dial(display string) (*Conn, error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+
+	host, number, err := parseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if host == "" || host == "unix" {
+		conn, err = net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	} else {
+		port, _ := strconv.Atoi(number)
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+port)))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	authName, authData := readAuth(conn, number)
+
+	c, err := NewConn(conn, authName, authData)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// parseDisplay parses a display string of the form [host]:number[.screen].
+func parseDisplay(display string) (host, number string, err error) {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("x11: invalid display %q", display)
+	}
+
+	host, number = display[:i], display[i+1:]
+
+	if j := strings.Index(number, "."); j >= 0 {
+		number = number[:j]
+	}
+
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", fmt.Errorf("x11: invalid display %q", display)
+	}
+
+	return host, number, nil
+}
+
+// NewConn performs the connection setup on conn using the provided
+// authorization protocol name and data, which may both be empty. Returns a
+// *Conn if the X server accepted the connection.
+func NewConn(conn net.Conn, authName string, authData []byte) (*Conn, error) {
+	req := make([]byte, 12, 12+pad(len(authName))+pad(len(authData)))
+	req[0] = 'l'
+	order.PutUint16(req[2:], 11)
+	order.PutUint16(req[4:], 0)
+	order.PutUint16(req[6:], uint16(len(authName)))
+	order.PutUint16(req[8:], uint16(len(authData)))
+	req = append(req, padded([]byte(authName))...)
+	req = append(req, padded(authData)...)
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, int(order.Uint16(header[6:]))*4)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+
+	switch header[0] {
+	case 0:
+		reasonLen := int(header[1])
+		if reasonLen > len(data) {
+			reasonLen = len(data)
+		}
+		return nil, fmt.Errorf("x11: connection refused: %s", data[:reasonLen])
+	case 2:
+		return nil, errors.New("x11: further authentication required")
+	}
+
+	root, err := parseSetup(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		conn:       conn,
+		root:       root,
+		pending:    make(map[uint16]chan packet),
+		extensions: make(map[string]Extension),
+		atoms:      make(map[string]uint32),
+		events:     make(chan []byte, 64),
+	}
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+// parseSetup extracts the root window of the first screen from the
+// additional data of a successful connection setup reply.
+func parseSetup(data []byte) (uint32, error) {
+	if len(data) < 32 {
+		return 0, errors.New("x11: malformed setup reply")
+	}
+
+	vendorLen := int(order.Uint16(data[16:]))
+	numScreens := data[20]
+	numFormats := int(data[21])
+
+	offset := 32 + pad(vendorLen) + numFormats*8
+	if numScreens == 0 || len(data) < offset+4 {
+		return 0, errors.New("x11: no screens in setup reply")
+	}
+
+	return order.Uint32(data[offset:]), nil
+}
+
+// Root returns the root window of the first screen.
+func (c *Conn) Root() uint32 {
+	return c.root
+}
+
+// Events returns a channel on which all events sent by the X server are
+// delivered. Events are dropped if the channel is not drained. The channel
+// is closed when the connection is closed.
+func (c *Conn) Events() <-chan []byte {
+	return c.events
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) readLoop() {
+	var err error
+
+	for {
+		buf := make([]byte, 32)
+		if _, err = io.ReadFull(c.conn, buf); err != nil {
+			break
+		}
+
+		// Replies and generic events may carry additional data.
+		if buf[0] == 1 || buf[0]&0x7f == 35 {
+			extra := make([]byte, int(order.Uint32(buf[4:]))*4)
+			if _, err = io.ReadFull(c.conn, extra); err != nil {
+				break
+			}
+			buf = append(buf, extra...)
+		}
+
+		switch buf[0] {
+		case 0:
+			c.deliver(order.Uint16(buf[2:]), packet{err: &Error{
+				Code:        buf[1],
+				BadValue:    order.Uint32(buf[4:]),
+				MinorOpcode: order.Uint16(buf[8:]),
+				MajorOpcode: buf[10],
+			}})
+		case 1:
+			c.deliver(order.Uint16(buf[2:]), packet{data: buf})
+		default:
+			select {
+			case c.events <- buf:
+			default:
+			}
+		}
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrClosed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = err
+	for seq, ch := range c.pending {
+		ch <- packet{err: err}
+		delete(c.pending, seq)
+	}
+
+	close(c.events)
+}
+
+func (c *Conn) deliver(seq uint16, p packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.pending[seq]
+	if !ok {
+		return
+	}
+
+	delete(c.pending, seq)
+	ch <- p
+}
+
+// send writes a request and returns its sequence number. If wait is true, a
+// channel is registered on which the reply or error will be delivered.
+func (c *Conn) send(opcode, data byte, body []byte, wait bool) (uint16, chan packet, error) {
+	req := make([]byte, 4, 4+pad(len(body)))
+	req[0] = opcode
+	req[1] = data
+	req = append(req, padded(body)...)
+	order.PutUint16(req[2:], uint16(len(req)/4))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+
+	c.seq++
+
+	var ch chan packet
+	if wait {
+		ch = make(chan packet, 1)
+		c.pending[c.seq] = ch
+	}
+
+	if _, err := c.conn.Write(req); err != nil {
+		delete(c.pending, c.seq)
+		return 0, nil, err
+	}
+
+	return c.seq, ch, nil
+}
+
+// Request sends a request that has a reply and waits for it. The request
+// length is filled in automatically and body is padded to a multiple of 4
+// bytes. The returned reply includes the 32 byte reply header.
+func (c *Conn) Request(opcode, data byte, body []byte) ([]byte, error) {
+	_, ch, err := c.send(opcode, data, body, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p := <-ch
+	return p.data, p.err
+}
+
+// Send sends a request that has no reply without waiting for the X server to
+// process it. Errors reported by the X server are discarded.
+func (c *Conn) Send(opcode, data byte, body []byte) error {
+	_, _, err := c.send(opcode, data, body, false)
+	return err
+}
+
+// RequestChecked sends a request that has no reply and waits until the X
+// server processed it. Returns the error reported by the X server, if any.
+func (c *Conn) RequestChecked(opcode, data byte, body []byte) error {
+	seq, ch, err := c.send(opcode, data, body, true)
+	if err != nil {
+		return err
+	}
+
+	// Requests are processed in order, so once the reply for the sync
+	// request arrived, an error for the checked request must have been
+	// received as well.
+	syncErr := c.Sync()
+
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+
+	select {
+	case p := <-ch:
+		return p.err
+	default:
+		return syncErr
+	}
+}
+
+// Sync performs a round trip to the X server using GetInputFocus.
+func (c *Conn) Sync() error {
+	_, err := c.Request(43, 0, nil)
+	return err
+}
+
+// QueryExtension queries information about the named extension. Returns an
+// error if the extension is not present.
+func (c *Conn) QueryExtension(name string) (Extension, error) {
+	c.mu.Lock()
+	ext, ok := c.extensions[name]
+	c.mu.Unlock()
+
+	if ok {
+		return ext, nil
+	}
+
+	body := make([]byte, 4, 4+pad(len(name)))
+	order.PutUint16(body, uint16(len(name)))
+	body = append(body, name...)
+
+	reply, err := c.Request(98, 0, body)
+	if err != nil {
+		return Extension{}, err
+	}
+
+	if reply[8] == 0 {
+		return Extension{}, fmt.Errorf("x11: extension %s not present", name)
+	}
+
+	ext = Extension{
+		MajorOpcode: reply[9],
+		FirstEvent:  reply[10],
+		FirstError:  reply[11],
+	}
+
+	c.mu.Lock()
+	c.extensions[name] = ext
+	c.mu.Unlock()
+
+	return ext, nil
+}
+
+// pad rounds n up to a multiple of 4.
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// padded returns b padded with zero bytes to a multiple of 4 bytes.
+func padded(b []byte) []byte {
+	return append(b[:len(b):len(b)], make([]byte, pad(len(b))-len(b))...)
+}
@@ -0,0 +1,189 @@
+package x11
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn(t *testing.T) {
+	s, c := newFakeServer(t)
+
+	assert.Equal(t, uint32(0x1ab), c.Root())
+
+	s.handle(1, func(req request) response {
+		return response{}
+	})
+
+	s.handle(2, func(req request) response {
+		return response{errCode: 3}
+	})
+
+	s.handle(3, func(req request) response {
+		reply := make([]byte, 40)
+		copy(reply[32:], req.body)
+		return response{reply: reply}
+	})
+
+	require.NoError(t, c.RequestChecked(1, 0, []byte{1, 2, 3}))
+
+	err := c.RequestChecked(2, 7, nil)
+	require.Error(t, err)
+	assert.Equal(t, &Error{Code: 3, MajorOpcode: 2, MinorOpcode: 7}, err)
+
+	reply, err := c.Request(3, 0, []byte("foobar"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foobar\x00\x00"), reply[32:])
+
+	require.NoError(t, c.Send(2, 0, nil))
+	require.NoError(t, c.Sync())
+
+	s.Lock()
+	requests := s.requests
+	s.Unlock()
+
+	require.Len(t, requests, 7)
+	assert.Equal(t, []byte{1, 2, 3, 0}, requests[0].body)
+	assert.Equal(t, byte(43), requests[1].opcode)
+
+	ev := make([]byte, 32)
+	ev[0] = 22
+	s.sendEvent(ev)
+	assert.Equal(t, ev, <-c.Events())
+
+	c.Close()
+
+	_, err = c.Request(3, 0, nil)
+	require.Error(t, err)
+}
+
+func TestQueryExtension(t *testing.T) {
+	s, c := newFakeServer(t)
+
+	s.addExtension("FOO", Extension{MajorOpcode: 130, FirstEvent: 90, FirstError: 150})
+
+	ext, err := c.QueryExtension("FOO")
+	require.NoError(t, err)
+	assert.Equal(t, Extension{MajorOpcode: 130, FirstEvent: 90, FirstError: 150}, ext)
+
+	_, err = c.QueryExtension("FOO")
+	require.NoError(t, err)
+
+	_, err = c.QueryExtension("BAR")
+	require.Error(t, err)
+
+	s.Lock()
+	defer s.Unlock()
+	assert.Len(t, s.requests, 2, "extension info is cached")
+}
+
+func TestParseDisplay(t *testing.T) {
+	tests := []struct {
+		display        string
+		host, number   string
+		expectedErrMsg string
+	}{
+		{display: ":0", number: "0"},
+		{display: ":1.0", number: "1"},
+		{display: "unix:2", host: "unix", number: "2"},
+		{display: "localhost:10.0", host: "localhost", number: "10"},
+		{display: "", expectedErrMsg: `x11: invalid display ""`},
+		{display: ":x", expectedErrMsg: `x11: invalid display ":x"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.display, func(t *testing.T) {
+			host, number, err := parseDisplay(test.display)
+			if test.expectedErrMsg != "" {
+				require.EqualError(t, err, test.expectedErrMsg)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.host, host)
+			assert.Equal(t, test.number, number)
+		})
+	}
+}
+
+func writeAuthEntry(buf *bytes.Buffer, family uint16, fields ...string) {
+	_ = binary.Write(buf, binary.BigEndian, family)
+	for _, field := range fields {
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(field)))
+		buf.WriteString(field)
+	}
+}
+
+func TestAuthAddress(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		addr            net.Addr
+		expectedFamily  uint16
+		expectedAddress string
+	}{
+		{&net.UnixAddr{Name: "/tmp/.X11-unix/X0", Net: "unix"}, familyLocal, hostname},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6000}, familyLocal, hostname},
+		{&net.TCPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 6000}, familyInternet, "\x0a\x00\x00\x05"},
+		{&net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 6000}, familyInternet6, "\xfd\x00" + strings.Repeat("\x00", 13) + "\x01"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.addr.String(), func(t *testing.T) {
+			family, address := authAddress(addrConn{remote: test.addr})
+			assert.Equal(t, test.expectedFamily, family)
+			assert.Equal(t, test.expectedAddress, address)
+		})
+	}
+}
+
+// addrConn is a net.Conn which only reports its remote address.
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestFindCookie(t *testing.T) {
+	var buf bytes.Buffer
+	writeAuthEntry(&buf, familyLocal, "otherhost", "0", cookieAuthName, "other")
+	writeAuthEntry(&buf, familyLocal, "myhost", "1", cookieAuthName, "display1")
+	writeAuthEntry(&buf, familyLocal, "myhost", "0", "XDM-AUTHORIZATION-1", "xdm")
+	writeAuthEntry(&buf, familyLocal, "myhost", "0", cookieAuthName, "display0")
+	writeAuthEntry(&buf, familyInternet, "\x0a\x00\x00\x05", "0", cookieAuthName, "tcp")
+	writeAuthEntry(&buf, familyInternet6, "\xfd\x00"+strings.Repeat("\x00", 13)+"\x01", "0", cookieAuthName, "tcp6")
+	writeAuthEntry(&buf, familyWild, "", "", cookieAuthName, "wildcard")
+
+	raw := buf.Bytes()
+
+	cookie, err := findCookie(bytes.NewReader(raw), familyLocal, "myhost", "0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("display0"), cookie)
+
+	cookie, err = findCookie(bytes.NewReader(raw), familyLocal, "myhost", "1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("display1"), cookie)
+
+	cookie, err = findCookie(bytes.NewReader(raw), familyInternet, "\x0a\x00\x00\x05", "0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tcp"), cookie)
+
+	cookie, err = findCookie(bytes.NewReader(raw), familyInternet6, "\xfd\x00"+strings.Repeat("\x00", 13)+"\x01", "0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tcp6"), cookie)
+
+	cookie, err = findCookie(bytes.NewReader(raw), familyLocal, "somehost", "5")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("wildcard"), cookie)
+
+	cookie, err = findCookie(bytes.NewReader(raw[:20]), familyLocal, "somehost", "5")
+	require.Error(t, err)
+	assert.Nil(t, cookie)
+}
@@ -0,0 +1,215 @@
+package x11
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// XKBExtension is the name of the X keyboard extension.
+const XKBExtension = "XKEYBOARD"
+
+// XKB minor opcodes.
+const (
+	xkbUseExtension   = 0
+	xkbSelectEvents   = 1
+	xkbGetState       = 4
+	xkbLatchLockState = 5
+	xkbGetNames       = 17
+)
+
+// xkbUseCoreKbd is the device spec of the core keyboard.
+const xkbUseCoreKbd = 0x100
+
+// XKB event types.
+const (
+	xkbNewKeyboardNotify = 0
+	xkbStateNotify       = 2
+	xkbNamesNotify       = 6
+)
+
+// XKB event masks.
+const (
+	xkbNewKeyboardNotifyMask = 1 << xkbNewKeyboardNotify
+	xkbStateNotifyMask       = 1 << xkbStateNotify
+	xkbNamesNotifyMask       = 1 << xkbNamesNotify
+)
+
+// xkbGroupStateMask selects state changes of the effective group.
+const xkbGroupStateMask = 1 << 4
+
+// XKB name components.
+const (
+	xkbSymbolsNameMask = 1 << 2
+	xkbGroupNamesMask  = 1 << 12
+)
+
+// opGetAtomName is the core opcode of GetAtomName.
+const opGetAtomName = 17
+
+// XKBNames contains the names of the keyboard map.
+type XKBNames struct {
+	// Symbols is the name of the symbols component, e.g.
+	// "pc+us+de:2+inet(evdev)".
+	Symbols string
+
+	// Groups are the names of the groups of the keymap, e.g.
+	// "English (US)".
+	Groups []string
+}
+
+func (c *Conn) xkbRequest(minor byte, body []byte) ([]byte, error) {
+	ext, err := c.QueryExtension(XKBExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Request(ext.MajorOpcode, minor, body)
+}
+
+func (c *Conn) xkbRequestChecked(minor byte, body []byte) error {
+	ext, err := c.QueryExtension(XKBExtension)
+	if err != nil {
+		return err
+	}
+
+	return c.RequestChecked(ext.MajorOpcode, minor, body)
+}
+
+// XKBUseExtension initializes the XKB extension for the connection. It must
+// be called before any other XKB request.
+func (c *Conn) XKBUseExtension() error {
+	body := make([]byte, 4)
+	order.PutUint16(body, 1)
+	order.PutUint16(body[2:], 0)
+
+	reply, err := c.xkbRequest(xkbUseExtension, body)
+	if err != nil {
+		return err
+	}
+
+	if reply[1] == 0 {
+		return fmt.Errorf("x11: XKB %d.%d not supported", order.Uint16(reply[8:]), order.Uint16(reply[10:]))
+	}
+
+	return nil
+}
+
+// XKBGroup returns the effective group of the core keyboard, i.e. the index
+// of the active layout.
+func (c *Conn) XKBGroup() (int, error) {
+	body := make([]byte, 4)
+	order.PutUint16(body, xkbUseCoreKbd)
+
+	reply, err := c.xkbRequest(xkbGetState, body)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(reply[12]), nil
+}
+
+// XKBLockGroup locks the group of the core keyboard, i.e. switches to the
+// layout at index group.
+func (c *Conn) XKBLockGroup(group int) error {
+	body := make([]byte, 12)
+	order.PutUint16(body, xkbUseCoreKbd)
+	body[4] = 1 // lockGroup
+	body[5] = byte(group)
+
+	return c.xkbRequestChecked(xkbLatchLockState, body)
+}
+
+// XKBNames retrieves the symbols name and the group names of the core
+// keyboard.
+func (c *Conn) XKBNames() (XKBNames, error) {
+	body := make([]byte, 8)
+	order.PutUint16(body, xkbUseCoreKbd)
+	order.PutUint32(body[4:], xkbSymbolsNameMask|xkbGroupNamesMask)
+
+	reply, err := c.xkbRequest(xkbGetNames, body)
+	if err != nil {
+		return XKBNames{}, err
+	}
+
+	// The value list contains the symbols atom followed by one atom per
+	// group that is present in the groupNames mask.
+	numGroups := bits.OnesCount8(reply[15])
+	if len(reply) < 32+4+numGroups*4 {
+		return XKBNames{}, fmt.Errorf("x11: malformed XKB names reply")
+	}
+
+	symbols, err := c.AtomName(order.Uint32(reply[32:]))
+	if err != nil {
+		return XKBNames{}, err
+	}
+
+	names := XKBNames{Symbols: symbols, Groups: make([]string, numGroups)}
+
+	for i := range names.Groups {
+		atom := order.Uint32(reply[36+i*4:])
+		if atom == 0 {
+			continue
+		}
+
+		if names.Groups[i], err = c.AtomName(atom); err != nil {
+			return XKBNames{}, err
+		}
+	}
+
+	return names, nil
+}
+
+// AtomName returns the name of atom.
+func (c *Conn) AtomName(atom uint32) (string, error) {
+	body := make([]byte, 4)
+	order.PutUint32(body, atom)
+
+	reply, err := c.Request(opGetAtomName, 0, body)
+	if err != nil {
+		return "", err
+	}
+
+	n := int(order.Uint16(reply[8:]))
+	if n > len(reply)-32 {
+		return "", fmt.Errorf("x11: invalid length %d for atom %d", n, atom)
+	}
+
+	return string(reply[32 : 32+n]), nil
+}
+
+// XKBSelectEvents subscribes to XKB events which are sent whenever the
+// effective group of the core keyboard changes or the keymap is replaced.
+func (c *Conn) XKBSelectEvents() error {
+	body := make([]byte, 16)
+	order.PutUint16(body, xkbUseCoreKbd)
+	order.PutUint16(body[2:], xkbNewKeyboardNotifyMask|xkbStateNotifyMask|xkbNamesNotifyMask) // affectWhich
+	order.PutUint16(body[6:], xkbNewKeyboardNotifyMask|xkbNamesNotifyMask)                    // selectAll
+
+	// Details for StateNotify, which is the only event that is not fully
+	// selected.
+	order.PutUint16(body[12:], xkbGroupStateMask)
+	order.PutUint16(body[14:], xkbGroupStateMask)
+
+	return c.xkbRequestChecked(xkbSelectEvents, body)
+}
+
+// IsXKBLayoutNotify returns true if ev is an XKB event indicating that the
+// active layout or the keymap changed.
+func (c *Conn) IsXKBLayoutNotify(ev []byte) bool {
+	c.mu.Lock()
+	ext, ok := c.extensions[XKBExtension]
+	c.mu.Unlock()
+
+	if !ok || len(ev) < 32 || ev[0]&0x7f != ext.FirstEvent {
+		return false
+	}
+
+	switch ev[1] {
+	case xkbNewKeyboardNotify, xkbNamesNotify:
+		return true
+	case xkbStateNotify:
+		return order.Uint16(ev[26:])&xkbGroupStateMask != 0
+	default:
+		return false
+	}
+}
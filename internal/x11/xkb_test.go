@@ -0,0 +1,161 @@
+package x11
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeXKB emulates the XKB extension of the fake X server.
+type fakeXKB struct {
+	group    byte
+	atoms    map[uint32]string
+	symbols  uint32
+	groups   []uint32
+	selected []byte
+}
+
+func newFakeXKBServer(t *testing.T) (*fakeServer, *fakeXKB, *Conn) {
+	s, c := newFakeServer(t)
+
+	s.addExtension(XKBExtension, Extension{MajorOpcode: 135, FirstEvent: 85})
+
+	xkb := &fakeXKB{
+		atoms: map[uint32]string{
+			1: "pc+us+de:2+inet(evdev)",
+			2: "English (US)",
+			3: "German",
+		},
+		symbols: 1,
+		groups:  []uint32{2, 3},
+	}
+
+	s.handle(opGetAtomName, func(req request) response {
+		name, ok := xkb.atoms[binary.LittleEndian.Uint32(req.body)]
+		if !ok {
+			return response{errCode: 5}
+		}
+
+		reply := make([]byte, 32, 32+pad(len(name)))
+		binary.LittleEndian.PutUint16(reply[8:], uint16(len(name)))
+		reply = append(reply, padded([]byte(name))...)
+
+		return response{reply: reply}
+	})
+
+	s.handle(135, func(req request) response {
+		reply := make([]byte, 32)
+
+		switch req.data {
+		case xkbUseExtension:
+			reply[1] = 1
+			binary.LittleEndian.PutUint16(reply[8:], 1)
+		case xkbGetState:
+			reply[12] = xkb.group
+		case xkbLatchLockState:
+			if req.body[4] != 0 {
+				if int(req.body[5]) >= len(xkb.groups) {
+					return response{errCode: 2}
+				}
+				xkb.group = req.body[5]
+			}
+			return response{}
+		case xkbGetNames:
+			reply[15] = byte(1<<len(xkb.groups) - 1)
+			reply = append(reply, make([]byte, 4+4*len(xkb.groups))...)
+			binary.LittleEndian.PutUint32(reply[32:], xkb.symbols)
+			for i, atom := range xkb.groups {
+				binary.LittleEndian.PutUint32(reply[36+i*4:], atom)
+			}
+		case xkbSelectEvents:
+			xkb.selected = req.body
+			return response{}
+		default:
+			return response{errCode: 1}
+		}
+
+		return response{reply: reply}
+	})
+
+	return s, xkb, c
+}
+
+func TestXKB(t *testing.T) {
+	_, xkb, c := newFakeXKBServer(t)
+
+	require.NoError(t, c.XKBUseExtension())
+
+	group, err := c.XKBGroup()
+	require.NoError(t, err)
+	assert.Equal(t, 0, group)
+
+	require.NoError(t, c.XKBLockGroup(1))
+
+	group, err = c.XKBGroup()
+	require.NoError(t, err)
+	assert.Equal(t, 1, group)
+
+	require.Error(t, c.XKBLockGroup(2))
+
+	names, err := c.XKBNames()
+	require.NoError(t, err)
+	assert.Equal(t, XKBNames{Symbols: "pc+us+de:2+inet(evdev)", Groups: []string{"English (US)", "German"}}, names)
+
+	require.NoError(t, c.XKBSelectEvents())
+	assert.Equal(t, []byte{0, 1, 0x45, 0, 0, 0, 0x41, 0, 0, 0, 0, 0, 0x10, 0, 0x10, 0}, xkb.selected)
+}
+
+func TestIsXKBLayoutNotify(t *testing.T) {
+	s, _, c := newFakeXKBServer(t)
+
+	require.NoError(t, c.XKBUseExtension())
+
+	tests := []struct {
+		name     string
+		ev       func(ev []byte)
+		expected bool
+	}{
+		{
+			name: "group changed",
+			ev: func(ev []byte) {
+				ev[1] = xkbStateNotify
+				binary.LittleEndian.PutUint16(ev[26:], xkbGroupStateMask)
+			},
+			expected: true,
+		},
+		{
+			name: "modifiers changed",
+			ev: func(ev []byte) {
+				ev[1] = xkbStateNotify
+				binary.LittleEndian.PutUint16(ev[26:], 1)
+			},
+		},
+		{
+			name: "new keyboard",
+			ev: func(ev []byte) {
+				ev[1] = xkbNewKeyboardNotify
+			},
+			expected: true,
+		},
+		{
+			name: "other extension",
+			ev: func(ev []byte) {
+				ev[0] = 86
+				ev[1] = xkbNewKeyboardNotify
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ev := make([]byte, 32)
+			ev[0] = 85
+			test.ev(ev)
+			s.sendEvent(ev)
+
+			assert.Equal(t, test.expected, c.IsXKBLayoutNotify(<-c.Events()))
+		})
+	}
+}
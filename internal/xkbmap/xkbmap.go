@@ -3,8 +3,10 @@ package xkbmap
 import (
 	"bufio"
 	"bytes"
-	"os/exec"
 	"regexp"
+	"strings"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
 )
 
 var xkbInfoRegexp = regexp.MustCompile(`([^:]*?)\s*:\s*(.*)$`)
@@ -14,11 +16,18 @@ type Info struct {
 	Rules  string
 	Model  string
 	Layout string
+
+	// Variant contains the comma-separated variants of each layout group,
+	// e.g. "intl," for layout "us,de".
+	Variant string
+
+	// Options contains XKB options like "caps:escape".
+	Options []string
 }
 
 // Query retrieves keyboard information using setxkbmap -query.
 func Query() (Info, error) {
-	output, err := exec.Command("setxkbmap", "-query").Output()
+	output, err := exec.CommandOutput("setxkbmap", "-query")
 	if err != nil {
 		return Info{}, err
 	}
@@ -26,9 +35,16 @@ func Query() (Info, error) {
 	return parseQueryOutput(output), nil
 }
 
-// SetLayout sets the keyboard layout.
-func SetLayout(layout string) error {
-	return exec.Command("setxkbmap", layout).Run()
+// SetLayout sets the keyboard layout and variant. Since setxkbmap drops the
+// active options when switching layouts, options replace them explicitly.
+func SetLayout(layout, variant string, options []string) error {
+	args := []string{"-layout", layout, "-variant", variant, "-option", ""}
+
+	for _, option := range options {
+		args = append(args, "-option", option)
+	}
+
+	return exec.CommandRun("setxkbmap", args...)
 }
 
 func parseQueryOutput(raw []byte) Info {
@@ -52,8 +68,24 @@ func parseQueryOutput(raw []byte) Info {
 			info.Model = value
 		case "layout":
 			info.Layout = value
+		case "variant":
+			info.Variant = value
+		case "options":
+			info.Options = parseOptions(value)
 		}
 	}
 
 	return info
 }
+
+func parseOptions(value string) []string {
+	var options []string
+
+	for _, option := range strings.Split(value, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+
+	return options
+}
@@ -3,7 +3,9 @@ package xkbmap
 import (
 	"testing"
 
+	"github.com/martinohmann/barista-contrib/internal/exec"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseQueryOutput(t *testing.T) {
@@ -20,3 +22,37 @@ layout:     us
 
 	assert.Equal(t, expected, parseQueryOutput(raw))
 }
+
+func TestParseQueryOutput_VariantAndOptions(t *testing.T) {
+	raw := []byte(`rules:      evdev
+model:      pc105
+layout:     us,de
+variant:    intl,
+options:    caps:escape,compose:ralt
+`)
+
+	expected := Info{
+		Rules:   "evdev",
+		Model:   "pc105",
+		Layout:  "us,de",
+		Variant: "intl,",
+		Options: []string{"caps:escape", "compose:ralt"},
+	}
+
+	assert.Equal(t, expected, parseQueryOutput(raw))
+}
+
+func TestSetLayout(t *testing.T) {
+	var cmds []exec.Cmd
+	defer exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})()
+
+	require.NoError(t, SetLayout("de", "nodeadkeys", []string{"caps:escape", "compose:ralt"}))
+	require.NoError(t, SetLayout("us", "", nil))
+
+	require.Len(t, cmds, 2)
+	assert.True(t, cmds[0].Matches("setxkbmap", "-layout", "de", "-variant", "nodeadkeys", "-option", "", "-option", "caps:escape", "-option", "compose:ralt"))
+	assert.True(t, cmds[1].Matches("setxkbmap", "-layout", "us", "-variant", "", "-option", ""))
+}
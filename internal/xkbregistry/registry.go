@@ -0,0 +1,144 @@
+// Package xkbregistry parses the XKB rules registry, e.g.
+// /usr/share/X11/xkb/rules/evdev.xml, which describes the available
+// keyboard layouts and their variants. Exotic layouts and variants are
+// described by an extras registry next to it, e.g. evdev.extras.xml.
+package xkbregistry
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultPath is the path of the registry for the evdev rules used by X11
+// and most Wayland compositors.
+const DefaultPath = "/usr/share/X11/xkb/rules/evdev.xml"
+
+// ConfigItem describes a layout or variant.
+type ConfigItem struct {
+	// Name is the XKB name, e.g. "us" or "intl".
+	Name string `xml:"name"`
+
+	// ShortDescription is a short code for the layout, e.g. "en". It is
+	// often empty for variants.
+	ShortDescription string `xml:"shortDescription"`
+
+	// Description is the human readable name, e.g. "English (US)".
+	Description string `xml:"description"`
+
+	// Countries contains the ISO 3166 codes of the countries the layout is
+	// used in, e.g. "US".
+	Countries []string `xml:"countryList>iso3166Id"`
+
+	// Languages contains the ISO 639 codes of the languages the layout is
+	// used for, e.g. "eng".
+	Languages []string `xml:"languageList>iso639Id"`
+}
+
+// Variant is a variant of a layout.
+type Variant struct {
+	ConfigItem ConfigItem `xml:"configItem"`
+}
+
+// Layout is a keyboard layout.
+type Layout struct {
+	ConfigItem ConfigItem `xml:"configItem"`
+
+	// Variants contains the variants of the layout.
+	Variants []Variant `xml:"variantList>variant"`
+}
+
+// Variant returns the variant with given name.
+func (l *Layout) Variant(name string) (*Variant, bool) {
+	for i := range l.Variants {
+		if l.Variants[i].ConfigItem.Name == name {
+			return &l.Variants[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Registry contains the layouts of an XKB rules registry.
+type Registry struct {
+	Layouts []Layout `xml:"layoutList>layout"`
+}
+
+// Layout returns the layout with given name.
+func (r *Registry) Layout(name string) (*Layout, bool) {
+	for i := range r.Layouts {
+		if r.Layouts[i].ConfigItem.Name == name {
+			return &r.Layouts[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Parse parses the registry from r.
+func Parse(r io.Reader) (*Registry, error) {
+	var registry Registry
+
+	if err := xml.NewDecoder(r).Decode(&registry); err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
+
+// Load parses the registry at path.
+func Load(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Merge adds the layouts of other to r. Variants of layouts which are part of
+// both registries are added to the layout of r.
+func (r *Registry) Merge(other *Registry) {
+	for _, layout := range other.Layouts {
+		existing, ok := r.Layout(layout.ConfigItem.Name)
+		if !ok {
+			r.Layouts = append(r.Layouts, layout)
+			continue
+		}
+
+		for _, variant := range layout.Variants {
+			if _, ok := existing.Variant(variant.ConfigItem.Name); !ok {
+				existing.Variants = append(existing.Variants, variant)
+			}
+		}
+	}
+}
+
+// ExtrasPath returns the path of the extras registry which belongs to the
+// registry at path, e.g. "evdev.extras.xml" for "evdev.xml".
+func ExtrasPath(path string) string {
+	return strings.TrimSuffix(path, ".xml") + ".extras.xml"
+}
+
+// LoadWithExtras parses the registry at path and merges the layouts of the
+// extras registry into it, see ExtrasPath. A missing extras registry is
+// ignored.
+func LoadWithExtras(path string) (*Registry, error) {
+	registry, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	extras, err := Load(ExtrasPath(path))
+	if os.IsNotExist(err) {
+		return registry, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	registry.Merge(extras)
+
+	return registry, nil
+}
@@ -0,0 +1,92 @@
+package xkbregistry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	r, err := Load("testdata/evdev.xml")
+	require.NoError(t, err)
+	require.Len(t, r.Layouts, 3)
+
+	us, ok := r.Layout("us")
+	require.True(t, ok)
+	assert.Equal(t, ConfigItem{
+		Name:             "us",
+		ShortDescription: "en",
+		Description:      "English (US)",
+		Countries:        []string{"US"},
+		Languages:        []string{"eng"},
+	}, us.ConfigItem)
+	require.Len(t, us.Variants, 2)
+
+	intl, ok := us.Variant("intl")
+	require.True(t, ok)
+	assert.Equal(t, "English (US, intl., with dead keys)", intl.ConfigItem.Description)
+	assert.Empty(t, intl.ConfigItem.ShortDescription)
+
+	_, ok = us.Variant("unknown")
+	assert.False(t, ok)
+
+	_, ok = r.Layout("unknown")
+	assert.False(t, ok)
+}
+
+func TestLoad_System(t *testing.T) {
+	r, err := Load(DefaultPath)
+	if err != nil {
+		t.Skipf("system registry not available: %v", err)
+	}
+
+	de, ok := r.Layout("de")
+	require.True(t, ok)
+	assert.Equal(t, "German", de.ConfigItem.Description)
+}
+
+func TestLoadWithExtras(t *testing.T) {
+	r, err := LoadWithExtras("testdata/evdev.xml")
+	require.NoError(t, err)
+	require.Len(t, r.Layouts, 4)
+
+	apl, ok := r.Layout("apl")
+	require.True(t, ok, "layouts are added")
+	assert.Equal(t, "APL", apl.ConfigItem.Description)
+
+	us, ok := r.Layout("us")
+	require.True(t, ok)
+	require.Len(t, us.Variants, 3, "variants are merged into existing layouts")
+
+	_, ok = us.Variant("drix")
+	assert.True(t, ok)
+}
+
+func TestLoadWithExtras_NoExtras(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xkbregistry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	buf, err := ioutil.ReadFile("testdata/evdev.xml")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "evdev.xml")
+	require.NoError(t, ioutil.WriteFile(path, buf, 0644))
+
+	r, err := LoadWithExtras(path)
+	require.NoError(t, err)
+	assert.Len(t, r.Layouts, 3)
+}
+
+func TestExtrasPath(t *testing.T) {
+	assert.Equal(t, "/usr/share/X11/xkb/rules/evdev.extras.xml", ExtrasPath(DefaultPath))
+}
+
+func TestLoad_NotFound(t *testing.T) {
+	_, err := Load("testdata/nonexistent.xml")
+	require.Error(t, err)
+}
@@ -2,11 +2,35 @@ package xset
 
 import (
 	"errors"
-	"os/exec"
 	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
+)
+
+var (
+	dpmsRegexp         = regexp.MustCompile(`(?m)^\s*DPMS is\s+(.*)$`)
+	dpmsTimeoutsRegexp = regexp.MustCompile(`(?m)^\s*Standby:\s*(\d+)\s+Suspend:\s*(\d+)\s+Off:\s*(\d+)\s*$`)
+	monitorRegexp      = regexp.MustCompile(`(?m)^\s*Monitor is\s+(?:in\s+)?(\w+)\s*$`)
 )
 
-var dpmsRegexp = regexp.MustCompile(`(?m)^\s*DPMS is\s+(.*)$`)
+// DPMSInfo contains the DPMS information reported by xset.
+type DPMSInfo struct {
+	// Enabled is true if DPMS is enabled.
+	Enabled bool
+
+	// Standby, Suspend and Off are the DPMS timeouts. A zero timeout means
+	// that the respective mode is disabled.
+	Standby time.Duration
+	Suspend time.Duration
+	Off     time.Duration
+
+	// Monitor is the monitor power level, one of "On", "Standby", "Suspend"
+	// or "Off". It is empty if DPMS is disabled because xset does not report
+	// it in that case.
+	Monitor string
+}
 
 // SetDPMS enables or disables DPMS.
 func SetDPMS(enabled bool) error {
@@ -15,17 +39,39 @@ func SetDPMS(enabled bool) error {
 		arg = "+dpms"
 	}
 
-	return exec.Command("xset", arg).Run()
+	return exec.CommandRun("xset", arg)
+}
+
+// SetDPMSTimeouts sets the standby, suspend and off timeouts. Timeouts are
+// truncated to seconds. A zero timeout disables the respective mode.
+func SetDPMSTimeouts(standby, suspend, off time.Duration) error {
+	return exec.CommandRun("xset", "dpms", seconds(standby), seconds(suspend), seconds(off))
+}
+
+// ForceDPMS forces the monitor into the given power level immediately. Valid
+// levels are "on", "standby", "suspend" and "off".
+func ForceDPMS(level string) error {
+	return exec.CommandRun("xset", "dpms", "force", level)
 }
 
 // GetDPMS retrieves the current DPMS status.
 func GetDPMS() (bool, error) {
-	out, err := exec.Command("xset", "-q").Output()
+	info, err := QueryDPMS()
 	if err != nil {
 		return false, err
 	}
 
-	return parseDPMSStatus(out)
+	return info.Enabled, nil
+}
+
+// QueryDPMS retrieves the DPMS status, timeouts and monitor power level.
+func QueryDPMS() (DPMSInfo, error) {
+	out, err := exec.CommandOutput("xset", "-q")
+	if err != nil {
+		return DPMSInfo{}, err
+	}
+
+	return parseDPMSInfo(out)
 }
 
 func parseDPMSStatus(raw []byte) (bool, error) {
@@ -36,3 +82,35 @@ func parseDPMSStatus(raw []byte) (bool, error) {
 
 	return match[1] == "Enabled", nil
 }
+
+func parseDPMSInfo(raw []byte) (DPMSInfo, error) {
+	enabled, err := parseDPMSStatus(raw)
+	if err != nil {
+		return DPMSInfo{}, err
+	}
+
+	info := DPMSInfo{Enabled: enabled}
+
+	if match := dpmsTimeoutsRegexp.FindStringSubmatch(string(raw)); match != nil {
+		info.Standby = parseSeconds(match[1])
+		info.Suspend = parseSeconds(match[2])
+		info.Off = parseSeconds(match[3])
+	}
+
+	if match := monitorRegexp.FindStringSubmatch(string(raw)); match != nil {
+		info.Monitor = match[1]
+	}
+
+	return info, nil
+}
+
+func parseSeconds(s string) time.Duration {
+	// The regexp guarantees that s only consists of digits.
+	n, _ := strconv.ParseInt(s, 10, 64)
+
+	return time.Duration(n) * time.Second
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
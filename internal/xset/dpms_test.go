@@ -1,8 +1,11 @@
 package xset
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/martinohmann/barista-contrib/internal/exec"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,3 +51,87 @@ DPMS (Energy Star):
 	_, err = parseDPMSStatus([]byte(`invalid`))
 	require.Error(t, err)
 }
+
+func TestParseDPMSInfo(t *testing.T) {
+	given := []byte(`Screen Saver:
+  prefer blanking:  yes    allow exposures:  yes
+  timeout:  1200    cycle:  1200
+DPMS (Energy Star):
+  Standby: 600    Suspend: 900    Off: 1200
+  DPMS is Enabled
+  Monitor is in Standby
+`)
+
+	expected := DPMSInfo{
+		Enabled: true,
+		Standby: 10 * time.Minute,
+		Suspend: 15 * time.Minute,
+		Off:     20 * time.Minute,
+		Monitor: "Standby",
+	}
+
+	info, err := parseDPMSInfo(given)
+	require.NoError(t, err)
+	assert.Equal(t, expected, info)
+
+	info, err = parseDPMSInfo([]byte(`DPMS (Energy Star):
+  Standby: 0    Suspend: 0    Off: 300
+  DPMS is Disabled
+`))
+	require.NoError(t, err)
+	assert.Equal(t, DPMSInfo{Off: 5 * time.Minute}, info)
+
+	_, err = parseDPMSInfo([]byte(`invalid`))
+	require.Error(t, err)
+}
+
+func TestQueryDPMS(t *testing.T) {
+	restore := exec.FakeCommandOutput(func(cmd exec.Cmd) ([]byte, error) {
+		if cmd.Matches("xset", "-q") {
+			return []byte("  Standby: 60    Suspend: 120    Off: 180\n  DPMS is Enabled\n  Monitor is Off\n"), nil
+		}
+
+		return nil, errors.New("invalid command")
+	})
+	defer restore()
+
+	expected := DPMSInfo{
+		Enabled: true,
+		Standby: time.Minute,
+		Suspend: 2 * time.Minute,
+		Off:     3 * time.Minute,
+		Monitor: "Off",
+	}
+
+	info, err := QueryDPMS()
+	require.NoError(t, err)
+	assert.Equal(t, expected, info)
+
+	enabled, err := GetDPMS()
+	require.NoError(t, err)
+	assert.True(t, enabled)
+}
+
+func TestSetters(t *testing.T) {
+	var cmds []exec.Cmd
+
+	restore := exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})
+	defer restore()
+
+	require.NoError(t, SetDPMS(true))
+	require.NoError(t, SetDPMS(false))
+	require.NoError(t, SetDPMSTimeouts(time.Minute, 90*time.Second, 0))
+	require.NoError(t, ForceDPMS("off"))
+
+	expected := []exec.Cmd{
+		{Name: "xset", Args: []string{"+dpms"}},
+		{Name: "xset", Args: []string{"-dpms"}},
+		{Name: "xset", Args: []string{"dpms", "60", "90", "0"}},
+		{Name: "xset", Args: []string{"dpms", "force", "off"}},
+	}
+
+	assert.Equal(t, expected, cmds)
+}
@@ -0,0 +1,82 @@
+package cpufreq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs/sysfs"
+)
+
+// Cluster is a group of CPUs of the same core type on hybrid CPUs, e.g. the
+// P-cores and E-cores of Intel Alder Lake or the big and LITTLE cores of ARM
+// SoCs.
+type Cluster struct {
+	// Name is a short name for the cluster, e.g. "P" or "E".
+	Name string
+
+	// CPUs contains the indices of the cluster's CPUs in Info.Stats.
+	CPUs []int
+}
+
+// ClustersString returns the average frequency of all clusters formatted like
+// "P 4.1 / E 2.8 GHz".
+func (i Info) ClustersString() string {
+	parts := make([]string, len(i.Clusters))
+	for j, cluster := range i.Clusters {
+		parts[j] = fmt.Sprintf("%s %.1f", cluster.Name, i.ClusterFreq(cluster).Gigahertz())
+	}
+
+	return strings.Join(parts, " / ") + " GHz"
+}
+
+// ClustersByMaxFreq groups CPUs into clusters by their maximum frequency. The
+// resulting clusters are sorted by maximum frequency in descending order and
+// named "P" (performance), "M" (mid) and "E" (efficiency). CPUs without
+// maximum frequency are ignored. This is only meaningful for CPUs which are
+// known to be hybrid, e.g. ARM big.LITTLE SoCs, since the cores of non-hybrid
+// CPUs may have slightly different maximum frequencies as well.
+func ClustersByMaxFreq(stats []sysfs.SystemCPUCpufreqStats) []Cluster {
+	cpusByFreq := make(map[uint64][]int)
+	for i, stat := range stats {
+		if stat.CpuinfoMaximumFrequency == nil {
+			continue
+		}
+
+		freq := *stat.CpuinfoMaximumFrequency
+		cpusByFreq[freq] = append(cpusByFreq[freq], i)
+	}
+
+	freqs := make([]uint64, 0, len(cpusByFreq))
+	for freq := range cpusByFreq {
+		freqs = append(freqs, freq)
+	}
+
+	sort.Slice(freqs, func(i, j int) bool {
+		return freqs[i] > freqs[j]
+	})
+
+	clusters := make([]Cluster, len(freqs))
+	for i, freq := range freqs {
+		clusters[i] = Cluster{
+			Name: clusterName(i, len(freqs)),
+			CPUs: cpusByFreq[freq],
+		}
+	}
+
+	return clusters
+}
+
+func clusterName(i, count int) string {
+	switch {
+	case i == 0:
+		return "P"
+	case i == count-1:
+		return "E"
+	case count == 3:
+		return "M"
+	default:
+		return "M" + strconv.Itoa(i)
+	}
+}
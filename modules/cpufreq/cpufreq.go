@@ -18,6 +18,76 @@ type Provider interface {
 
 type Info struct {
 	Stats []sysfs.SystemCPUCpufreqStats
+
+	// FreqStats contains the cumulative frequency statistics since boot for
+	// each CPU in Stats. It is nil if the provider does not support frequency
+	// statistics.
+	FreqStats []FreqStats
+
+	// FreqStatsDelta contains the frequency statistics accumulated since the
+	// previous refresh for each CPU in Stats. It is nil on the first
+	// refresh.
+	FreqStatsDelta []FreqStats
+
+	// Clusters contains the CPU clusters of hybrid CPUs, e.g. performance and
+	// efficiency cores. Contains at most one cluster on non-hybrid CPUs.
+	Clusters []Cluster
+}
+
+// FreqStats contains the frequency transition statistics of a single CPU as
+// exposed by the kernel in cpufreq/stats.
+type FreqStats struct {
+	// TimeInState contains the time spent at each frequency.
+	TimeInState map[unit.Frequency]time.Duration
+
+	// TotalTransitions is the number of frequency transitions.
+	TotalTransitions uint64
+}
+
+// MaxFreq returns the highest frequency found in the stats.
+func (s FreqStats) MaxFreq() unit.Frequency {
+	var max unit.Frequency
+	for freq := range s.TimeInState {
+		if freq > max {
+			max = freq
+		}
+	}
+
+	return max
+}
+
+// TotalTime returns the sum of the time spent in all frequencies.
+func (s FreqStats) TotalTime() time.Duration {
+	var total time.Duration
+	for _, d := range s.TimeInState {
+		total += d
+	}
+
+	return total
+}
+
+// Sub returns the difference between s and prev. Counters which are lower
+// than in prev yield zero.
+func (s FreqStats) Sub(prev FreqStats) FreqStats {
+	delta := FreqStats{
+		TimeInState: make(map[unit.Frequency]time.Duration, len(s.TimeInState)),
+	}
+
+	// Counters may go backwards, e.g. after a CPU was hotplugged, so
+	// negative deltas are clamped to zero.
+	for freq, d := range s.TimeInState {
+		if d >= prev.TimeInState[freq] {
+			delta.TimeInState[freq] = d - prev.TimeInState[freq]
+		} else {
+			delta.TimeInState[freq] = 0
+		}
+	}
+
+	if s.TotalTransitions >= prev.TotalTransitions {
+		delta.TotalTransitions = s.TotalTransitions - prev.TotalTransitions
+	}
+
+	return delta
 }
 
 func (i Info) NumCPUs() int {
@@ -38,9 +108,30 @@ func (i Info) Freq(cpu int) unit.Frequency {
 }
 
 func (i Info) AverageFreq() unit.Frequency {
+	return averageFreq(i.Stats)
+}
+
+// ClusterFreq returns the average frequency of the CPUs in cluster.
+func (i Info) ClusterFreq(cluster Cluster) unit.Frequency {
+	stats := make([]sysfs.SystemCPUCpufreqStats, 0, len(cluster.CPUs))
+	for _, cpu := range cluster.CPUs {
+		if cpu >= 0 && cpu < i.NumCPUs() {
+			stats = append(stats, i.Stats[cpu])
+		}
+	}
+
+	return averageFreq(stats)
+}
+
+// Hybrid returns true if the CPUs are grouped into more than one cluster.
+func (i Info) Hybrid() bool {
+	return len(i.Clusters) > 1
+}
+
+func averageFreq(stats []sysfs.SystemCPUCpufreqStats) unit.Frequency {
 	var count int
 	var sum uint64
-	for _, stat := range i.Stats {
+	for _, stat := range stats {
 		if stat.ScalingCurrentFrequency == nil {
 			continue
 		}
@@ -49,9 +140,73 @@ func (i Info) AverageFreq() unit.Frequency {
 		sum += *stat.ScalingCurrentFrequency
 	}
 
+	if count == 0 {
+		return 0
+	}
+
 	return unit.Frequency(float64(sum) / float64(count) * 1000)
 }
 
+// freqStats returns the frequency statistics since the previous refresh if
+// available and the cumulative ones otherwise.
+func (i Info) freqStats() []FreqStats {
+	if i.FreqStatsDelta != nil {
+		return i.FreqStatsDelta
+	}
+
+	return i.FreqStats
+}
+
+// MaxFreqPercent returns the percentage of time all CPUs spent at their
+// maximum frequency since the previous refresh, or since boot on the first
+// refresh. A low value while the CPUs are busy is a sign of thermal
+// throttling. Returns 0 if no frequency statistics are available.
+func (i Info) MaxFreqPercent() float64 {
+	var atMax, total time.Duration
+	for _, stats := range i.freqStats() {
+		atMax += stats.TimeInState[stats.MaxFreq()]
+		total += stats.TotalTime()
+	}
+
+	if total <= 0 {
+		return 0
+	}
+
+	return float64(atMax) / float64(total) * 100
+}
+
+// Transitions returns the number of frequency transitions of all CPUs since
+// the previous refresh, or since boot on the first refresh.
+func (i Info) Transitions() uint64 {
+	var sum uint64
+	for _, stats := range i.freqStats() {
+		sum += stats.TotalTransitions
+	}
+
+	return sum
+}
+
+// withDelta computes the frequency statistics deltas between i and prev.
+func (i Info) withDelta(prev Info) Info {
+	if i.FreqStats == nil || len(i.FreqStats) != len(prev.FreqStats) {
+		return i
+	}
+
+	i.FreqStatsDelta = make([]FreqStats, len(i.FreqStats))
+	for cpu, stats := range i.FreqStats {
+		i.FreqStatsDelta[cpu] = stats.Sub(prev.FreqStats[cpu])
+	}
+
+	return i
+}
+
+// MaxFreqOutput is an output func that can be passed to Module.Output to
+// display the average frequency along with the percentage of time the CPUs
+// spent at their maximum frequency.
+func MaxFreqOutput(info Info) bar.Output {
+	return outputs.Textf("%.2fGHz %.0f%%", info.AverageFreq().Gigahertz(), info.MaxFreqPercent())
+}
+
 type Module struct {
 	provider   Provider
 	outputFunc value.Value // of func(Info) bar.Output
@@ -68,6 +223,9 @@ func New(provider Provider) *Module {
 
 	m.notifyFn, m.notifyCh = notifier.New()
 	m.outputFunc.Set(func(info Info) bar.Output {
+		if info.Hybrid() {
+			return outputs.Text(info.ClustersString())
+		}
 		return outputs.Textf("%.2fGHz", info.AverageFreq().Gigahertz())
 	})
 
@@ -80,23 +238,32 @@ func (m *Module) Stream(s bar.Sink) {
 	info, err := m.provider.GetCPUFrequency()
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
 	for {
-		if s.Error(err) {
-			continue
+		if !s.Error(err) {
+			s.Output(outputFunc(info))
 		}
 
-		s.Output(outputFunc(info))
-
 		select {
 		case <-m.outputFunc.Next():
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		case <-m.notifyCh:
-			info, err = m.provider.GetCPUFrequency()
+			info, err = m.update(info)
 		case <-m.scheduler.C:
-			info, err = m.provider.GetCPUFrequency()
+			info, err = m.update(info)
 		}
 	}
 }
 
+// update retrieves new cpu frequency info from the provider and computes the
+// frequency statistics deltas relative to prev.
+func (m *Module) update(prev Info) (Info, error) {
+	info, err := m.provider.GetCPUFrequency()
+	if err != nil {
+		return prev, err
+	}
+
+	return info.withDelta(prev), nil
+}
+
 func (m *Module) Output(format func(Info) bar.Output) *Module {
 	m.outputFunc.Set(format)
 	return m
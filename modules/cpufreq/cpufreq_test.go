@@ -0,0 +1,184 @@
+package cpufreq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"github.com/martinlindhe/unit"
+	"github.com/prometheus/procfs/sysfs"
+	"github.com/stretchr/testify/assert"
+)
+
+type testProvider struct {
+	sync.Mutex
+	err  error
+	info Info
+}
+
+func (p *testProvider) GetCPUFrequency() (Info, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return Info{}, p.err
+	}
+
+	return p.info, nil
+}
+
+func (p *testProvider) setInfo(info Info) {
+	p.Lock()
+	defer p.Unlock()
+	p.info = info
+}
+
+func (p *testProvider) setError(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.err = err
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+func newInfo(freq uint64, atMax, belowMax time.Duration, transitions uint64) Info {
+	return Info{
+		Stats: []sysfs.SystemCPUCpufreqStats{
+			{Name: "0", ScalingCurrentFrequency: uint64Ptr(freq)},
+		},
+		FreqStats: []FreqStats{
+			{
+				TimeInState: map[unit.Frequency]time.Duration{
+					1 * unit.Gigahertz: belowMax,
+					3 * unit.Gigahertz: atMax,
+				},
+				TotalTransitions: transitions,
+			},
+		},
+	}
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		info: newInfo(2000000, 10*time.Second, 30*time.Second, 10),
+	}
+
+	m := New(testProvider).Output(MaxFreqOutput)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"2.00GHz 25%"})
+
+	testProvider.setInfo(newInfo(3000000, 19*time.Second, 31*time.Second, 15))
+	m.Refresh()
+	out = testBar.NextOutput("delta since last refresh")
+	out.AssertText([]string{"3.00GHz 90%"})
+
+	testProvider.setError(errors.New("whoops"))
+	testBar.Tick()
+	out = testBar.NextOutput("error")
+	out.AssertError()
+
+	testProvider.setError(nil)
+	testProvider.setInfo(newInfo(1000000, 19*time.Second, 41*time.Second, 20))
+
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%d transitions", info.Transitions())
+	})
+
+	out = testBar.NextOutput("output func changed")
+	out.AssertError()
+
+	testBar.Tick()
+	out = testBar.NextOutput("delta relative to last successful refresh")
+	out.AssertText([]string{"5 transitions"})
+}
+
+func TestFreqStats_Sub(t *testing.T) {
+	stats := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 3 * time.Second,
+			2 * unit.Gigahertz: 5 * time.Second,
+		},
+		TotalTransitions: 4,
+	}
+
+	prev := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 1 * time.Second,
+		},
+		TotalTransitions: 1,
+	}
+
+	expected := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 2 * time.Second,
+			2 * unit.Gigahertz: 5 * time.Second,
+		},
+		TotalTransitions: 3,
+	}
+
+	delta := stats.Sub(prev)
+
+	assert.Equal(t, expected, delta)
+	assert.Equal(t, 2*unit.Gigahertz, delta.MaxFreq())
+	assert.Equal(t, 7*time.Second, delta.TotalTime())
+}
+
+func TestFreqStats_Sub_CounterReset(t *testing.T) {
+	stats := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 1 * time.Second,
+			2 * unit.Gigahertz: 5 * time.Second,
+		},
+		TotalTransitions: 2,
+	}
+
+	prev := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 3 * time.Second,
+			2 * unit.Gigahertz: 4 * time.Second,
+		},
+		TotalTransitions: 10,
+	}
+
+	expected := FreqStats{
+		TimeInState: map[unit.Frequency]time.Duration{
+			1 * unit.Gigahertz: 0,
+			2 * unit.Gigahertz: 1 * time.Second,
+		},
+	}
+
+	assert.Equal(t, expected, stats.Sub(prev))
+}
+
+func TestClustersByMaxFreq(t *testing.T) {
+	stats := []sysfs.SystemCPUCpufreqStats{
+		{Name: "0", CpuinfoMaximumFrequency: uint64Ptr(1800000), ScalingCurrentFrequency: uint64Ptr(1000000)},
+		{Name: "1", CpuinfoMaximumFrequency: uint64Ptr(1800000), ScalingCurrentFrequency: uint64Ptr(1200000)},
+		{Name: "2", CpuinfoMaximumFrequency: uint64Ptr(2400000), ScalingCurrentFrequency: uint64Ptr(2000000)},
+		{Name: "3", CpuinfoMaximumFrequency: uint64Ptr(3000000), ScalingCurrentFrequency: uint64Ptr(3000000)},
+		{Name: "4"},
+	}
+
+	expected := []Cluster{
+		{Name: "P", CPUs: []int{3}},
+		{Name: "M", CPUs: []int{2}},
+		{Name: "E", CPUs: []int{0, 1}},
+	}
+
+	clusters := ClustersByMaxFreq(stats)
+	assert.Equal(t, expected, clusters)
+
+	info := Info{Stats: stats, Clusters: clusters}
+	assert.True(t, info.Hybrid())
+	assert.Equal(t, 1.1*unit.Gigahertz, info.ClusterFreq(clusters[2]))
+	assert.Equal(t, "P 3.0 / M 2.0 / E 1.1 GHz", info.ClustersString())
+}
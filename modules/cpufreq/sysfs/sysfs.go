@@ -1,27 +1,294 @@
 package sysfs
 
 import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martinlindhe/unit"
 	"github.com/martinohmann/barista-contrib/modules/cpufreq"
 	"github.com/prometheus/procfs/sysfs"
 )
 
+// timeInStateUnit is the unit of the values in cpufreq/stats/time_in_state.
+// The kernel reports them in USER_HZ which is 100 on all relevant platforms.
+const timeInStateUnit = 10 * time.Millisecond
+
 // New creates a new *cpufreq.Module using sysfs as CPU frequency provider.
+// The mount point cannot be obtained from fs, so frequency statistics and
+// hybrid core types are only read if fs refers to the default sysfs mount
+// point. Use NewFromMountPoint for other mount points.
 func New(fs sysfs.FS) *cpufreq.Module {
+	return cpufreq.New(newProvider(fs))
+}
+
+func newProvider(fs sysfs.FS) *provider {
+	p := &provider{fs: fs}
+
+	if defaultFS, err := sysfs.NewFS(sysfs.DefaultMountPoint); err == nil && fs == defaultFS {
+		p.mountPoint = sysfs.DefaultMountPoint
+	}
+
+	return p
+}
+
+// NewFromMountPoint creates a new *cpufreq.Module using the sysfs mounted at
+// mountPoint as CPU frequency provider.
+func NewFromMountPoint(mountPoint string) (*cpufreq.Module, error) {
+	fs, err := sysfs.NewFS(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+
 	return cpufreq.New(&provider{
-		fs: fs,
-	})
+		fs:         fs,
+		mountPoint: mountPoint,
+	}), nil
 }
 
 type provider struct {
 	fs sysfs.FS
+
+	// mountPoint is the mount point fs was created for. It is empty if it is
+	// unknown, in which case only the information provided by fs is used.
+	mountPoint string
 }
 
-// Set implements cpufreq.Provider.
+// GetCPUFrequency implements cpufreq.Provider.
 func (p *provider) GetCPUFrequency() (cpufreq.Info, error) {
 	stats, err := p.fs.SystemCpufreq()
 	if err != nil {
 		return cpufreq.Info{}, err
 	}
 
-	return cpufreq.Info{Stats: stats}, nil
+	freqStats, err := p.readFreqStats(stats)
+	if err != nil {
+		return cpufreq.Info{}, err
+	}
+
+	clusters, err := p.readClusters(stats)
+	if err != nil {
+		return cpufreq.Info{}, err
+	}
+
+	info := cpufreq.Info{
+		Stats:     stats,
+		FreqStats: freqStats,
+		Clusters:  clusters,
+	}
+
+	return info, nil
+}
+
+// hybridCoreTypes maps the sysfs PMU devices of Intel hybrid CPUs to cluster
+// names.
+var hybridCoreTypes = []struct {
+	device string
+	name   string
+}{
+	{device: "cpu_core", name: "P"},
+	{device: "cpu_atom", name: "E"},
+}
+
+// readClusters detects the CPU clusters using the core type topology exposed
+// by Intel hybrid CPUs. On ARM SoCs which expose the CPU capacity, e.g.
+// big.LITTLE, CPUs are grouped by their maximum frequency instead. All other
+// CPUs form a single cluster, since the maximum frequencies of the cores of
+// non-hybrid CPUs may differ slightly, e.g. because of favoured cores.
+func (p *provider) readClusters(stats []sysfs.SystemCPUCpufreqStats) ([]cpufreq.Cluster, error) {
+	if p.mountPoint == "" {
+		return singleCluster(stats), nil
+	}
+
+	indices := make(map[int]int, len(stats))
+	for i, stat := range stats {
+		cpu, err := strconv.Atoi(stat.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		indices[cpu] = i
+	}
+
+	var clusters []cpufreq.Cluster
+
+	for _, coreType := range hybridCoreTypes {
+		buf, err := ioutil.ReadFile(filepath.Join(p.mountPoint, "devices", coreType.device, "cpus"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		cpus, err := parseCPUList(strings.TrimSpace(string(buf)))
+		if err != nil {
+			return nil, err
+		}
+
+		cluster := cpufreq.Cluster{Name: coreType.name}
+		for _, cpu := range cpus {
+			if i, ok := indices[cpu]; ok {
+				cluster.CPUs = append(cluster.CPUs, i)
+			}
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	if len(clusters) > 0 {
+		return clusters, nil
+	}
+
+	hasCapacity, err := p.hasCPUCapacity(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasCapacity {
+		return cpufreq.ClustersByMaxFreq(stats), nil
+	}
+
+	return singleCluster(stats), nil
+}
+
+// hasCPUCapacity returns true if the kernel exposes the capacity of the CPUs,
+// which is only the case on ARM SoCs.
+func (p *provider) hasCPUCapacity(stats []sysfs.SystemCPUCpufreqStats) (bool, error) {
+	if len(stats) == 0 {
+		return false, nil
+	}
+
+	_, err := os.Stat(filepath.Join(p.mountPoint, "devices/system/cpu", "cpu"+stats[0].Name, "cpu_capacity"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// singleCluster returns a single cluster containing all CPUs in stats.
+func singleCluster(stats []sysfs.SystemCPUCpufreqStats) []cpufreq.Cluster {
+	cluster := cpufreq.Cluster{Name: "P", CPUs: make([]int, len(stats))}
+	for i := range stats {
+		cluster.CPUs[i] = i
+	}
+
+	return []cpufreq.Cluster{cluster}
+}
+
+// parseCPUList parses a CPU list in the kernel's format, e.g. "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+
+	if list == "" {
+		return cpus, nil
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
+
+// readFreqStats reads the frequency statistics for all CPUs in stats. Returns
+// nil if the kernel does not expose them, e.g. because the cpufreq driver
+// does not support them, or if the mount point is unknown.
+func (p *provider) readFreqStats(stats []sysfs.SystemCPUCpufreqStats) ([]cpufreq.FreqStats, error) {
+	if p.mountPoint == "" {
+		return nil, nil
+	}
+
+	freqStats := make([]cpufreq.FreqStats, len(stats))
+
+	for i, stat := range stats {
+		path := filepath.Join(p.mountPoint, "devices/system/cpu", "cpu"+stat.Name, "cpufreq/stats")
+
+		timeInState, err := readTimeInState(filepath.Join(path, "time_in_state"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		totalTransitions, err := readUint(filepath.Join(path, "total_trans"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		freqStats[i] = cpufreq.FreqStats{
+			TimeInState:      timeInState,
+			TotalTransitions: totalTransitions,
+		}
+	}
+
+	return freqStats, nil
+}
+
+func readTimeInState(path string) (map[unit.Frequency]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	timeInState := make(map[unit.Frequency]time.Duration)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line in %s: %q", path, scanner.Text())
+		}
+
+		freq, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		ticks, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		// Frequencies are reported in kHz.
+		timeInState[unit.Frequency(freq)*unit.Kilohertz] = time.Duration(ticks) * timeInStateUnit
+	}
+
+	return timeInState, scanner.Err()
+}
+
+func readUint(path string) (uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
 }
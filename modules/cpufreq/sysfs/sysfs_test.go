@@ -0,0 +1,161 @@
+package sysfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"github.com/martinohmann/barista-contrib/modules/cpufreq"
+	"github.com/prometheus/procfs/sysfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "testdata"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+
+	expected := []cpufreq.FreqStats{
+		{
+			TimeInState: map[unit.Frequency]time.Duration{
+				800 * unit.Megahertz: 10 * time.Second,
+				2 * unit.Gigahertz:   5 * time.Second,
+				3 * unit.Gigahertz:   5 * time.Second,
+			},
+			TotalTransitions: 42,
+		},
+		{
+			TimeInState: map[unit.Frequency]time.Duration{
+				800 * unit.Megahertz: 10 * time.Second,
+				2 * unit.Gigahertz:   5 * time.Second,
+				3 * unit.Gigahertz:   15 * time.Second,
+			},
+			TotalTransitions: 43,
+		},
+	}
+
+	require.Len(t, info.Stats, 2)
+	assert.Equal(t, expected, info.FreqStats)
+	assert.Nil(t, info.FreqStatsDelta)
+	assert.Equal(t, 40.0, info.MaxFreqPercent())
+	assert.Equal(t, uint64(85), info.Transitions())
+}
+
+func TestProvider_NoFreqStats(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "nonexistent"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+	require.Len(t, info.Stats, 2)
+	assert.Nil(t, info.FreqStats)
+	assert.Equal(t, 0.0, info.MaxFreqPercent())
+}
+
+func TestProvider_Clusters(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "testdata"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+
+	expected := []cpufreq.Cluster{
+		{Name: "P", CPUs: []int{0, 1}},
+	}
+
+	assert.Equal(t, expected, info.Clusters)
+	assert.False(t, info.Hybrid())
+}
+
+func TestProvider_HybridClusters(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata/hybrid")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "testdata/hybrid"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+
+	expected := []cpufreq.Cluster{
+		{Name: "P", CPUs: []int{0, 1}},
+		{Name: "E", CPUs: []int{2, 3}},
+	}
+
+	assert.Equal(t, expected, info.Clusters)
+	assert.True(t, info.Hybrid())
+	assert.Equal(t, "P 4.1 / E 2.8 GHz", info.ClustersString())
+}
+
+func TestProvider_ARMClusters(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata/arm")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "testdata/arm"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+
+	expected := []cpufreq.Cluster{
+		{Name: "P", CPUs: []int{2, 3}},
+		{Name: "E", CPUs: []int{0, 1}},
+	}
+
+	assert.Equal(t, expected, info.Clusters)
+	assert.True(t, info.Hybrid())
+}
+
+func TestProvider_FavouredCores(t *testing.T) {
+	fs, err := sysfs.NewFS("testdata/favoured")
+	require.NoError(t, err)
+
+	p := &provider{fs: fs, mountPoint: "testdata/favoured"}
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+
+	expected := []cpufreq.Cluster{
+		{Name: "P", CPUs: []int{0, 1, 2, 3}},
+	}
+
+	assert.Equal(t, expected, info.Clusters, "slightly different max frequencies do not form clusters")
+	assert.False(t, info.Hybrid())
+}
+
+func TestNewProvider(t *testing.T) {
+	fs, err := sysfs.NewFS(sysfs.DefaultMountPoint)
+	require.NoError(t, err)
+	assert.Equal(t, sysfs.DefaultMountPoint, newProvider(fs).mountPoint)
+
+	fs, err = sysfs.NewFS("testdata")
+	require.NoError(t, err)
+
+	p := newProvider(fs)
+	assert.Empty(t, p.mountPoint, "mount point of custom fs is unknown")
+
+	info, err := p.GetCPUFrequency()
+	require.NoError(t, err)
+	require.Len(t, info.Stats, 2)
+	assert.Nil(t, info.FreqStats, "stats are not read from the default mount point")
+}
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-3,8,10-11")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 8, 10, 11}, cpus)
+
+	cpus, err = parseCPUList("")
+	require.NoError(t, err)
+	assert.Empty(t, cpus)
+
+	_, err = parseCPUList("0-x")
+	require.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package dpms
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"barista.run/bar"
@@ -20,12 +23,150 @@ type Provider interface {
 	Set(enabled bool) error
 }
 
+// ErrUnsupported is returned by Info methods if the provider does not
+// support the requested operation.
+var ErrUnsupported = errors.New("operation not supported by DPMS provider")
+
+// Timeouts contains the DPMS timeouts after which the monitor is put into
+// standby, suspend or off mode. A zero timeout disables the respective mode.
+type Timeouts struct {
+	Standby time.Duration
+	Suspend time.Duration
+	Off     time.Duration
+}
+
+// MonitorState is the power level of the monitor.
+type MonitorState int
+
+// Possible monitor states.
+const (
+	MonitorUnknown MonitorState = iota
+	MonitorOn
+	MonitorStandby
+	MonitorSuspend
+	MonitorOff
+)
+
+// String implements fmt.Stringer.
+func (s MonitorState) String() string {
+	switch s {
+	case MonitorOn:
+		return "on"
+	case MonitorStandby:
+		return "standby"
+	case MonitorSuspend:
+		return "suspend"
+	case MonitorOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
+
+// Status contains the full DPMS status.
+type Status struct {
+	// Enabled is true if DPMS is enabled.
+	Enabled bool
+
+	// Timeouts are the DPMS timeouts.
+	Timeouts Timeouts
+
+	// Monitor is the monitor power level.
+	Monitor MonitorState
+
+	// Inhibitors are other processes that currently inhibit idle.
+	Inhibitors []Inhibitor
+}
+
+// Inhibitor is a process that inhibits idle and thus prevents the screen
+// from being blanked.
+type Inhibitor struct {
+	// Who is a human readable name of the inhibiting program.
+	Who string
+
+	// Why is a human readable reason for the inhibition.
+	Why string
+
+	// Mode is the inhibition mode, e.g. "block" or "delay".
+	Mode string
+
+	// UID is the user id of the inhibiting process.
+	UID uint32
+
+	// PID is the process id of the inhibiting process.
+	PID uint32
+}
+
+// String implements fmt.Stringer.
+func (i Inhibitor) String() string {
+	return fmt.Sprintf("%s (%s)", i.Who, i.Why)
+}
+
+// StatusProvider is a Provider which also supports DPMS timeouts and monitor
+// power levels. The module uses it instead of Provider.Get if the provider
+// implements it.
+type StatusProvider interface {
+	Provider
+
+	// Status retrieves the full DPMS status.
+	Status() (Status, error)
+
+	// SetTimeouts updates the DPMS timeouts.
+	SetTimeouts(timeouts Timeouts) error
+
+	// ForceMonitor forces the monitor into given power level immediately.
+	ForceMonitor(state MonitorState) error
+}
+
+// InhibitorProvider is a Provider which is able to list other processes that
+// inhibit idle. The module uses it to populate Info.Inhibitors if the provider
+// implements it.
+type InhibitorProvider interface {
+	Provider
+
+	// Inhibitors retrieves other processes that currently inhibit idle.
+	Inhibitors() ([]Inhibitor, error)
+}
+
+// WatchingProvider is a Provider which is able to notify about DPMS status
+// changes. The module refreshes its output whenever the returned channel
+// receives a value, in addition to the regular refresh interval.
+type WatchingProvider interface {
+	Provider
+
+	// Watch returns a channel which receives a value whenever the DPMS status
+	// changes.
+	Watch() (<-chan struct{}, error)
+}
+
 // Info contains the current DPMS status. It also exposes controller methods to
 // change the DPMS status.
 type Info struct {
 	Enabled bool
 
+	// Timeouts are the DPMS timeouts. Only set if the provider implements
+	// StatusProvider.
+	Timeouts Timeouts
+
+	// Monitor is the monitor power level. MonitorUnknown if the provider does
+	// not implement StatusProvider.
+	Monitor MonitorState
+
+	// Inhibitors are other processes that currently inhibit idle. Only set
+	// if the provider reports them.
+	Inhibitors []Inhibitor
+
+	// DisabledUntil is the time at which DPMS will be re-enabled
+	// automatically if it was disabled using DisableFor or AddTime. Zero if
+	// no timer is active.
+	DisabledUntil time.Time
+
+	// Rule is the name of the rule which is currently active. Empty if no
+	// rule is active.
+	Rule string
+
 	provider Provider
+	timer    *timer
 	update   func()
 }
 
@@ -35,19 +176,75 @@ func (i Info) String() string {
 		return "dpms enabled"
 	}
 
+	if remaining := i.Remaining(); remaining > 0 {
+		return fmt.Sprintf("dpms disabled (%.0fm)", math.Ceil(remaining.Minutes()))
+	}
+
+	if i.Rule != "" {
+		return fmt.Sprintf("dpms disabled (%s)", i.Rule)
+	}
+
 	return "dpms disabled"
 }
 
-// Enable enables DPMS.
+// Remaining returns the time until DPMS will be re-enabled automatically.
+// Returns zero if no timer is active.
+func (i Info) Remaining() time.Duration {
+	if i.DisabledUntil.IsZero() {
+		return 0
+	}
+
+	remaining := i.DisabledUntil.Sub(timing.Now())
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// Enable enables DPMS and stops the timer if there is one.
 func (i Info) Enable() {
 	i.setEnabled(true)
 }
 
-// Disable disables DPMS.
+// Disable disables DPMS until it is enabled again and stops the timer if
+// there is one.
 func (i Info) Disable() {
 	i.setEnabled(false)
 }
 
+// DisableFor disables DPMS and enables it again automatically after d.
+func (i Info) DisableFor(d time.Duration) {
+	if err := i.provider.Set(false); err != nil {
+		l.Log("Error updating DPMS status: %v", err)
+		return
+	}
+
+	i.timer.Set(timing.Now().Add(d))
+	i.update()
+}
+
+// AddTime adds d to the time DPMS stays disabled. If no timer is active yet,
+// DPMS is disabled for d. A negative d reduces the remaining time, DPMS is
+// enabled again if there is no time left.
+func (i Info) AddTime(d time.Duration) {
+	now := timing.Now()
+
+	until := i.timer.Until()
+	if until.IsZero() {
+		until = now
+	}
+
+	until = until.Add(d)
+
+	if !until.After(now) {
+		i.Enable()
+		return
+	}
+
+	i.DisableFor(until.Sub(now))
+}
+
 // Toggle enables DPMS if it is disabled and vice versa.
 func (i Info) Toggle() {
 	enabled, err := i.provider.Get()
@@ -59,12 +256,50 @@ func (i Info) Toggle() {
 	i.setEnabled(!enabled)
 }
 
+// SetTimeouts updates the DPMS timeouts.
+func (i Info) SetTimeouts(timeouts Timeouts) {
+	p, ok := i.provider.(StatusProvider)
+	if !ok {
+		l.Log("Error updating DPMS timeouts: %v", ErrUnsupported)
+		return
+	}
+
+	if err := p.SetTimeouts(timeouts); err != nil {
+		l.Log("Error updating DPMS timeouts: %v", err)
+		return
+	}
+
+	i.update()
+}
+
+// ForceMonitor forces the monitor into given power level immediately.
+func (i Info) ForceMonitor(state MonitorState) {
+	p, ok := i.provider.(StatusProvider)
+	if !ok {
+		l.Log("Error forcing monitor %s: %v", state, ErrUnsupported)
+		return
+	}
+
+	if err := p.ForceMonitor(state); err != nil {
+		l.Log("Error forcing monitor %s: %v", state, err)
+		return
+	}
+
+	i.update()
+}
+
+// TurnMonitorOff turns the monitor off immediately.
+func (i Info) TurnMonitorOff() {
+	i.ForceMonitor(MonitorOff)
+}
+
 func (i Info) setEnabled(enabled bool) {
 	if err := i.provider.Set(enabled); err != nil {
 		l.Log("Error updating DPMS status: %v", err)
 		return
 	}
 
+	i.timer.Set(time.Time{})
 	i.update()
 }
 
@@ -76,15 +311,22 @@ type Module struct {
 	notifyCh   <-chan struct{}
 	notifyFn   func()
 	scheduler  *timing.Scheduler
+	timer      *timer
+	rules      *rules
 }
 
 // New creates a new *Module which uses given provider to query and update the
 // DPMS status. By default, the module will refresh every minute. The refresh
-// interval can be configured using `Every`.
+// interval can be configured using `Every`. Clicking the output toggles DPMS,
+// scrolling up disables it for another 15 minutes and scrolling down reduces
+// the remaining time by 15 minutes. The scroll step can be configured using
+// `TimerStep`.
 func New(provider Provider) *Module {
 	m := &Module{
 		provider:  provider,
 		scheduler: timing.NewScheduler(),
+		timer:     newTimer(),
+		rules:     newRules(),
 	}
 
 	m.notifyFn, m.notifyCh = notifier.New()
@@ -99,22 +341,48 @@ func New(provider Provider) *Module {
 
 func defaultClickHandler(i Info) func(bar.Event) {
 	return func(e bar.Event) {
-		if e.Button == bar.ButtonLeft {
+		switch e.Button {
+		case bar.ButtonLeft:
 			i.Toggle()
+		case bar.ScrollUp:
+			i.AddTime(i.timer.Step())
+		case bar.ScrollDown:
+			i.AddTime(-i.timer.Step())
 		}
 	}
 }
 
 // Stream implements bar.Module.
 func (m *Module) Stream(s bar.Sink) {
-	enabled, err := m.provider.Get()
+	if err := m.timer.Load(); err != nil {
+		l.Log("Error loading DPMS timer state: %v", err)
+	}
+
+	m.expire()
+	m.rules.Evaluate(m.provider, m.timer)
+
+	var watchCh <-chan struct{}
+	if p, ok := m.provider.(WatchingProvider); ok {
+		var err error
+		if watchCh, err = p.Watch(); err != nil {
+			l.Log("Error watching DPMS status: %v", err)
+		}
+	}
+
+	status, err := m.getStatus()
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
 	for {
 		if !s.Error(err) {
 			info := Info{
-				Enabled:  enabled,
-				update:   m.notifyFn,
-				provider: m.provider,
+				Enabled:       status.Enabled,
+				Timeouts:      status.Timeouts,
+				Monitor:       status.Monitor,
+				Inhibitors:    status.Inhibitors,
+				DisabledUntil: m.timer.Until(),
+				Rule:          m.rules.Active(),
+				update:        m.notifyFn,
+				provider:      m.provider,
+				timer:         m.timer,
 			}
 
 			s.Output(outputs.Group(outputFunc(info)).OnClick(defaultClickHandler(info)))
@@ -124,11 +392,74 @@ func (m *Module) Stream(s bar.Sink) {
 		case <-m.outputFunc.Next():
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		case <-m.notifyCh:
-			enabled, err = m.provider.Get()
+			status, err = m.getStatus()
 		case <-m.scheduler.C:
-			enabled, err = m.provider.Get()
+			status, err = m.getStatus()
+		case _, ok := <-watchCh:
+			if !ok {
+				l.Log("Stopped watching DPMS status")
+				watchCh = nil
+			}
+			status, err = m.getStatus()
+		case <-m.timer.expiry.C:
+			m.expire()
+			status, err = m.getStatus()
+		case <-m.timer.clock.C:
+			m.reenable()
+			m.timer.ScheduleClock()
+			status, err = m.getStatus()
+		case <-m.rules.scheduler.C:
+			m.rules.Evaluate(m.provider, m.timer)
+			status, err = m.getStatus()
+		}
+	}
+}
+
+// expire enables DPMS if the timer expired.
+func (m *Module) expire() {
+	if m.timer.Expired() {
+		m.reenable()
+	}
+}
+
+// reenable enables DPMS and stops the timer. While a rule is active, DPMS
+// stays disabled and is enabled once no rule is active anymore instead.
+func (m *Module) reenable() {
+	if m.rules.DeferReenable() {
+		m.timer.Set(time.Time{})
+		return
+	}
+
+	if err := m.provider.Set(true); err != nil {
+		l.Log("Error re-enabling DPMS: %v", err)
+		return
+	}
+
+	m.timer.Set(time.Time{})
+}
+
+func (m *Module) getStatus() (Status, error) {
+	var status Status
+	var err error
+
+	if p, ok := m.provider.(StatusProvider); ok {
+		status, err = p.Status()
+	} else {
+		status.Enabled, err = m.provider.Get()
+	}
+
+	if err != nil {
+		return Status{}, err
+	}
+
+	if p, ok := m.provider.(InhibitorProvider); ok {
+		status.Inhibitors, err = p.Inhibitors()
+		if err != nil {
+			return Status{}, err
 		}
 	}
+
+	return status, nil
 }
 
 // Output updates the output format func.
@@ -148,6 +479,53 @@ func (m *Module) Every(interval time.Duration) *Module {
 	return m
 }
 
+// TimerStep configures the duration that is added to or removed from the
+// timer when scrolling the output, e.g. 15, 30 or 60 minutes.
+func (m *Module) TimerStep(step time.Duration) *Module {
+	m.timer.Lock()
+	defer m.timer.Unlock()
+	m.timer.step = step
+	return m
+}
+
+// ReenableAt configures a time of day at which DPMS is re-enabled if it is
+// disabled, regardless of whether a timer is active or it was disabled
+// manually. This avoids having DPMS disabled overnight.
+func (m *Module) ReenableAt(hour, minute int) *Module {
+	m.timer.SetReenableAt(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	return m
+}
+
+// StateFile configures a file in which the timer state is persisted, so that
+// an active timer survives bar restarts. If the timer expired while the bar
+// was not running, DPMS is re-enabled on start.
+func (m *Module) StateFile(path string) *Module {
+	m.timer.Lock()
+	defer m.timer.Unlock()
+	m.timer.stateFile = path
+	return m
+}
+
+// Rules configures rules which automatically disable DPMS while one of them
+// is active, e.g. during quiet hours or while a presentation tool is running.
+// Rules are evaluated in order and the first active rule wins. DPMS is
+// re-enabled once no rule is active anymore if it was enabled before. Manual
+// changes to the DPMS status are respected until the active rule changes. A
+// timer or ReenableAt that expires while a rule is active does not enable
+// DPMS, it is enabled once no rule is active anymore instead.
+func (m *Module) Rules(rules ...Rule) *Module {
+	m.rules.Set(rules)
+	return m
+}
+
+// EvaluateEvery configures the interval in which rules are evaluated.
+// Defaults to 10 seconds. Passing a zero interval will disable periodic
+// evaluation.
+func (m *Module) EvaluateEvery(interval time.Duration) *Module {
+	m.rules.SetInterval(interval)
+	return m
+}
+
 // Refresh forces a refresh of the module output.
 func (m *Module) Refresh() {
 	m.notifyFn()
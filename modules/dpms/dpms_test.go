@@ -2,12 +2,19 @@ package dpms
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"barista.run/bar"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testProvider struct {
@@ -106,3 +113,488 @@ func TestModule(t *testing.T) {
 	out = testBar.NextOutput("error")
 	out.AssertText([]string{"dpms: true"})
 }
+
+type testStatusProvider struct {
+	testProvider
+	timeouts Timeouts
+	monitor  MonitorState
+}
+
+func (p *testStatusProvider) Status() (Status, error) {
+	enabled, err := p.Get()
+	if err != nil {
+		return Status{}, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	status := Status{
+		Enabled:  enabled,
+		Timeouts: p.timeouts,
+		Monitor:  p.monitor,
+	}
+
+	return status, nil
+}
+
+func (p *testStatusProvider) SetTimeouts(timeouts Timeouts) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+
+	p.timeouts = timeouts
+	return nil
+}
+
+func (p *testStatusProvider) ForceMonitor(state MonitorState) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+
+	p.monitor = state
+	return nil
+}
+
+func TestModule_StatusProvider(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testStatusProvider{
+		testProvider: testProvider{enabled: true},
+		timeouts:     Timeouts{Standby: time.Minute, Suspend: 2 * time.Minute, Off: 3 * time.Minute},
+		monitor:      MonitorOn,
+	}
+
+	m := New(testProvider).Output(func(info Info) bar.Output {
+		return outputs.Textf("%v %v/%v/%v %s", info.Enabled,
+			info.Timeouts.Standby, info.Timeouts.Suspend, info.Timeouts.Off, info.Monitor).
+			OnClick(func(e bar.Event) {
+				switch e.Button {
+				case bar.ButtonLeft:
+					info.SetTimeouts(Timeouts{Off: 10 * time.Minute})
+				case bar.ButtonRight:
+					info.TurnMonitorOff()
+				}
+			})
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"true 1m0s/2m0s/3m0s on"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("timeouts changed")
+	out.AssertText([]string{"true 0s/0s/10m0s on"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("monitor turned off")
+	out.AssertText([]string{"true 0s/0s/10m0s off"})
+
+	testProvider.setError(errors.New("whoops"))
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	testBar.AssertNoOutput("error while setting timeouts")
+}
+
+func TestModule_UnsupportedOperations(t *testing.T) {
+	testBar.New(t)
+
+	m := New(&testProvider{enabled: true}).Output(func(info Info) bar.Output {
+		return outputs.Textf("%v %v %s", info.Enabled, info.Timeouts.Off, info.Monitor).
+			OnClick(func(e bar.Event) {
+				info.SetTimeouts(Timeouts{Off: time.Minute})
+				info.TurnMonitorOff()
+			})
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"true 0s unknown"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	testBar.AssertNoOutput("unsupported operations are ignored")
+}
+
+func TestModule_Timer(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		enabled: true,
+	}
+
+	m := New(testProvider).Every(0)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"dpms enabled"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("timer started")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("time added")
+	out.AssertText([]string{"dpms disabled (30m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("time removed")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	timing.AdvanceBy(10 * time.Minute)
+	m.Refresh()
+	out = testBar.NextOutput("countdown")
+	out.AssertText([]string{"dpms disabled (5m)"})
+
+	timing.AdvanceBy(5 * time.Minute)
+	out = testBar.NextOutput("timer expired")
+	out.AssertText([]string{"dpms enabled"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("timer started")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("toggled")
+	out.AssertText([]string{"dpms enabled"})
+
+	timing.AdvanceBy(15 * time.Minute)
+	testBar.AssertNoOutput("timer stopped by toggle")
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("timer started")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("no time left")
+	out.AssertText([]string{"dpms enabled"})
+}
+
+func TestModule_ReenableAt(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		enabled: false,
+	}
+
+	now := timing.Now()
+	reenableAt := now.Add(2 * time.Hour)
+
+	m := New(testProvider).Every(0).TimerStep(time.Hour).ReenableAt(reenableAt.Hour(), reenableAt.Minute())
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"dpms disabled"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("timer started")
+	out.AssertText([]string{"dpms disabled (60m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.LatestOutput("time added")
+	out.AssertText([]string{"dpms disabled (180m)"})
+
+	timing.AdvanceTo(reenableAt)
+	out = testBar.NextOutput("re-enabled at time of day")
+	out.AssertText([]string{"dpms enabled"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("disabled manually")
+	out.AssertText([]string{"dpms disabled"})
+
+	timing.AdvanceBy(24 * time.Hour)
+	out = testBar.NextOutput("re-enabled on the next day")
+	out.AssertText([]string{"dpms enabled"})
+}
+
+func TestModule_StateFile(t *testing.T) {
+	testBar.New(t)
+
+	dir, err := ioutil.TempDir("", "dpms")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state")
+	until := timing.Now().Add(20 * time.Minute)
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte(until.Format(time.RFC3339)), 0644))
+
+	testProvider := &testProvider{
+		enabled: false,
+	}
+
+	m := New(testProvider).Every(0).StateFile(stateFile)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("timer restored")
+	out.AssertText([]string{"dpms disabled (20m)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("time added")
+	out.AssertText([]string{"dpms disabled (35m)"})
+
+	buf, err := ioutil.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.Equal(t, until.Add(15*time.Minute).Format(time.RFC3339), string(buf))
+
+	timing.AdvanceBy(35 * time.Minute)
+	out = testBar.NextOutput("timer expired")
+	out.AssertText([]string{"dpms enabled"})
+
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestModule_StateFileExpired(t *testing.T) {
+	testBar.New(t)
+
+	dir, err := ioutil.TempDir("", "dpms")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state")
+	until := timing.Now().Add(-time.Minute)
+	require.NoError(t, ioutil.WriteFile(stateFile, []byte(until.Format(time.RFC3339)), 0644))
+
+	testProvider := &testProvider{
+		enabled: false,
+	}
+
+	m := New(testProvider).StateFile(stateFile)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("re-enabled on start")
+	out.AssertText([]string{"dpms enabled"})
+}
+
+type testInhibitorProvider struct {
+	testProvider
+	inhibitors []Inhibitor
+}
+
+func (p *testInhibitorProvider) Inhibitors() ([]Inhibitor, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return p.inhibitors, nil
+}
+
+func TestModule_InhibitorProvider(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testInhibitorProvider{
+		testProvider: testProvider{enabled: true},
+		inhibitors: []Inhibitor{
+			{Who: "firefox", Why: "Playing video", Mode: "block", UID: 1000, PID: 2345},
+		},
+	}
+
+	m := New(testProvider).Output(func(info Info) bar.Output {
+		return outputs.Textf("%v %v", info.Enabled, info.Inhibitors)
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"true [firefox (Playing video)]"})
+}
+
+type testWatchingProvider struct {
+	testProvider
+	ch chan struct{}
+}
+
+func (p *testWatchingProvider) Watch() (<-chan struct{}, error) {
+	return p.ch, nil
+}
+
+func TestModule_WatchingProvider(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testWatchingProvider{
+		testProvider: testProvider{enabled: true},
+		ch:           make(chan struct{}),
+	}
+
+	m := New(testProvider)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"dpms enabled"})
+
+	testProvider.Lock()
+	testProvider.enabled = false
+	testProvider.Unlock()
+
+	testProvider.ch <- struct{}{}
+	out = testBar.NextOutput("status changed")
+	out.AssertText([]string{"dpms disabled"})
+
+	close(testProvider.ch)
+	out = testBar.NextOutput("watch channel closed")
+	out.AssertText([]string{"dpms disabled"})
+
+	testBar.AssertNoOutput("closed watch channel is ignored")
+}
+
+func TestModule_Rules(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		enabled: true,
+	}
+
+	var mu sync.Mutex
+	presenting, gaming := false, false
+
+	m := New(testProvider).Every(0).Rules(
+		NewRule("presentation", ConditionFunc(func() (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return presenting, nil
+		})),
+		NewRule("gaming", ConditionFunc(func() (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return gaming, nil
+		})),
+	)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"dpms enabled"})
+
+	mu.Lock()
+	presenting = true
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule activated")
+	out.AssertText([]string{"dpms disabled (presentation)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("enabled manually")
+	out.AssertText([]string{"dpms enabled"})
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule still active")
+	out.AssertText([]string{"dpms enabled"}, "manual toggle is not overridden")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("disabled manually")
+	out.AssertText([]string{"dpms disabled (presentation)"})
+
+	mu.Lock()
+	presenting = false
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule deactivated")
+	out.AssertText([]string{"dpms enabled"})
+
+	testProvider.Lock()
+	testProvider.enabled = false
+	testProvider.Unlock()
+
+	mu.Lock()
+	presenting = true
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule activated while disabled")
+	out.AssertText([]string{"dpms disabled (presentation)"})
+
+	mu.Lock()
+	presenting = false
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule deactivated")
+	out.AssertText([]string{"dpms disabled"}, "not re-enabled if it was disabled before")
+
+	testProvider.Lock()
+	testProvider.enabled = true
+	testProvider.Unlock()
+
+	mu.Lock()
+	presenting = true
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rule activated")
+	out.AssertText([]string{"dpms disabled (presentation)"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("enabled manually")
+	out.AssertText([]string{"dpms enabled"})
+
+	mu.Lock()
+	presenting, gaming = false, true
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("other rule activated")
+	out.AssertText([]string{"dpms disabled (gaming)"}, "rule is applied on direct transition")
+
+	mu.Lock()
+	gaming = false
+	mu.Unlock()
+
+	timing.NextTick()
+	out = testBar.NextOutput("rules deactivated")
+	out.AssertText([]string{"dpms enabled"}, "re-enabled as before the first rule")
+}
+
+func TestModule_RulesTimer(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		enabled: true,
+	}
+
+	var mu sync.Mutex
+	presenting := false
+
+	m := New(testProvider).Every(0).EvaluateEvery(time.Minute).Rules(
+		NewRule("presentation", ConditionFunc(func() (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return presenting, nil
+		})),
+	)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"dpms enabled"})
+
+	// Do not let the timer expire at the same time the rules are evaluated.
+	timing.AdvanceBy(30 * time.Second)
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("timer started")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	mu.Lock()
+	presenting = true
+	mu.Unlock()
+
+	timing.AdvanceBy(30 * time.Second)
+	out = testBar.NextOutput("rule activated")
+	out.AssertText([]string{"dpms disabled (15m)"})
+
+	timing.AdvanceBy(14*time.Minute + 30*time.Second)
+	out = testBar.LatestOutput("timer expired")
+	out.AssertText([]string{"dpms disabled (presentation)"}, "timer does not override the active rule")
+
+	mu.Lock()
+	presenting = false
+	mu.Unlock()
+
+	timing.AdvanceBy(30 * time.Second)
+	out = testBar.NextOutput("rule deactivated")
+	out.AssertText([]string{"dpms enabled"}, "re-enabled once the rule is inactive")
+}
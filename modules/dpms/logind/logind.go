@@ -0,0 +1,210 @@
+// Package logind contains a dpms.Provider which prevents the screen from being
+// blanked by holding a systemd-logind idle inhibitor lock. This works
+// independently of the desktop environment as long as the idle manager
+// respects logind inhibitors.
+//
+// The lock is the file descriptor returned by the Inhibit method of logind,
+// which is held for as long as DPMS is disabled. Logind releases the lock as
+// soon as the file descriptor is closed, which also happens if the bar exits.
+// DPMS is reported as enabled while no lock is held.
+package logind
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/martinohmann/barista-contrib/internal/dbus"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+)
+
+const (
+	logindService   = "org.freedesktop.login1"
+	logindPath      = "/org/freedesktop/login1"
+	logindInterface = "org.freedesktop.login1.Manager"
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// logind DPMS provider.
+type Option func(p *Provider)
+
+// Who configures the name of the program that is reported to logind as the
+// lock owner. Defaults to "barista".
+func Who(who string) Option {
+	return func(p *Provider) {
+		p.who = who
+	}
+}
+
+// Why configures the reason for the inhibitor lock that is reported to
+// logind. Defaults to "DPMS disabled in bar".
+func Why(why string) Option {
+	return func(p *Provider) {
+		p.why = why
+	}
+}
+
+// New creates a new *dpms.Module using systemd-logind idle inhibitor locks as
+// DPMS provider.
+func New(options ...Option) *dpms.Module {
+	return dpms.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{
+		who: "barista",
+		why: "DPMS disabled in bar",
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is a dpms.InhibitorProvider which takes and releases
+// systemd-logind idle inhibitor locks. It talks to logind via the system bus.
+type Provider struct {
+	sync.Mutex
+	who  string
+	why  string
+	lock *os.File
+}
+
+// Get implements dpms.Provider. DPMS is considered enabled if the provider
+// does not hold an idle inhibitor lock.
+func (p *Provider) Get() (bool, error) {
+	p.Lock()
+	defer p.Unlock()
+	return p.lock == nil, nil
+}
+
+// Set implements dpms.Provider. Disabling DPMS takes an idle inhibitor lock,
+// enabling it releases the lock again.
+func (p *Provider) Set(enabled bool) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if enabled {
+		return p.release()
+	}
+
+	return p.acquire()
+}
+
+func (p *Provider) acquire() error {
+	if p.lock != nil {
+		return nil
+	}
+
+	reply, err := call("Inhibit", "ssss", "idle", p.who, p.why, "block")
+	if err != nil {
+		return err
+	}
+
+	if reply.Signature != "h" {
+		return fmt.Errorf("unexpected Inhibit response of type %q", reply.Signature)
+	}
+
+	p.lock = reply.Body[0].(*os.File)
+
+	return nil
+}
+
+func (p *Provider) release() error {
+	if p.lock == nil {
+		return nil
+	}
+
+	lock := p.lock
+	p.lock = nil
+
+	return lock.Close()
+}
+
+// Inhibitors implements dpms.InhibitorProvider. The lock held by the
+// provider itself is not included.
+func (p *Provider) Inhibitors() ([]dpms.Inhibitor, error) {
+	reply, err := call("ListInhibitors", "")
+	if err != nil {
+		return nil, err
+	}
+
+	inhibitors, err := parseInhibitors(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	result := make([]dpms.Inhibitor, 0, len(inhibitors))
+	for _, inhibitor := range inhibitors {
+		if !strings.Contains(inhibitor.what, "idle") {
+			continue
+		}
+
+		if p.lock != nil && p.isOwn(inhibitor.Inhibitor) {
+			continue
+		}
+
+		result = append(result, inhibitor.Inhibitor)
+	}
+
+	return result, nil
+}
+
+// isOwn returns true if in is the lock taken by the provider. Logind reports
+// the pid of the process which called Inhibit, which is the bar itself.
+func (p *Provider) isOwn(in dpms.Inhibitor) bool {
+	return int(in.PID) == os.Getpid() && in.Who == p.who && in.Why == p.why
+}
+
+// call calls a method of the logind manager on a new connection to the
+// system bus. Inhibitor locks stay valid after the connection is closed.
+func call(method string, sig dbus.Signature, args ...interface{}) (*dbus.Message, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.Call(logindService, logindPath, logindInterface, method, sig, args...)
+}
+
+type inhibitor struct {
+	dpms.Inhibitor
+	what string
+}
+
+// parseInhibitors parses the reply to the ListInhibitors method call, which
+// has the signature a(ssssuu).
+func parseInhibitors(reply *dbus.Message) ([]inhibitor, error) {
+	if reply.Signature != "a(ssssuu)" {
+		return nil, fmt.Errorf("unexpected ListInhibitors response of type %q", reply.Signature)
+	}
+
+	rows := reply.Body[0].([]interface{})
+	inhibitors := make([]inhibitor, len(rows))
+
+	for i, row := range rows {
+		fields := row.([]interface{})
+
+		inhibitors[i] = inhibitor{
+			what: fields[0].(string),
+			Inhibitor: dpms.Inhibitor{
+				Who:  fields[1].(string),
+				Why:  fields[2].(string),
+				Mode: fields[3].(string),
+				UID:  fields[4].(uint32),
+				PID:  fields[5].(uint32),
+			},
+		}
+	}
+
+	return inhibitors, nil
+}
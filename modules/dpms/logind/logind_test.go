@@ -0,0 +1,180 @@
+package logind
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/dbus"
+	"github.com/martinohmann/barista-contrib/internal/dbus/dbustest"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLogind is a stub logind service on a private bus. Inhibitor locks are
+// pipes whose read end is kept by the stub, like logind does.
+type fakeLogind struct {
+	mu         sync.Mutex
+	conn       *dbus.Conn
+	inhibitors []interface{}
+	locks      []*os.File
+}
+
+// startLogind starts a private dbus-daemon with a stub logind service and
+// points the provider to it. The test is skipped if dbus-daemon is not
+// installed.
+func startLogind(t *testing.T) *fakeLogind {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	daemon, err := dbustest.StartDaemon()
+	require.NoError(t, err)
+
+	conn, err := dbus.Dial(daemon.Address)
+	require.NoError(t, err)
+	require.NoError(t, conn.RequestName(logindService))
+
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	os.Setenv("DBUS_SYSTEM_BUS_ADDRESS", daemon.Address)
+
+	l := &fakeLogind{
+		conn: conn,
+		inhibitors: []interface{}{
+			[]interface{}{"sleep", "NetworkManager", "NetworkManager needs to turn off networks", "delay", uint32(0), uint32(1011)},
+			[]interface{}{"idle:sleep", "firefox", "Playing video", "block", uint32(1000), uint32(2345)},
+		},
+	}
+
+	conn.HandleCalls(l.handle)
+
+	t.Cleanup(func() {
+		os.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+		conn.Close()
+		daemon.Close()
+
+		for _, lock := range l.locks {
+			lock.Close()
+		}
+	})
+
+	return l
+}
+
+func (l *fakeLogind) handle(call *dbus.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if call.Path != logindPath || call.Interface != logindInterface {
+		_ = l.conn.ReplyError(call, "org.freedesktop.DBus.Error.UnknownObject", "unknown object")
+		return
+	}
+
+	switch call.Member {
+	case "Inhibit":
+		r, w, err := os.Pipe()
+		if err != nil {
+			_ = l.conn.ReplyError(call, "org.freedesktop.DBus.Error.Failed", err.Error())
+			return
+		}
+		defer w.Close()
+
+		l.locks = append(l.locks, r)
+		l.inhibitors = append(l.inhibitors, []interface{}{
+			call.Body[0], call.Body[1], call.Body[2], call.Body[3], uint32(os.Getuid()), uint32(os.Getpid()),
+		})
+
+		_ = l.conn.Reply(call, "h", w)
+	case "ListInhibitors":
+		_ = l.conn.Reply(call, "a(ssssuu)", l.active())
+	default:
+		_ = l.conn.ReplyError(call, "org.freedesktop.DBus.Error.UnknownMethod", "unknown method")
+	}
+}
+
+// active returns the inhibitors whose locks were not released yet, which is
+// detected by the write end of the pipe being closed.
+func (l *fakeLogind) active() []interface{} {
+	offset := len(l.inhibitors) - len(l.locks)
+	inhibitors := l.inhibitors[:offset]
+
+	for i, lock := range l.locks {
+		if !released(lock) {
+			inhibitors = append(inhibitors, l.inhibitors[offset+i])
+		}
+	}
+
+	return inhibitors
+}
+
+func released(r *os.File) bool {
+	_ = r.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+
+	_, err := r.Read(make([]byte, 1))
+
+	return !os.IsTimeout(err)
+}
+
+func TestProvider(t *testing.T) {
+	startLogind(t)
+
+	p := NewProvider(Who("bar"), Why("testing"))
+
+	enabled, err := p.Get()
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	require.NoError(t, p.Set(false))
+	require.NoError(t, p.Set(false))
+
+	enabled, err = p.Get()
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	inhibitors, err := p.Inhibitors()
+	require.NoError(t, err)
+
+	expected := []dpms.Inhibitor{
+		{Who: "firefox", Why: "Playing video", Mode: "block", UID: 1000, PID: 2345},
+	}
+
+	assert.Equal(t, expected, inhibitors, "own lock is taken once and excluded")
+
+	require.NoError(t, p.Set(true))
+
+	enabled, err = p.Get()
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	inhibitors, err = p.Inhibitors()
+	require.NoError(t, err)
+	assert.Equal(t, expected, inhibitors, "own lock is released")
+
+	other := NewProvider(Who("other"), Why("testing"))
+	require.NoError(t, other.Set(false))
+	defer other.Set(true)
+
+	inhibitors, err = p.Inhibitors()
+	require.NoError(t, err)
+	assert.Len(t, inhibitors, 2, "locks of others are included")
+}
+
+func TestProvider_Error(t *testing.T) {
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	os.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path=/nonexistent")
+	defer os.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+
+	p := NewProvider()
+
+	require.Error(t, p.Set(false))
+
+	enabled, err := p.Get()
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	_, err = p.Inhibitors()
+	require.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package dpms
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+	"barista.run/timing"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+)
+
+// Condition decides whether a rule is active.
+type Condition interface {
+	// Active returns true if the condition is currently met.
+	Active() (bool, error)
+}
+
+// ConditionFunc is a func that satisfies the Condition interface.
+type ConditionFunc func() (bool, error)
+
+// Active implements Condition.
+func (f ConditionFunc) Active() (bool, error) {
+	return f()
+}
+
+// Rule disables DPMS while its condition is active.
+type Rule struct {
+	// Name is a human readable name of the rule which is exposed via
+	// Info.Rule while the rule is active.
+	Name string
+
+	// Condition decides whether the rule is active.
+	Condition Condition
+}
+
+// NewRule creates a new Rule with name and condition.
+func NewRule(name string, condition Condition) Rule {
+	return Rule{Name: name, Condition: condition}
+}
+
+// QuietHours returns a Condition that is active between the start and end
+// time of day, e.g. QuietHours(22, 0, 7, 0) is active from 10pm until 7am.
+func QuietHours(startHour, startMinute, endHour, endMinute int) Condition {
+	start := time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute
+	end := time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute
+
+	return ConditionFunc(func() (bool, error) {
+		now := timing.Now()
+		year, month, day := now.Date()
+		offset := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+
+		if start <= end {
+			return offset >= start && offset < end, nil
+		}
+
+		// The quiet hours span midnight.
+		return offset >= start || offset < end, nil
+	})
+}
+
+// ProcessRunning returns a Condition that is active while a process with one
+// of the given names is running. Names are matched exactly against the
+// process name using pgrep.
+func ProcessRunning(names ...string) Condition {
+	return ConditionFunc(func() (bool, error) {
+		for _, name := range names {
+			err := exec.CommandRun("pgrep", "-x", name)
+			if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+				// pgrep exits with status 1 if no process matched.
+				continue
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			return true, nil
+		}
+
+		return false, nil
+	})
+}
+
+// MatchClass returns true if class matches any of the glob patterns, ignoring
+// case. If no patterns are provided, every class matches. It is used by
+// fullscreen conditions of the DPMS providers to match window classes or app
+// ids.
+func MatchClass(class string, patterns ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	class = strings.ToLower(class)
+
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), class); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rules evaluates rules and keeps track of the active one.
+type rules struct {
+	sync.Mutex
+	rules     []Rule
+	active    string
+	reenable  bool
+	interval  time.Duration
+	scheduler *timing.Scheduler
+
+	// evaluating serializes evaluations, which run without holding the
+	// lock because conditions and providers may block.
+	evaluating sync.Mutex
+}
+
+func newRules() *rules {
+	return &rules{
+		interval:  10 * time.Second,
+		scheduler: timing.NewScheduler(),
+	}
+}
+
+// Set replaces the rules.
+func (r *rules) Set(rules []Rule) {
+	r.Lock()
+	defer r.Unlock()
+	r.rules = rules
+	r.schedule()
+}
+
+// SetInterval sets the interval in which rules are evaluated.
+func (r *rules) SetInterval(interval time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	r.interval = interval
+	r.schedule()
+}
+
+func (r *rules) schedule() {
+	if len(r.rules) == 0 || r.interval == 0 {
+		r.scheduler.Stop()
+	} else {
+		r.scheduler.Every(r.interval)
+	}
+}
+
+// Active returns the name of the active rule. Returns an empty string if no
+// rule is active.
+func (r *rules) Active() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.active
+}
+
+// DeferReenable makes DPMS get enabled once no rule is active anymore.
+// Returns false if no rule is active, in which case the caller should enable
+// DPMS itself.
+func (r *rules) DeferReenable() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.active == "" {
+		return false
+	}
+
+	r.reenable = true
+
+	return true
+}
+
+// Evaluate evaluates the rules in order and updates the DPMS status via
+// provider if the active rule changed. DPMS is disabled when a rule becomes
+// active, including when another rule takes over from the active one, and
+// re-enabled once no rule is active anymore, but only if it was enabled
+// before the first rule became active. While the active rule does not
+// change, the DPMS status is left alone so that manual changes are not
+// overridden.
+func (r *rules) Evaluate(provider Provider, t *timer) {
+	r.evaluating.Lock()
+	defer r.evaluating.Unlock()
+
+	r.Lock()
+	rules, prev, reenable := r.rules, r.active, r.reenable
+	r.Unlock()
+
+	if len(rules) == 0 {
+		return
+	}
+
+	active := ""
+
+	for _, rule := range rules {
+		ok, err := rule.Condition.Active()
+		if err != nil {
+			l.Log("Error evaluating DPMS rule %q: %v", rule.Name, err)
+			return
+		}
+
+		if ok {
+			active = rule.Name
+			break
+		}
+	}
+
+	if active == prev {
+		return
+	}
+
+	if active == "" {
+		// Do not interfere with a timer that was started while the rule was
+		// active.
+		if reenable && t.Until().IsZero() {
+			if err := provider.Set(true); err != nil {
+				l.Log("Error re-enabling DPMS after rule %q: %v", prev, err)
+				return
+			}
+		}
+
+		reenable = false
+	} else {
+		enabled, err := provider.Get()
+		if err != nil {
+			l.Log("Error obtaining DPMS status: %v", err)
+			return
+		}
+
+		if enabled {
+			if err := provider.Set(false); err != nil {
+				l.Log("Error disabling DPMS for rule %q: %v", active, err)
+				return
+			}
+		}
+
+		// Keep the state from before the first rule became active when
+		// another rule takes over.
+		if prev == "" {
+			reenable = enabled
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.active = active
+	r.reenable = reenable
+}
@@ -0,0 +1,72 @@
+package dpms
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/timing"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		timeOfDay time.Duration
+		expected  bool
+	}{
+		{name: "before", condition: QuietHours(9, 0, 17, 30), timeOfDay: 8 * time.Hour, expected: false},
+		{name: "start", condition: QuietHours(9, 0, 17, 30), timeOfDay: 9 * time.Hour, expected: true},
+		{name: "between", condition: QuietHours(9, 0, 17, 30), timeOfDay: 17 * time.Hour, expected: true},
+		{name: "end", condition: QuietHours(9, 0, 17, 30), timeOfDay: 17*time.Hour + 30*time.Minute, expected: false},
+		{name: "overnight evening", condition: QuietHours(22, 0, 7, 0), timeOfDay: 23 * time.Hour, expected: true},
+		{name: "overnight morning", condition: QuietHours(22, 0, 7, 0), timeOfDay: 6 * time.Hour, expected: true},
+		{name: "overnight day", condition: QuietHours(22, 0, 7, 0), timeOfDay: 12 * time.Hour, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timing.TestMode()
+
+			now := timing.Now()
+			year, month, day := now.Date()
+			timing.AdvanceTo(time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Add(test.timeOfDay))
+
+			active, err := test.condition.Active()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, active)
+		})
+	}
+}
+
+func TestProcessRunning(t *testing.T) {
+	running := "impressive"
+
+	defer exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		if cmd.Matches("pgrep", "-x", running) {
+			return nil
+		}
+
+		return &exec.ExitError{ProcessState: &exec.FakeProcessState{ExitStatus: 1}}
+	})()
+
+	active, err := ProcessRunning("pdfpc", "impressive").Active()
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	running = "firefox"
+
+	active, err = ProcessRunning("pdfpc", "impressive").Active()
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestMatchClass(t *testing.T) {
+	assert.True(t, MatchClass("mpv"))
+	assert.True(t, MatchClass("mpv", "vlc", "mpv"))
+	assert.True(t, MatchClass("Firefox", "firefox"))
+	assert.True(t, MatchClass("chromium-browser", "chromium*"))
+	assert.False(t, MatchClass("kitty", "mpv", "vlc"))
+}
@@ -0,0 +1,423 @@
+// Package sway contains a dpms.Provider for the sway Wayland compositor.
+//
+// Sway does not have a DPMS setting like X11. Instead, idle blanking is
+// usually handled by swayidle. Disabling DPMS therefore inhibits idle for all
+// open views via the inhibit_idle command, which keeps any swayidle instance
+// from running its timeouts, including one started by the user. Enabling DPMS
+// restores the previous idle inhibitors of the views. DPMS is reported as
+// enabled while no view is inhibited by the provider. Views opened after DPMS
+// was disabled are not inhibited, and closing all inhibited views enables
+// DPMS again.
+//
+// If a Timeout is configured, the provider additionally starts and owns a
+// swayidle process which powers off all outputs after the timeout.
+package sway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+)
+
+// markPrefix is the prefix of the marks which store the original idle
+// inhibitor of views inhibited by the provider. Marks starting with an
+// underscore are not displayed by sway.
+const markPrefix = "_barista_dpms_"
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// sway DPMS provider.
+type Option func(p *Provider)
+
+// Timeout configures the idle timeout after which all outputs are powered
+// off by a swayidle process owned by the provider. Without a timeout no
+// swayidle process is started, which is what you want if swayidle is already
+// started by the sway config. The timeout must be at least one second.
+func Timeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// SwayidleArgs configures additional args that are passed to the swayidle
+// process owned by the provider, e.g. to lock the screen before sleep:
+//
+//	sway.SwayidleArgs("before-sleep", "swaylock -f")
+func SwayidleArgs(args ...string) Option {
+	return func(p *Provider) {
+		p.args = args
+	}
+}
+
+// New creates a new *dpms.Module using sway as DPMS provider.
+func New(options ...Option) *dpms.Module {
+	return dpms.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is a dpms.StatusProvider for sway.
+type Provider struct {
+	sync.Mutex
+	timeout time.Duration
+	args    []string
+	process exec.Process
+}
+
+// Get implements dpms.Provider. DPMS is considered enabled if no view is
+// inhibited by the provider.
+func (p *Provider) Get() (bool, error) {
+	if err := p.startSwayidle(); err != nil {
+		return false, err
+	}
+
+	views, err := p.views()
+	if err != nil {
+		return false, err
+	}
+
+	for _, view := range views {
+		if _, ok := view.inhibitMark(); ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Set implements dpms.Provider. Disabling DPMS inhibits idle for all open
+// views, enabling it restores their previous idle inhibitors.
+func (p *Provider) Set(enabled bool) error {
+	if err := p.startSwayidle(); err != nil {
+		return err
+	}
+
+	views, err := p.views()
+	if err != nil {
+		return err
+	}
+
+	var cmds []string
+
+	for _, view := range views {
+		mark, inhibited := view.inhibitMark()
+
+		switch {
+		case enabled && inhibited:
+			mode := strings.TrimPrefix(mark, fmt.Sprintf("%s%d_", markPrefix, view.ID))
+			cmds = append(cmds, fmt.Sprintf("[con_id=%d] inhibit_idle %s, unmark %s", view.ID, mode, mark))
+		case !enabled && !inhibited:
+			mode := view.IdleInhibitors.User
+			if mode == "" {
+				mode = "none"
+			}
+
+			mark := fmt.Sprintf("%s%d_%s", markPrefix, view.ID, mode)
+			cmds = append(cmds, fmt.Sprintf("[con_id=%d] mark --add %s, inhibit_idle open", view.ID, mark))
+		}
+	}
+
+	if !enabled && len(views) == 0 {
+		return errors.New("no open view to inhibit idle for")
+	}
+
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	return exec.CommandRun("swaymsg", strings.Join(cmds, "; "))
+}
+
+// Status implements dpms.StatusProvider. The off timeout is only known if a
+// Timeout was configured.
+func (p *Provider) Status() (dpms.Status, error) {
+	enabled, err := p.Get()
+	if err != nil {
+		return dpms.Status{}, err
+	}
+
+	monitor, err := p.monitorState()
+	if err != nil {
+		return dpms.Status{}, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	status := dpms.Status{
+		Enabled:  enabled,
+		Timeouts: dpms.Timeouts{Off: p.timeout},
+		Monitor:  monitor,
+	}
+
+	return status, nil
+}
+
+// SetTimeouts implements dpms.StatusProvider. Only the off timeout is
+// supported. The swayidle process owned by the provider is restarted to
+// apply the new timeout.
+func (p *Provider) SetTimeouts(timeouts dpms.Timeouts) error {
+	if timeouts.Standby != 0 || timeouts.Suspend != 0 {
+		return fmt.Errorf("standby and suspend timeouts are not supported by sway: %w", dpms.ErrUnsupported)
+	}
+
+	if err := validateTimeout(timeouts.Off); err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.timeout = timeouts.Off
+	process := p.process
+	p.process = nil
+	p.Unlock()
+
+	if process != nil {
+		if err := process.Kill(); err != nil {
+			return err
+		}
+	}
+
+	return p.startSwayidle()
+}
+
+func validateTimeout(timeout time.Duration) error {
+	if timeout < time.Second {
+		return fmt.Errorf("invalid swayidle timeout %s: must be at least 1s", timeout)
+	}
+
+	return nil
+}
+
+// startSwayidle starts the swayidle process owned by the provider if a
+// timeout is configured and the process is not running yet.
+func (p *Provider) startSwayidle() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.process != nil || p.timeout == 0 {
+		return nil
+	}
+
+	if err := validateTimeout(p.timeout); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-w",
+		"timeout", strconv.Itoa(int(p.timeout / time.Second)),
+		"swaymsg 'output * power off'",
+		"resume", "swaymsg 'output * power on'",
+	}
+
+	process, err := exec.CommandStart("swayidle", append(args, p.args...)...)
+	if err != nil {
+		return err
+	}
+
+	p.process = process
+
+	go p.wait(process)
+
+	return nil
+}
+
+// wait waits for process to exit and forgets about it afterwards, so that it
+// is started again on the next refresh.
+func (p *Provider) wait(process exec.Process) {
+	err := process.Wait()
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.process != process {
+		// Process was killed by us.
+		return
+	}
+
+	l.Log("swayidle exited unexpectedly: %v", err)
+	p.process = nil
+}
+
+// ForceMonitor implements dpms.StatusProvider. Sway outputs can only be
+// powered on or off.
+func (p *Provider) ForceMonitor(state dpms.MonitorState) error {
+	switch state {
+	case dpms.MonitorOn:
+		return exec.CommandRun("swaymsg", "output", "*", "power", "on")
+	case dpms.MonitorOff:
+		return exec.CommandRun("swaymsg", "output", "*", "power", "off")
+	default:
+		return fmt.Errorf("monitor state %q is not supported by sway: %w", state, dpms.ErrUnsupported)
+	}
+}
+
+type output struct {
+	Active bool  `json:"active"`
+	Power  *bool `json:"power"`
+	DPMS   *bool `json:"dpms"`
+}
+
+// monitorState returns MonitorOn if any active output is powered on and
+// MonitorOff otherwise.
+func (p *Provider) monitorState() (dpms.MonitorState, error) {
+	out, err := exec.CommandOutput("swaymsg", "-r", "-t", "get_outputs")
+	if err != nil {
+		return dpms.MonitorUnknown, err
+	}
+
+	var outputs []output
+
+	if err := json.Unmarshal(out, &outputs); err != nil {
+		return dpms.MonitorUnknown, err
+	}
+
+	for _, o := range outputs {
+		// Sway versions before 1.8 report the power state as "dpms".
+		power := o.Power
+		if power == nil {
+			power = o.DPMS
+		}
+
+		if o.Active && power != nil && *power {
+			return dpms.MonitorOn, nil
+		}
+	}
+
+	return dpms.MonitorOff, nil
+}
+
+// Fullscreen returns a dpms.Condition which is active while the focused
+// window is fullscreen, e.g. while watching a video. If classes are provided,
+// the app id or, for Xwayland windows, the window class must match one of
+// them. Classes may contain glob patterns and are matched case-insensitively.
+func (p *Provider) Fullscreen(classes ...string) dpms.Condition {
+	return dpms.ConditionFunc(func() (bool, error) {
+		root, err := p.tree()
+		if err != nil {
+			return false, err
+		}
+
+		focused := root.findFocused(false)
+		if focused == nil || !focused.fullscreen {
+			return false, nil
+		}
+
+		return dpms.MatchClass(focused.class(), classes...), nil
+	})
+}
+
+func (p *Provider) tree() (*node, error) {
+	out, err := exec.CommandOutput("swaymsg", "-r", "-t", "get_tree")
+	if err != nil {
+		return nil, err
+	}
+
+	var root node
+
+	if err := json.Unmarshal(out, &root); err != nil {
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// views returns all views in the tree.
+func (p *Provider) views() ([]*node, error) {
+	root, err := p.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return root.views(nil), nil
+}
+
+type node struct {
+	ID               int64  `json:"id"`
+	Focused          bool   `json:"focused"`
+	FullscreenMode   int    `json:"fullscreen_mode"`
+	AppID            string `json:"app_id"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+	Marks []string `json:"marks"`
+	// IdleInhibitors is only present on views.
+	IdleInhibitors *struct {
+		User string `json:"user"`
+	} `json:"idle_inhibitors"`
+	Nodes         []node `json:"nodes"`
+	FloatingNodes []node `json:"floating_nodes"`
+
+	fullscreen bool
+}
+
+// findFocused returns the focused node. The fullscreen field of the returned
+// node is true if the node or one of its parents is fullscreen.
+func (n *node) findFocused(fullscreen bool) *node {
+	n.fullscreen = fullscreen || n.FullscreenMode > 0
+
+	if n.Focused {
+		return n
+	}
+
+	for _, children := range [][]node{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			if focused := children[i].findFocused(n.fullscreen); focused != nil {
+				return focused
+			}
+		}
+	}
+
+	return nil
+}
+
+// views appends n and all of its descendants which are views to views.
+func (n *node) views(views []*node) []*node {
+	if n.IdleInhibitors != nil {
+		views = append(views, n)
+	}
+
+	for _, children := range [][]node{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			views = children[i].views(views)
+		}
+	}
+
+	return views
+}
+
+// inhibitMark returns the mark which was added to the view when it was
+// inhibited by the provider.
+func (n *node) inhibitMark() (string, bool) {
+	for _, mark := range n.Marks {
+		if strings.HasPrefix(mark, markPrefix) {
+			return mark, true
+		}
+	}
+
+	return "", false
+}
+
+func (n *node) class() string {
+	if n.AppID != "" {
+		return n.AppID
+	}
+
+	return n.WindowProperties.Class
+}
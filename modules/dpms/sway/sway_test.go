@@ -0,0 +1,280 @@
+package sway
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSway struct {
+	mu      sync.Mutex
+	outputs string
+	tree    string
+	// cmds records all commands except queries.
+	cmds      []exec.Cmd
+	processes []*exec.FakeProcess
+}
+
+func (s *fakeSway) run(cmd exec.Cmd) error {
+	if cmd.Name != "swaymsg" {
+		return errors.New("invalid command")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds = append(s.cmds, cmd)
+	return nil
+}
+
+func (s *fakeSway) output(cmd exec.Cmd) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cmd.Matches("swaymsg", "-r", "-t", "get_outputs") {
+		return []byte(s.outputs), nil
+	}
+
+	if cmd.Matches("swaymsg", "-r", "-t", "get_tree") {
+		return []byte(s.tree), nil
+	}
+
+	return nil, errors.New("invalid command")
+}
+
+func (s *fakeSway) start(cmd exec.Cmd) (exec.Process, error) {
+	if cmd.Name != "swayidle" {
+		return nil, errors.New("invalid command")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	process := exec.NewFakeProcess(100 + len(s.processes))
+	s.processes = append(s.processes, process)
+	s.cmds = append(s.cmds, cmd)
+
+	return process, nil
+}
+
+func (s *fakeSway) setTree(tree string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tree = tree
+}
+
+func (s *fakeSway) fake() func() {
+	restoreRun := exec.FakeCommandRun(s.run)
+	restoreOutput := exec.FakeCommandOutput(s.output)
+	restoreStart := exec.FakeCommandStart(s.start)
+
+	return func() {
+		restoreRun()
+		restoreOutput()
+		restoreStart()
+	}
+}
+
+const (
+	treeViews     = `{"nodes":[{"nodes":[{"id":4,"idle_inhibitors":{"user":"none"}},{"id":7,"marks":["foo"],"idle_inhibitors":{"user":"fullscreen"}}]}]}`
+	treeInhibited = `{"nodes":[{"nodes":[{"id":4,"marks":["_barista_dpms_4_none"],"idle_inhibitors":{"user":"open"}},{"id":7,"marks":["foo","_barista_dpms_7_fullscreen"],"idle_inhibitors":{"user":"open"}}]}]}`
+)
+
+func TestProvider(t *testing.T) {
+	sway := &fakeSway{
+		outputs: `[{"name":"eDP-1","active":true,"power":true},{"name":"HDMI-A-1","active":false,"power":false}]`,
+		tree:    treeViews,
+	}
+	defer sway.fake()()
+
+	p := NewProvider()
+
+	status, err := p.Status()
+	require.NoError(t, err)
+	assert.Equal(t, dpms.Status{Enabled: true, Monitor: dpms.MonitorOn}, status)
+
+	require.NoError(t, p.Set(true))
+	require.NoError(t, p.Set(false))
+
+	sway.setTree(treeInhibited)
+
+	enabled, err := p.Get()
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	require.NoError(t, p.Set(false))
+	require.NoError(t, p.Set(true))
+	require.NoError(t, p.ForceMonitor(dpms.MonitorOff))
+
+	err = p.ForceMonitor(dpms.MonitorStandby)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, dpms.ErrUnsupported))
+
+	expected := []exec.Cmd{
+		{Name: "swaymsg", Args: []string{"[con_id=4] mark --add _barista_dpms_4_none, inhibit_idle open; [con_id=7] mark --add _barista_dpms_7_fullscreen, inhibit_idle open"}},
+		{Name: "swaymsg", Args: []string{"[con_id=4] inhibit_idle none, unmark _barista_dpms_4_none; [con_id=7] inhibit_idle fullscreen, unmark _barista_dpms_7_fullscreen"}},
+		{Name: "swaymsg", Args: []string{"output", "*", "power", "off"}},
+	}
+
+	assert.Equal(t, expected, sway.cmds)
+}
+
+func TestProvider_NoViews(t *testing.T) {
+	sway := &fakeSway{tree: `{"nodes":[{"nodes":[]}]}`}
+	defer sway.fake()()
+
+	p := NewProvider()
+
+	require.NoError(t, p.Set(true))
+	require.Error(t, p.Set(false))
+}
+
+func TestProvider_Swayidle(t *testing.T) {
+	sway := &fakeSway{outputs: `[]`, tree: treeViews}
+	defer sway.fake()()
+
+	p := NewProvider(Timeout(5*time.Minute), SwayidleArgs("before-sleep", "swaylock -f"))
+
+	status, err := p.Status()
+	require.NoError(t, err)
+	assert.Equal(t, dpms.Status{Enabled: true, Timeouts: dpms.Timeouts{Off: 5 * time.Minute}, Monitor: dpms.MonitorOff}, status)
+
+	_, err = p.Get()
+	require.NoError(t, err)
+
+	require.NoError(t, p.SetTimeouts(dpms.Timeouts{Off: time.Minute}))
+
+	err = p.SetTimeouts(dpms.Timeouts{Standby: time.Minute})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, dpms.ErrUnsupported))
+
+	require.Error(t, p.SetTimeouts(dpms.Timeouts{}))
+
+	expected := []exec.Cmd{
+		{Name: "swayidle", Args: []string{"-w", "timeout", "300", "swaymsg 'output * power off'", "resume", "swaymsg 'output * power on'", "before-sleep", "swaylock -f"}},
+		{Name: "swayidle", Args: []string{"-w", "timeout", "60", "swaymsg 'output * power off'", "resume", "swaymsg 'output * power on'", "before-sleep", "swaylock -f"}},
+	}
+
+	assert.Equal(t, expected, sway.cmds)
+	require.Len(t, sway.processes, 2)
+	assert.True(t, sway.processes[0].Killed())
+	assert.False(t, sway.processes[1].Killed())
+
+	// swayidle is restarted if it exits unexpectedly.
+	sway.processes[1].Exit(errors.New("crashed"))
+
+	require.Eventually(t, func() bool {
+		if _, err := p.Get(); err != nil {
+			return false
+		}
+
+		sway.mu.Lock()
+		defer sway.mu.Unlock()
+		return len(sway.processes) == 3
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProvider_InvalidTimeout(t *testing.T) {
+	sway := &fakeSway{tree: treeViews}
+	defer sway.fake()()
+
+	_, err := NewProvider(Timeout(-time.Minute)).Get()
+	require.Error(t, err)
+	assert.Empty(t, sway.processes)
+}
+
+func TestProvider_MonitorState(t *testing.T) {
+	tests := []struct {
+		name     string
+		outputs  string
+		expected dpms.MonitorState
+	}{
+		{
+			name:     "all outputs powered off",
+			outputs:  `[{"active":true,"power":false},{"active":true,"power":false}]`,
+			expected: dpms.MonitorOff,
+		},
+		{
+			name:     "legacy dpms field",
+			outputs:  `[{"active":true,"dpms":true}]`,
+			expected: dpms.MonitorOn,
+		},
+		{
+			name:     "no outputs",
+			outputs:  `[]`,
+			expected: dpms.MonitorOff,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sway := &fakeSway{outputs: test.outputs, tree: `{}`}
+			defer sway.fake()()
+
+			status, err := NewProvider().Status()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, status.Monitor)
+		})
+	}
+}
+
+func TestProvider_Error(t *testing.T) {
+	sway := &fakeSway{outputs: `invalid`, tree: `{}`}
+	defer sway.fake()()
+
+	_, err := NewProvider().Status()
+	require.Error(t, err)
+}
+
+func TestProvider_Fullscreen(t *testing.T) {
+	tests := []struct {
+		name     string
+		tree     string
+		classes  []string
+		expected bool
+	}{
+		{
+			name:     "focused fullscreen window",
+			tree:     `{"nodes":[{"nodes":[{"focused":true,"fullscreen_mode":1,"app_id":"mpv"}]}]}`,
+			expected: true,
+		},
+		{
+			name:     "focused window not fullscreen",
+			tree:     `{"nodes":[{"nodes":[{"focused":true,"app_id":"mpv"},{"fullscreen_mode":1,"app_id":"vlc"}]}]}`,
+			expected: false,
+		},
+		{
+			name:     "child of fullscreen container",
+			tree:     `{"nodes":[{"fullscreen_mode":1,"nodes":[{"focused":true,"app_id":"mpv"}]}]}`,
+			expected: true,
+		},
+		{
+			name:     "matching xwayland class",
+			tree:     `{"nodes":[{"floating_nodes":[{"focused":true,"fullscreen_mode":2,"window_properties":{"class":"Firefox"}}]}]}`,
+			classes:  []string{"mpv", "firefox"},
+			expected: true,
+		},
+		{
+			name:     "class does not match",
+			tree:     `{"nodes":[{"nodes":[{"focused":true,"fullscreen_mode":1,"app_id":"kitty"}]}]}`,
+			classes:  []string{"mpv", "firefox"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sway := &fakeSway{tree: test.tree}
+			defer sway.fake()()
+
+			active, err := NewProvider().Fullscreen(test.classes...).Active()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, active)
+		})
+	}
+}
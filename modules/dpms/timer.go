@@ -0,0 +1,158 @@
+package dpms
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+	"barista.run/timing"
+)
+
+// timer keeps track of timed DPMS inhibition, i.e. DPMS being disabled until
+// a certain point in time.
+type timer struct {
+	sync.Mutex
+	until      time.Time
+	step       time.Duration
+	stateFile  string
+	reenableAt time.Duration // offset from midnight, negative if unset
+	expiry     *timing.Scheduler
+	clock      *timing.Scheduler
+}
+
+func newTimer() *timer {
+	return &timer{
+		step:       15 * time.Minute,
+		reenableAt: -1,
+		expiry:     timing.NewScheduler(),
+		clock:      timing.NewScheduler(),
+	}
+}
+
+// Until returns the time at which DPMS will be re-enabled. Returns the zero
+// time if no timer is active.
+func (t *timer) Until() time.Time {
+	t.Lock()
+	defer t.Unlock()
+	return t.until
+}
+
+// Step returns the duration that is added or removed by scrolling.
+func (t *timer) Step() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.step
+}
+
+// Set starts a timer which expires at until and persists it to the state
+// file. Passing the zero time stops the timer.
+func (t *timer) Set(until time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	t.set(until)
+
+	if err := t.save(); err != nil {
+		l.Log("Error saving DPMS timer state: %v", err)
+	}
+}
+
+func (t *timer) set(until time.Time) {
+	t.until = until
+
+	if until.IsZero() {
+		t.expiry.Stop()
+	} else {
+		t.expiry.At(until)
+	}
+}
+
+// Expired returns true if there is an active timer that has expired.
+func (t *timer) Expired() bool {
+	t.Lock()
+	defer t.Unlock()
+	return !t.until.IsZero() && !timing.Now().Before(t.until)
+}
+
+// SetReenableAt configures the time of day at which DPMS should be
+// re-enabled. Passing a negative offset disables it.
+func (t *timer) SetReenableAt(offset time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.reenableAt = offset
+	t.scheduleClock()
+}
+
+// ScheduleClock schedules the next re-enable at the configured time of day.
+func (t *timer) ScheduleClock() {
+	t.Lock()
+	defer t.Unlock()
+	t.scheduleClock()
+}
+
+func (t *timer) scheduleClock() {
+	if t.reenableAt < 0 {
+		t.clock.Stop()
+		return
+	}
+
+	t.clock.At(nextTimeOfDay(timing.Now(), t.reenableAt))
+}
+
+// Load restores the timer from the state file, if configured.
+func (t *timer) Load() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.stateFile == "" {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(t.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	until, err := time.Parse(time.RFC3339, strings.TrimSpace(string(buf)))
+	if err != nil {
+		return err
+	}
+
+	t.set(until)
+
+	return nil
+}
+
+func (t *timer) save() error {
+	if t.stateFile == "" {
+		return nil
+	}
+
+	if t.until.IsZero() {
+		err := os.Remove(t.stateFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return ioutil.WriteFile(t.stateFile, []byte(t.until.Format(time.RFC3339)), 0644)
+}
+
+// nextTimeOfDay returns the next point in time after now which is offset
+// after midnight.
+func nextTimeOfDay(now time.Time, offset time.Duration) time.Time {
+	year, month, day := now.Date()
+
+	next := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Add(offset)
+	if !next.After(now) {
+		next = time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Add(offset)
+	}
+
+	return next
+}
@@ -0,0 +1,264 @@
+// Package x11 provides a DPMS provider which talks to the X server directly
+// using the DPMS extension instead of spawning xset.
+package x11
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/martinohmann/barista-contrib/internal/x11"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+)
+
+// New creates a new *dpms.Module using the X server of the display from the
+// DISPLAY environment variable as DPMS provider.
+func New() *dpms.Module {
+	return dpms.New(NewProvider(os.Getenv("DISPLAY")))
+}
+
+// Provider is a dpms.Provider which uses the DPMS extension of an X server.
+// The connection to the X server is established lazily and re-established
+// after errors.
+type Provider struct {
+	sync.Mutex
+	display string
+	conn    *x11.Conn
+}
+
+// NewProvider creates a new *Provider for display.
+func NewProvider(display string) *Provider {
+	return &Provider{display: display}
+}
+
+// do calls fn with the connection to the X server, dialing it if necessary.
+// The connection is dropped if fn returns an error which is not an X protocol
+// error, so that the next call will dial again.
+func (p *Provider) do(fn func(conn *x11.Conn) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn == nil {
+		conn, err := x11.Dial(p.display)
+		if err != nil {
+			return err
+		}
+
+		p.conn = conn
+	}
+
+	err := fn(p.conn)
+	if _, ok := err.(*x11.Error); err != nil && !ok {
+		p.conn.Close()
+		p.conn = nil
+	}
+
+	return err
+}
+
+// Get implements dpms.Provider.
+func (p *Provider) Get() (enabled bool, err error) {
+	err = p.do(func(conn *x11.Conn) error {
+		info, err := conn.DPMSInfo()
+		enabled = info.Enabled
+		return err
+	})
+
+	return enabled, err
+}
+
+// Set implements dpms.Provider.
+func (p *Provider) Set(enabled bool) error {
+	return p.do(func(conn *x11.Conn) error {
+		if enabled {
+			return conn.DPMSEnable()
+		}
+
+		return conn.DPMSDisable()
+	})
+}
+
+// Status implements dpms.StatusProvider.
+func (p *Provider) Status() (status dpms.Status, err error) {
+	err = p.do(func(conn *x11.Conn) error {
+		info, err := conn.DPMSInfo()
+		if err != nil {
+			return err
+		}
+
+		timeouts, err := conn.DPMSGetTimeouts()
+		if err != nil {
+			return err
+		}
+
+		status = dpms.Status{
+			Enabled: info.Enabled,
+			Timeouts: dpms.Timeouts{
+				Standby: timeouts.Standby,
+				Suspend: timeouts.Suspend,
+				Off:     timeouts.Off,
+			},
+			Monitor: monitorStates[info.PowerLevel],
+		}
+
+		return nil
+	})
+
+	return status, err
+}
+
+// SetTimeouts implements dpms.StatusProvider.
+func (p *Provider) SetTimeouts(timeouts dpms.Timeouts) error {
+	return p.do(func(conn *x11.Conn) error {
+		return conn.DPMSSetTimeouts(x11.DPMSTimeouts{
+			Standby: timeouts.Standby,
+			Suspend: timeouts.Suspend,
+			Off:     timeouts.Off,
+		})
+	})
+}
+
+// ForceMonitor implements dpms.StatusProvider.
+func (p *Provider) ForceMonitor(state dpms.MonitorState) error {
+	level, ok := powerLevels[state]
+	if !ok {
+		return fmt.Errorf("invalid monitor state %q", state)
+	}
+
+	return p.do(func(conn *x11.Conn) error {
+		return conn.DPMSForceLevel(level)
+	})
+}
+
+// Watch implements dpms.WatchingProvider. It requires DPMS extension version
+// 1.2 or newer and uses a dedicated connection to the X server. The returned
+// channel is closed when the connection is lost.
+func (p *Provider) Watch() (<-chan struct{}, error) {
+	conn, err := x11.Dial(p.display)
+	if err != nil {
+		return nil, err
+	}
+
+	major, minor, err := conn.DPMSVersion()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if major < 1 || major == 1 && minor < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("DPMS %d.%d does not support events: %w", major, minor, dpms.ErrUnsupported)
+	}
+
+	if err := conn.DPMSSelectInput(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+
+		for ev := range conn.Events() {
+			if !conn.IsDPMSInfoNotify(ev) {
+				continue
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Fullscreen returns a dpms.Condition which is active while the active window
+// is fullscreen, e.g. while watching a video. If classes are provided, the
+// WM_CLASS of the window must match one of them. Classes may contain glob
+// patterns and are matched case-insensitively:
+//
+//	p := x11.NewProvider(":0")
+//	dpms.New(p).Rules(dpms.NewRule("video", p.Fullscreen("mpv", "vlc")))
+func (p *Provider) Fullscreen(classes ...string) dpms.Condition {
+	return dpms.ConditionFunc(func() (active bool, err error) {
+		err = p.do(func(conn *x11.Conn) error {
+			active, err = fullscreen(conn, classes)
+			return err
+		})
+
+		return active, err
+	})
+}
+
+func fullscreen(conn *x11.Conn, classes []string) (bool, error) {
+	prop, err := conn.GetProperty(conn.Root(), "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return false, err
+	}
+
+	windows := prop.Uint32s()
+	if len(windows) == 0 || windows[0] == 0 {
+		return false, nil
+	}
+
+	window := windows[0]
+
+	fullscreenAtom, err := conn.Atom("_NET_WM_STATE_FULLSCREEN")
+	if err != nil {
+		return false, err
+	}
+
+	prop, err = conn.GetProperty(window, "_NET_WM_STATE")
+	if err != nil {
+		return false, err
+	}
+
+	if !containsAtom(prop.Uint32s(), fullscreenAtom) {
+		return false, nil
+	}
+
+	if len(classes) == 0 {
+		return true, nil
+	}
+
+	prop, err = conn.GetProperty(window, "WM_CLASS")
+	if err != nil {
+		return false, err
+	}
+
+	for _, class := range prop.Strings() {
+		if dpms.MatchClass(class, classes...) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func containsAtom(atoms []uint32, atom uint32) bool {
+	for _, a := range atoms {
+		if a == atom {
+			return true
+		}
+	}
+
+	return false
+}
+
+var monitorStates = map[uint16]dpms.MonitorState{
+	x11.DPMSModeOn:      dpms.MonitorOn,
+	x11.DPMSModeStandby: dpms.MonitorStandby,
+	x11.DPMSModeSuspend: dpms.MonitorSuspend,
+	x11.DPMSModeOff:     dpms.MonitorOff,
+}
+
+var powerLevels = map[dpms.MonitorState]uint16{
+	dpms.MonitorOn:      x11.DPMSModeOn,
+	dpms.MonitorStandby: x11.DPMSModeStandby,
+	dpms.MonitorSuspend: x11.DPMSModeSuspend,
+	dpms.MonitorOff:     x11.DPMSModeOff,
+}
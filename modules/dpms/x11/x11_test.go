@@ -0,0 +1,96 @@
+package x11
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/x11"
+	"github.com/martinohmann/barista-contrib/modules/dpms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startXvfb starts an Xvfb server and returns its display. The test is
+// skipped if Xvfb is not installed.
+func startXvfb(t *testing.T) string {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+
+	display := fmt.Sprintf(":%d", 200+os.Getpid()%100)
+
+	cmd := exec.Command("Xvfb", display, "-nolisten", "tcp")
+	require.NoError(t, cmd.Start())
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	var err error
+	for i := 0; i < 50; i++ {
+		var conn *x11.Conn
+		if conn, err = x11.Dial(display); err == nil {
+			conn.Close()
+			return display
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	require.NoError(t, err, "connecting to Xvfb")
+
+	return display
+}
+
+func TestProvider_Xvfb(t *testing.T) {
+	display := startXvfb(t)
+
+	p := NewProvider(display)
+
+	require.NoError(t, p.Set(true))
+
+	enabled, err := p.Get()
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	timeouts := dpms.Timeouts{Standby: time.Minute, Suspend: 2 * time.Minute, Off: 3 * time.Minute}
+	require.NoError(t, p.SetTimeouts(timeouts))
+
+	status, err := p.Status()
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, timeouts, status.Timeouts)
+
+	ch, err := p.Watch()
+	if errors.Is(err, dpms.ErrUnsupported) {
+		t.Logf("skipping events: %v", err)
+		ch = nil
+	} else {
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, p.Set(false))
+
+	if ch != nil {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for DPMS change event")
+		}
+	}
+
+	enabled, err = p.Get()
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	require.Error(t, p.ForceMonitor(dpms.MonitorUnknown))
+
+	active, err := p.Fullscreen().Active()
+	require.NoError(t, err)
+	assert.False(t, active, "Xvfb has no window manager")
+}
@@ -1,6 +1,8 @@
 package xset
 
 import (
+	"fmt"
+
 	"github.com/martinohmann/barista-contrib/internal/xset"
 	"github.com/martinohmann/barista-contrib/modules/dpms"
 )
@@ -21,3 +23,45 @@ func (*provider) Set(enabled bool) error {
 func (*provider) Get() (bool, error) {
 	return xset.GetDPMS()
 }
+
+// Status implements dpms.StatusProvider.
+func (*provider) Status() (dpms.Status, error) {
+	info, err := xset.QueryDPMS()
+	if err != nil {
+		return dpms.Status{}, err
+	}
+
+	status := dpms.Status{
+		Enabled: info.Enabled,
+		Timeouts: dpms.Timeouts{
+			Standby: info.Standby,
+			Suspend: info.Suspend,
+			Off:     info.Off,
+		},
+		Monitor: monitorStates[info.Monitor],
+	}
+
+	return status, nil
+}
+
+// SetTimeouts implements dpms.StatusProvider.
+func (*provider) SetTimeouts(timeouts dpms.Timeouts) error {
+	return xset.SetDPMSTimeouts(timeouts.Standby, timeouts.Suspend, timeouts.Off)
+}
+
+// ForceMonitor implements dpms.StatusProvider.
+func (*provider) ForceMonitor(state dpms.MonitorState) error {
+	switch state {
+	case dpms.MonitorOn, dpms.MonitorStandby, dpms.MonitorSuspend, dpms.MonitorOff:
+		return xset.ForceDPMS(state.String())
+	default:
+		return fmt.Errorf("invalid monitor state %q", state)
+	}
+}
+
+var monitorStates = map[string]dpms.MonitorState{
+	"On":      dpms.MonitorOn,
+	"Standby": dpms.MonitorStandby,
+	"Suspend": dpms.MonitorSuspend,
+	"Off":     dpms.MonitorOff,
+}
@@ -0,0 +1,113 @@
+package ip
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Connectivity describes the state of the internet connection.
+type Connectivity int
+
+// Possible connectivity states.
+const (
+	// Unknown means that the connectivity could not be determined.
+	Unknown Connectivity = iota
+
+	// Online means that the public IP could be looked up.
+	Online
+
+	// Offline means that there is no internet connection at all.
+	Offline
+
+	// DNSBroken means that the network is reachable, but names cannot be
+	// resolved.
+	DNSBroken
+
+	// CaptivePortal means that requests are intercepted by a captive portal,
+	// e.g. the login page of a hotel or airport network.
+	CaptivePortal
+
+	// ProxyRequired means that the network only allows connections via an
+	// HTTP proxy which requires authentication.
+	ProxyRequired
+)
+
+var connectivityNames = map[Connectivity]string{
+	Unknown:       "unknown",
+	Online:        "online",
+	Offline:       "offline",
+	DNSBroken:     "DNS broken",
+	CaptivePortal: "captive portal",
+	ProxyRequired: "proxy required",
+}
+
+// String implements fmt.Stringer.
+func (c Connectivity) String() string {
+	if name, ok := connectivityNames[c]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// offlineErrnos are errors of failed dials which indicate that there is no
+// route to the internet.
+var offlineErrnos = []error{
+	syscall.ENETUNREACH,
+	syscall.EHOSTUNREACH,
+	syscall.ECONNREFUSED,
+}
+
+// ErrorConnectivity classifies an error returned while looking up the public
+// IP. Failed DNS lookups of existing names result in DNSBroken, temporary
+// network errors, timeouts, unreachable networks or hosts and refused
+// connections result in Offline. Returns Unknown for all other errors.
+func ErrorConnectivity(err error) Connectivity {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return DNSBroken
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Temporary() || netErr.Timeout()) {
+		return Offline
+	}
+
+	for _, errno := range offlineErrnos {
+		if errors.Is(err, errno) {
+			return Offline
+		}
+	}
+
+	return Unknown
+}
+
+// MoreSpecific returns the more specific of the connectivity states c and
+// other, e.g. to combine the states of multiple failed lookups. Any state is
+// more specific than Unknown, and DNSBroken, CaptivePortal and ProxyRequired
+// are more specific than Offline. If both are equally specific, c is
+// returned.
+func (c Connectivity) MoreSpecific(other Connectivity) Connectivity {
+	if c == Unknown || (c == Offline && other != Unknown) {
+		return other
+	}
+
+	return c
+}
+
+// ConnectivityChecker determines the connectivity state if the public IP
+// could not be looked up.
+type ConnectivityChecker interface {
+	// CheckConnectivity returns the current connectivity state.
+	CheckConnectivity() (Connectivity, error)
+}
+
+// ConnectivityCheckerFunc is a func that satisfies the ConnectivityChecker
+// interface.
+type ConnectivityCheckerFunc func() (Connectivity, error)
+
+// CheckConnectivity implements ConnectivityChecker.
+func (f ConnectivityCheckerFunc) CheckConnectivity() (Connectivity, error) {
+	return f()
+}
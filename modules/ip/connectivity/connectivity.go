@@ -0,0 +1,199 @@
+// Package connectivity provides an ip.ConnectivityChecker which requests a
+// connectivity check URL, similar to what NetworkManager or Android do, to
+// detect captive portals, proxies and broken DNS.
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// Endpoint is a connectivity check URL together with its expected response.
+// Any other response is considered to be sent by a captive portal.
+type Endpoint struct {
+	// URL is requested via HTTP GET. It should use plain HTTP, so that
+	// captive portals are able to intercept the request.
+	URL string
+
+	// Status is the expected HTTP status code.
+	Status int
+
+	// Body is the expected response body. Leading and trailing whitespace is
+	// ignored. The body is not checked if empty.
+	Body string
+}
+
+// Predefined endpoints.
+var (
+	Google         = Endpoint{URL: "http://connectivitycheck.gstatic.com/generate_204", Status: http.StatusNoContent}
+	NetworkManager = Endpoint{URL: "http://nmcheck.gnome.org/check_network_status.txt", Status: http.StatusOK, Body: "NetworkManager is online"}
+)
+
+// DefaultEndpoints are used if no endpoints are configured.
+var DefaultEndpoints = []Endpoint{Google, NetworkManager}
+
+// Option is a func that can be passed to NewChecker to configure the checker.
+type Option func(c *Checker)
+
+// Endpoints configures the endpoints to check in order until one of them
+// answers. Defaults to DefaultEndpoints.
+func Endpoints(endpoints ...Endpoint) Option {
+	return func(c *Checker) {
+		c.endpoints = endpoints
+	}
+}
+
+// Fallback configures the TCP address which is dialed if DNS resolution of
+// an endpoint failed, to tell broken DNS apart from being offline. Defaults
+// to "1.1.1.1:443".
+func Fallback(addr string) Option {
+	return func(c *Checker) {
+		c.fallback = addr
+	}
+}
+
+// Timeout configures the timeout for each request. Defaults to 5 seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(c *Checker) {
+		c.timeout = timeout
+	}
+}
+
+// Client configures the HTTP client used for requests. Defaults to
+// http.DefaultClient. Redirects are never followed, since they usually point
+// to the login page of a captive portal.
+func Client(client *http.Client) Option {
+	return func(c *Checker) {
+		c.client = client
+	}
+}
+
+// NewChecker creates a new *Checker and configures it with the provided
+// options.
+func NewChecker(options ...Option) *Checker {
+	c := &Checker{
+		endpoints: DefaultEndpoints,
+		fallback:  "1.1.1.1:443",
+		timeout:   5 * time.Second,
+		client:    http.DefaultClient,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// Checker is an ip.ConnectivityChecker which requests connectivity check
+// URLs.
+type Checker struct {
+	endpoints []Endpoint
+	fallback  string
+	timeout   time.Duration
+	client    *http.Client
+}
+
+// CheckConnectivity implements ip.ConnectivityChecker. Endpoints are checked
+// in order until one of them answers. Returns ip.Offline if none of them
+// could be reached.
+func (c *Checker) CheckConnectivity() (ip.Connectivity, error) {
+	var errs []string
+
+	for _, endpoint := range c.endpoints {
+		state, err := c.check(endpoint)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		if state != ip.Offline {
+			return state, nil
+		}
+	}
+
+	if len(errs) > 0 {
+		return ip.Unknown, fmt.Errorf("all endpoints failed: %s", strings.Join(errs, "; "))
+	}
+
+	return ip.Offline, nil
+}
+
+func (c *Checker) check(endpoint Endpoint) (ip.Connectivity, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint.URL, nil)
+	if err != nil {
+		return ip.Unknown, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	client := *c.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return c.checkFallback(), nil
+		}
+
+		if state := ip.ErrorConnectivity(err); state != ip.Unknown {
+			return state, nil
+		}
+
+		return ip.Unknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return ip.ProxyRequired, nil
+	}
+
+	if resp.StatusCode != endpoint.Status {
+		return ip.CaptivePortal, nil
+	}
+
+	if endpoint.Body == "" {
+		return ip.Online, nil
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ip.Unknown, err
+	}
+
+	if strings.TrimSpace(string(buf)) != endpoint.Body {
+		return ip.CaptivePortal, nil
+	}
+
+	return ip.Online, nil
+}
+
+// checkFallback is called after DNS resolution failed. It returns
+// ip.DNSBroken if the fallback address can be reached without DNS and
+// ip.Offline otherwise.
+func (c *Checker) checkFallback() ip.Connectivity {
+	if c.fallback == "" {
+		return ip.Offline
+	}
+
+	conn, err := net.DialTimeout("tcp", c.fallback, c.timeout)
+	if err != nil {
+		return ip.Offline
+	}
+
+	conn.Close()
+
+	return ip.DNSBroken
+}
@@ -0,0 +1,123 @@
+package connectivity
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_204", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/status.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "NetworkManager is online")
+	})
+	mux.HandleFunc("/portal", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Please log in</html>")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/generate_204", http.StatusFound)
+	})
+	mux.HandleFunc("/proxy", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	})
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		expected ip.Connectivity
+	}{
+		{
+			name:     "online",
+			endpoint: Endpoint{URL: s.URL + "/generate_204", Status: http.StatusNoContent},
+			expected: ip.Online,
+		},
+		{
+			name:     "online with body",
+			endpoint: Endpoint{URL: s.URL + "/status.txt", Status: http.StatusOK, Body: "NetworkManager is online"},
+			expected: ip.Online,
+		},
+		{
+			name:     "unexpected status",
+			endpoint: Endpoint{URL: s.URL + "/portal", Status: http.StatusNoContent},
+			expected: ip.CaptivePortal,
+		},
+		{
+			name:     "unexpected body",
+			endpoint: Endpoint{URL: s.URL + "/portal", Status: http.StatusOK, Body: "NetworkManager is online"},
+			expected: ip.CaptivePortal,
+		},
+		{
+			name:     "redirect is not followed",
+			endpoint: Endpoint{URL: s.URL + "/redirect", Status: http.StatusNoContent},
+			expected: ip.CaptivePortal,
+		},
+		{
+			name:     "proxy authentication required",
+			endpoint: Endpoint{URL: s.URL + "/proxy", Status: http.StatusNoContent},
+			expected: ip.ProxyRequired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, err := NewChecker(Endpoints(test.endpoint)).CheckConnectivity()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, state)
+		})
+	}
+}
+
+// newDNSFailingClient returns a client which fails to resolve any name.
+func newDNSFailingClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, _, _ := net.SplitHostPort(addr)
+				return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{
+					Err:        "no such host",
+					Name:       host,
+					IsNotFound: true,
+				}}
+			},
+		},
+	}
+}
+
+func TestChecker_DNS(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	endpoint := Endpoint{URL: "http://connectivity.example.com", Status: http.StatusNoContent}
+
+	state, err := NewChecker(Endpoints(endpoint), Client(newDNSFailingClient()), Fallback(s.Listener.Addr().String())).CheckConnectivity()
+	require.NoError(t, err)
+	assert.Equal(t, ip.DNSBroken, state, "fallback reachable")
+
+	state, err = NewChecker(Endpoints(endpoint), Client(newDNSFailingClient()), Fallback("127.0.0.1:1")).CheckConnectivity()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Offline, state, "fallback unreachable")
+}
+
+func TestChecker_Error(t *testing.T) {
+	_, err := NewChecker(Endpoints(Endpoint{URL: "gopher://127.0.0.1:1"})).CheckConnectivity()
+	require.Error(t, err)
+}
+
+func TestChecker_ConnectionRefused(t *testing.T) {
+	state, err := NewChecker(Endpoints(Endpoint{URL: "http://127.0.0.1:1"})).CheckConnectivity()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Offline, state)
+}
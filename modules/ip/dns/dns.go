@@ -0,0 +1,193 @@
+// Package dns provides an ip.Provider which looks up the public IP by
+// querying special DNS names that resolve to the address of the client, e.g.
+// myip.opendns.com on the OpenDNS resolvers.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// RecordType is the type of the DNS record that contains the IP.
+type RecordType int
+
+// Supported record types.
+const (
+	// A looks up A and AAAA records.
+	A RecordType = iota
+
+	// TXT looks up TXT records which contain the IP as text.
+	TXT
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// Server configures the address of the DNS server to query, e.g.
+// "208.67.222.222:53". The port defaults to 53 if omitted.
+func Server(server string) Option {
+	return func(p *Provider) {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		p.server = server
+	}
+}
+
+// Name configures the DNS name to look up and the type of the record that
+// contains the IP.
+func Name(name string, recordType RecordType) Option {
+	return func(p *Provider) {
+		p.name = name
+		p.recordType = recordType
+	}
+}
+
+// Timeout configures the timeout for DNS queries. Defaults to 5 seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// OpenDNS configures the provider to look up the A record of
+// myip.opendns.com on resolver1.opendns.com. This is the default.
+func OpenDNS() Option {
+	return func(p *Provider) {
+		Server("208.67.222.222")(p)
+		Name("myip.opendns.com", A)(p)
+	}
+}
+
+// Google configures the provider to look up the TXT record of
+// o-o.myaddr.l.google.com on ns1.google.com.
+func Google() Option {
+	return func(p *Provider) {
+		Server("216.239.32.10")(p)
+		Name("o-o.myaddr.l.google.com", TXT)(p)
+	}
+}
+
+// New creates a new *ip.Module which uses DNS to look up the public IP.
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{timeout: 5 * time.Second}
+
+	OpenDNS()(p)
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is an ip.ResultProvider which looks up the public IP via DNS.
+type Provider struct {
+	server     string
+	name       string
+	recordType RecordType
+	timeout    time.Duration
+}
+
+// GetIP implements ip.Provider.
+func (p *Provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+// Lookup implements ip.ResultProvider.
+func (p *Provider) Lookup() (ip.Result, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, p.server)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	var addrs []net.IP
+	var err error
+
+	switch p.recordType {
+	case TXT:
+		addrs, err = lookupTXT(ctx, resolver, p.name)
+	default:
+		addrs, err = lookupA(ctx, resolver, p.name)
+	}
+
+	if err != nil {
+		if state := ip.ErrorConnectivity(err); state != ip.Unknown {
+			return ip.Result{Connectivity: state}, nil
+		}
+
+		return ip.Result{}, err
+	}
+
+	result := ip.Result{Source: p.server}
+
+	for _, addr := range addrs {
+		if addr.To4() != nil {
+			if result.IPv4 == nil {
+				result.IPv4 = addr
+			}
+		} else if result.IPv6 == nil {
+			result.IPv6 = addr
+		}
+	}
+
+	return result.Normalize(), nil
+}
+
+func lookupA(ctx context.Context, resolver *net.Resolver, name string) ([]net.IP, error) {
+	addrs, err := resolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+
+	return ips, nil
+}
+
+func lookupTXT(ctx context.Context, resolver *net.Resolver, name string) ([]net.IP, error) {
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+
+	// Some services return additional records, e.g. Google returns the EDNS
+	// client subnet as "edns0-client-subnet 192.0.2.0/24", so only records
+	// that are plain IPs are considered.
+	for _, record := range records {
+		if addr := net.ParseIP(strings.TrimSpace(record)); addr != nil {
+			ips = append(ips, addr)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP in TXT records of %s: %q", name, records)
+	}
+
+	return ips, nil
+}
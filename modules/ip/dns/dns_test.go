@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	typeA    = 1
+	typeTXT  = 16
+	typeAAAA = 28
+)
+
+// fakeServer is a minimal DNS server which answers queries from records.
+type fakeServer struct {
+	conn    net.PacketConn
+	records map[string]map[uint16][][]byte
+}
+
+func newFakeServer(t *testing.T, records map[string]map[uint16][][]byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeServer{conn: conn, records: records}
+	go s.serve()
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func (s *fakeServer) serve() {
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if resp := s.answer(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *fakeServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	// Parse the name of the first question.
+	var labels []string
+
+	offset := 12
+	for offset < len(query) && query[offset] != 0 {
+		n := int(query[offset])
+		labels = append(labels, string(query[offset+1:offset+1+n]))
+		offset += n + 1
+	}
+
+	offset++
+	if offset+4 > len(query) {
+		return nil
+	}
+
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[offset:])
+	question := query[12 : offset+4]
+
+	types, ok := s.records[name]
+
+	resp := make([]byte, 12, 512)
+	copy(resp, query[:2])
+	binary.BigEndian.PutUint16(resp[2:], 0x8180)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	if !ok {
+		resp[3] |= 3 // NXDOMAIN
+	}
+
+	answers := types[qtype]
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+
+	resp = append(resp, question...)
+
+	for _, rdata := range answers {
+		rr := make([]byte, 12)
+		binary.BigEndian.PutUint16(rr, 0xc00c) // pointer to the question name
+		binary.BigEndian.PutUint16(rr[2:], qtype)
+		binary.BigEndian.PutUint16(rr[4:], 1)
+		binary.BigEndian.PutUint32(rr[6:], 60)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+		resp = append(resp, rr...)
+		resp = append(resp, rdata...)
+	}
+
+	return resp
+}
+
+func txt(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func TestProvider_A(t *testing.T) {
+	server := newFakeServer(t, map[string]map[uint16][][]byte{
+		"myip.example.com": {
+			typeA:    {net.ParseIP("203.0.113.1").To4()},
+			typeAAAA: {net.ParseIP("2001:db8::1")},
+		},
+	})
+
+	result, err := NewProvider(Server(server), Name("myip.example.com.", A)).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Result{
+		IP:     net.ParseIP("203.0.113.1").To4(),
+		IPv4:   net.ParseIP("203.0.113.1").To4(),
+		IPv6:   net.ParseIP("2001:db8::1"),
+		Source: server,
+	}, result)
+}
+
+func TestProvider_TXT(t *testing.T) {
+	server := newFakeServer(t, map[string]map[uint16][][]byte{
+		"myaddr.example.com": {
+			typeTXT: {txt("edns0-client-subnet 192.0.2.0/24"), txt("203.0.113.1")},
+		},
+		"noaddr.example.com": {
+			typeTXT: {txt("foo")},
+		},
+	})
+
+	ip, err := NewProvider(Server(server), Name("myaddr.example.com.", TXT)).GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), ip)
+
+	_, err = NewProvider(Server(server), Name("noaddr.example.com.", TXT)).GetIP()
+	require.EqualError(t, err, `no IP in TXT records of noaddr.example.com.: ["foo"]`)
+}
+
+func TestProvider_NotFound(t *testing.T) {
+	server := newFakeServer(t, nil)
+
+	result, err := NewProvider(Server(server), Name("myip.example.com.", A)).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Result{Connectivity: ip.DNSBroken}, result)
+}
+
+func TestProvider_Offline(t *testing.T) {
+	// A server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	p := NewProvider(Server(conn.LocalAddr().String()), Name("myip.example.com.", A), Timeout(100*time.Millisecond))
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Result{Connectivity: ip.Offline}, result)
+}
+
+func TestServer(t *testing.T) {
+	p := NewProvider(Server("192.0.2.53"))
+	assert.Equal(t, "192.0.2.53:53", p.server)
+
+	p = NewProvider(Google())
+	assert.Equal(t, "216.239.32.10:53", p.server)
+	assert.Equal(t, TXT, p.recordType)
+}
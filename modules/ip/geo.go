@@ -0,0 +1,112 @@
+package ip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	l "barista.run/logging"
+)
+
+// Geo contains location and network information about an IP address.
+type Geo struct {
+	// Country is the English name of the country, e.g. "Germany".
+	Country string
+
+	// CountryCode is the ISO 3166-1 alpha-2 country code, e.g. "DE".
+	CountryCode string
+
+	// City is the English name of the city, e.g. "Berlin".
+	City string
+
+	// ASN is the number of the autonomous system the IP belongs to.
+	ASN uint32
+
+	// Org is the name of the organization operating the autonomous system,
+	// e.g. "Cloudflare, Inc.".
+	Org string
+}
+
+// IsZero returns true if g does not contain any information.
+func (g Geo) IsZero() bool {
+	return g == Geo{}
+}
+
+// String implements fmt.Stringer. It returns a compact representation like
+// "DE AS13335 Cloudflare, Inc.".
+func (g Geo) String() string {
+	var parts []string
+
+	if g.CountryCode != "" {
+		parts = append(parts, g.CountryCode)
+	} else if g.Country != "" {
+		parts = append(parts, g.Country)
+	}
+
+	if g.ASN != 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", g.ASN))
+	}
+
+	if g.Org != "" {
+		parts = append(parts, g.Org)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Enricher looks up location and network information for IP addresses.
+type Enricher interface {
+	// Enrich retrieves information about ip.
+	Enrich(ip net.IP) (Geo, error)
+}
+
+// EnricherFunc is a func that satisfies the Enricher interface.
+type EnricherFunc func(ip net.IP) (Geo, error)
+
+// Enrich implements Enricher.
+func (f EnricherFunc) Enrich(ip net.IP) (Geo, error) {
+	return f(ip)
+}
+
+// enrichment looks up Geo information using an Enricher and caches the
+// results per IP. Failed lookups are not cached.
+type enrichment struct {
+	sync.Mutex
+	enricher Enricher
+	cache    map[string]Geo
+}
+
+// Set replaces the enricher and clears the cache.
+func (e *enrichment) Set(enricher Enricher) {
+	e.Lock()
+	defer e.Unlock()
+	e.enricher = enricher
+	e.cache = make(map[string]Geo)
+}
+
+// Enrich returns Geo information for ip. Errors are logged and result in an
+// empty Geo.
+func (e *enrichment) Enrich(ip net.IP) Geo {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.enricher == nil || ip == nil {
+		return Geo{}
+	}
+
+	key := ip.String()
+	if geo, ok := e.cache[key]; ok {
+		return geo
+	}
+
+	geo, err := e.enricher.Enrich(ip)
+	if err != nil {
+		l.Log("Error enriching IP %s: %v", ip, err)
+		return Geo{}
+	}
+
+	e.cache[key] = geo
+
+	return geo
+}
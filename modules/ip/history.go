@@ -0,0 +1,128 @@
+package ip
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+	"barista.run/timing"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+)
+
+// Change is an entry of the IP history.
+type Change struct {
+	// IP is the public IP.
+	IP net.IP
+
+	// Time is the time at which IP was first seen.
+	Time time.Time
+}
+
+// history keeps track of distinct public IPs. IPv4 and IPv6 addresses are
+// tracked separately, so that a lookup which only finds an address of the
+// other family is not considered a change.
+type history struct {
+	sync.Mutex
+	changes   []Change  // oldest first
+	current   [2]net.IP // by family, IPv4 first
+	previous  net.IP
+	changedAt time.Time
+	size      int
+	urgentFor time.Duration
+	onChange  func(Info)
+	urgent    *timing.Scheduler
+}
+
+func newHistory() *history {
+	return &history{
+		size:   10,
+		urgent: timing.NewScheduler(),
+	}
+}
+
+// Record adds the IPv4 and IPv6 address of result to the history if they
+// differ from the most recent address of the same family. Missing addresses,
+// e.g. while offline or if the lookup of one family failed, are ignored.
+// Returns true if an address changed, which is not the case for the first
+// address recorded per family.
+func (h *history) Record(result Result) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	changed := false
+
+	for family, ip := range []net.IP{result.IPv4, result.IPv6} {
+		current := h.current[family]
+		if ip == nil || current.Equal(ip) {
+			continue
+		}
+
+		h.current[family] = ip
+		h.changes = append(h.changes, Change{IP: ip, Time: timing.Now()})
+
+		if current != nil {
+			h.previous = current
+			h.changedAt = timing.Now()
+			changed = true
+		}
+	}
+
+	if h.size > 0 && len(h.changes) > h.size {
+		h.changes = h.changes[len(h.changes)-h.size:]
+	}
+
+	if changed && h.urgentFor > 0 {
+		h.urgent.After(h.urgentFor)
+	}
+
+	return changed
+}
+
+// Fill populates the history related fields of info.
+func (h *history) Fill(info *Info) {
+	h.Lock()
+	defer h.Unlock()
+
+	n := len(h.changes)
+	if n == 0 {
+		return
+	}
+
+	info.History = make([]Change, n)
+	for i, change := range h.changes {
+		info.History[n-1-i] = change
+	}
+
+	if h.previous == nil {
+		return
+	}
+
+	info.Previous = h.previous
+	info.ChangedAt = h.changedAt
+	info.RecentlyChanged = timing.Now().Before(info.ChangedAt.Add(h.urgentFor))
+}
+
+// OnChange returns the func that should be called on IP changes.
+func (h *history) OnChange() func(Info) {
+	h.Lock()
+	defer h.Unlock()
+	return h.onChange
+}
+
+// NotifyDesktop sends a desktop notification about an IP change using
+// notify-send. It can be passed to Module.OnChange. The addresses are masked
+// according to Info.Mask.
+func NotifyDesktop(info Info) {
+	current := info.IPv6
+	if info.Previous.To4() != nil {
+		current = info.IPv4
+	}
+
+	body := fmt.Sprintf("%s → %s", MaskIP(info.Previous, info.Mask), MaskIP(current, info.Mask))
+
+	if err := exec.CommandRun("notify-send", "-a", "barista", "Public IP changed", body); err != nil {
+		l.Log("Error sending IP change notification: %v", err)
+	}
+}
@@ -1,12 +1,14 @@
 package ip
 
 import (
+	"context"
 	"net"
 	"time"
 
 	"barista.run/bar"
 	"barista.run/base/notifier"
 	"barista.run/base/value"
+	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
 )
@@ -26,13 +28,183 @@ func (f ProviderFunc) GetIP() (net.IP, error) {
 	return f()
 }
 
+// Result is the result of an IP lookup.
+type Result struct {
+	// IP is the public IP or nil if not connected. If the provider reports
+	// both IPv4 and IPv6 addresses, it is usually the IPv4 address.
+	IP net.IP
+
+	// IPv4 is the public IPv4 address or nil if there is no IPv4
+	// connectivity.
+	IPv4 net.IP
+
+	// IPv6 is the public IPv6 address or nil if there is no IPv6
+	// connectivity.
+	IPv6 net.IP
+
+	// Source describes where the IP was obtained from, e.g. the name of the
+	// service that answered.
+	Source string
+
+	// Geo contains location and network information about IP. Providers may
+	// set it if the service they use reports it. Otherwise it is populated
+	// by the Enricher configured on the module, if any.
+	Geo Geo
+
+	// Interfaces are the local network interfaces and their addresses. Only
+	// set by providers that inspect the local network configuration.
+	Interfaces []Interface
+
+	// Route is the default route. Only set by providers that inspect the
+	// local network configuration.
+	Route Route
+
+	// Connectivity is the state of the internet connection. Providers may
+	// set it to explain why no IP was found, e.g. CaptivePortal. If left
+	// Unknown, the module derives it from IP and the ConnectivityChecker
+	// configured via CheckConnectivity, if any.
+	Connectivity Connectivity
+}
+
+// Normalize fills in missing fields of r. Single-stack results get IPv4 or
+// IPv6 set depending on the address family of IP, dual-stack results get IP
+// set to the IPv4 address, falling back to the IPv6 address. The module
+// normalizes all results, providers may use it to populate IP for GetIP.
+func (r Result) Normalize() Result {
+	if r.IP == nil {
+		r.IP = r.IPv4
+	}
+
+	if r.IP == nil {
+		r.IP = r.IPv6
+	}
+
+	if r.IPv4 == nil && r.IPv6 == nil && r.IP != nil {
+		if r.IP.To4() != nil {
+			r.IPv4 = r.IP
+		} else {
+			r.IPv6 = r.IP
+		}
+	}
+
+	return r
+}
+
+// ResultProvider is a Provider which returns detailed lookup results, e.g.
+// the source of the IP or separate IPv4 and IPv6 addresses. The module uses
+// it instead of Provider.GetIP if the provider implements it.
+type ResultProvider interface {
+	Provider
+
+	// Lookup retrieves the current public client IP. The IP addresses must be
+	// nil if there is no internet connection.
+	Lookup() (Result, error)
+}
+
 // Info contains the client's public IP address or nil of not connected.
 type Info struct {
 	net.IP
+
+	// IPv4 is the public IPv4 address or nil if there is no IPv4
+	// connectivity.
+	IPv4 net.IP
+
+	// IPv6 is the public IPv6 address or nil if there is no IPv6
+	// connectivity.
+	IPv6 net.IP
+
+	// Source describes where the IP was obtained from. Only set if the
+	// provider reports it.
+	Source string
+
+	// Geo contains location and network information about IP. Only set if
+	// the provider reports it or an Enricher is configured.
+	Geo Geo
+
+	// Interfaces are the local network interfaces and their addresses. Only
+	// set if the provider reports them.
+	Interfaces []Interface
+
+	// Route is the default route. Only set if the provider reports it.
+	Route Route
+
+	// Connectivity is the state of the internet connection.
+	Connectivity Connectivity
+
+	// Mask is the mask mode currently in effect. It is Unmasked while the
+	// IP is revealed.
+	Mask MaskMode
+
+	// Previous is the public IP before the last change. IPv4 and IPv6
+	// addresses are tracked separately, so Previous is of the same family as
+	// the address that changed last. Nil if the IP did not change yet.
+	Previous net.IP
+
+	// ChangedAt is the time of the last IP change. Zero if the IP did not
+	// change yet.
+	ChangedAt time.Time
+
+	// RecentlyChanged is true within the time window configured via
+	// UrgentFor after the IP changed.
+	RecentlyChanged bool
+
+	// History contains the distinct public IPs seen by the module together
+	// with the time they were first seen, newest first.
+	History []Change
+}
+
+// SinceChange returns the time since the last IP change. Returns zero if the
+// IP did not change yet.
+func (i Info) SinceChange() time.Duration {
+	if i.ChangedAt.IsZero() {
+		return 0
+	}
+
+	return timing.Now().Sub(i.ChangedAt)
+}
+
+// Interface returns the local interface with name.
+func (i Info) Interface(name string) (Interface, bool) {
+	for _, iface := range i.Interfaces {
+		if iface.Name == name {
+			return iface, true
+		}
+	}
+
+	return Interface{}, false
+}
+
+// VPN returns true if any local VPN interface is up and has addresses.
+func (i Info) VPN() bool {
+	for _, iface := range i.Interfaces {
+		if iface.VPN && iface.Up && len(iface.Addrs) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DualStack returns true if both IPv4 and IPv6 are available.
+func (i Info) DualStack() bool {
+	return i.IPv4 != nil && i.IPv6 != nil
+}
+
+// CompactString returns a compact representation of the IP addresses. If
+// both IPv4 and IPv6 are available, the IPv4 address is followed by "+v6",
+// e.g. "203.0.113.1 +v6". Otherwise the available address is returned. The
+// addresses are masked according to Mask.
+func (i Info) CompactString() string {
+	if i.DualStack() && i.Mask != MaskHidden {
+		return MaskIP(i.IPv4, i.Mask) + " +v6"
+	}
+
+	return MaskIP(i.IP, i.Mask)
 }
 
 // Connected returns true when the client is connected to the internet, that is
-// the IP address is not nil.
+// the IP address is not nil. Connectivity describes why the client is not
+// connected otherwise.
 func (i Info) Connected() bool {
 	return i.IP != nil
 }
@@ -45,6 +217,26 @@ type Module struct {
 	notifyCh   <-chan struct{}
 	notifyFn   func()
 	scheduler  *timing.Scheduler
+	enrichment *enrichment
+	watcher    value.Value // of watcher
+	debounce   *timing.Scheduler
+	history    *history
+	checker    value.Value // of ConnectivityChecker
+	masking    *masking
+}
+
+// Watcher notifies about changes of the network configuration, e.g. new
+// addresses or routes.
+type Watcher interface {
+	// Watch returns a channel which receives a value whenever the network
+	// configuration changes. Watching stops and the channel is closed once
+	// ctx is done.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+type watcher struct {
+	Watcher
+	delay time.Duration
 }
 
 // New creates a new *Module with the given provider for looking up the ip
@@ -53,26 +245,41 @@ type Module struct {
 // the bar output will also update the module output if not overridden.
 func New(provider Provider) *Module {
 	m := &Module{
-		provider:  provider,
-		scheduler: timing.NewScheduler(),
+		provider:   provider,
+		scheduler:  timing.NewScheduler(),
+		enrichment: &enrichment{},
+		debounce:   timing.NewScheduler(),
+		history:    newHistory(),
+		masking:    newMasking(),
 	}
 
 	m.notifyFn, m.notifyCh = notifier.New()
 	m.outputFunc.Set(func(info Info) bar.Output {
 		if info.Connected() {
-			return outputs.Text(info.String())
+			return outputs.Text(info.CompactString()).Urgent(info.RecentlyChanged)
 		}
-		return outputs.Text("offline")
+		return outputs.Text(info.Connectivity.String())
 	})
 
+	m.watcher.Set(watcher{})
 	m.Every(10 * time.Minute)
 
 	return m
 }
 
-func defaultClickHandler(m *Module) func(bar.Event) {
+func defaultClickHandler(m *Module, info Info) func(bar.Event) {
 	return func(e bar.Event) {
-		if e.Button == bar.ButtonLeft {
+		if e.Button != bar.ButtonLeft {
+			return
+		}
+
+		if m.masking.CopyOnClick() && info.IP != nil {
+			if err := CopyToClipboard(info.IP.String()); err != nil {
+				l.Log("Error copying IP to clipboard: %v", err)
+			}
+		}
+
+		if !m.masking.Toggle() {
 			m.Refresh()
 		}
 	}
@@ -80,26 +287,168 @@ func defaultClickHandler(m *Module) func(bar.Event) {
 
 // Stream implements bar.Module.
 func (m *Module) Stream(s bar.Sink) {
-	ip, err := m.provider.GetIP()
+	result, err := m.lookup()
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	w := m.watcher.Get().(watcher)
+	changes, stop := m.watch(w)
+	debouncing := false
 	for {
 		if !s.Error(err) {
-			info := Info{
-				IP: ip,
+			info := m.newInfo(result)
+			s.Output(outputs.Group(outputFunc(info)).OnClick(defaultClickHandler(m, info)))
+		}
+
+		// Network changes are debounced and do not cause an output until the
+		// debounce delay elapsed. The delay starts with the first change of a
+		// burst and is not extended by further changes, so that a steady
+		// stream of changes does not postpone the refresh indefinitely.
+		for updated := false; !updated; {
+			updated = true
+
+			select {
+			case <-m.outputFunc.Next():
+				outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+			case <-m.notifyCh:
+				result, err = m.lookup()
+			case <-m.scheduler.C:
+				result, err = m.lookup()
+			case <-m.debounce.C:
+				debouncing = false
+				result, err = m.lookup()
+			case <-m.history.urgent.C:
+			case <-m.masking.notifyCh:
+			case <-m.masking.remask.C:
+				m.masking.Remask()
+			case <-m.watcher.Next():
+				stop()
+				w = m.watcher.Get().(watcher)
+				changes, stop = m.watch(w)
+				updated = false
+			case _, ok := <-changes:
+				if ok && !debouncing {
+					debouncing = true
+					m.debounce.After(w.delay)
+				} else if !ok {
+					l.Log("Stopped watching network changes")
+					changes = nil
+				}
+				updated = false
 			}
+		}
+	}
+}
+
+// watch starts watching for network changes using w. The returned func stops
+// watching. The channel is nil if no watcher is configured or watching
+// failed.
+func (m *Module) watch(w watcher) (<-chan struct{}, func()) {
+	if w.Watcher == nil {
+		return nil, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	changes, err := w.Watch(ctx)
+	if err != nil {
+		l.Log("Error watching network changes: %v", err)
+		cancel()
+		return nil, cancel
+	}
+
+	return changes, cancel
+}
+
+func (m *Module) lookup() (Result, error) {
+	var result Result
+	var err error
 
-			s.Output(outputs.Group(outputFunc(info)).OnClick(defaultClickHandler(m)))
+	if p, ok := m.provider.(ResultProvider); ok {
+		result, err = p.Lookup()
+	} else {
+		result.IP, err = m.provider.GetIP()
+	}
+
+	if err == nil {
+		result = result.Normalize()
+	}
+
+	if err != nil || result.IP == nil {
+		result, err = m.checkConnectivity(result, err)
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if result.Connectivity == Unknown {
+		result.Connectivity = Online
+	}
+
+	if result.Geo.IsZero() {
+		result.Geo = m.enrichment.Enrich(result.IP)
+	}
+
+	if m.history.Record(result) {
+		if onChange := m.history.OnChange(); onChange != nil {
+			// Do not block refreshes, e.g. while sending notifications.
+			go onChange(m.newInfo(result))
+		}
+	}
+
+	return result, nil
+}
+
+// checkConnectivity determines the connectivity state after a lookup failed or
+// did not find an IP. The error of the lookup is only returned if the
+// configured ConnectivityChecker does not report a more specific state.
+func (m *Module) checkConnectivity(result Result, err error) (Result, error) {
+	state := result.Connectivity
+	if err != nil {
+		state = ErrorConnectivity(err)
+	}
+
+	if checker, ok := m.checker.Get().(ConnectivityChecker); ok && (state == Unknown || state == Offline) {
+		checked, checkErr := checker.CheckConnectivity()
+		if checkErr != nil {
+			l.Log("Error checking connectivity: %v", checkErr)
+		} else if checked != Online && checked != Unknown {
+			state = checked
 		}
+	}
 
-		select {
-		case <-m.outputFunc.Next():
-			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
-		case <-m.notifyCh:
-			ip, err = m.provider.GetIP()
-		case <-m.scheduler.C:
-			ip, err = m.provider.GetIP()
+	if state == Unknown {
+		if err != nil {
+			return Result{}, err
 		}
+
+		state = Offline
+	}
+
+	// Results without an IP may still carry information about the local
+	// network, which is kept.
+	result.IP, result.IPv4, result.IPv6 = nil, nil, nil
+	result.Connectivity = state
+
+	return result, nil
+}
+
+func (m *Module) newInfo(result Result) Info {
+	info := Info{
+		IP:     result.IP,
+		IPv4:   result.IPv4,
+		IPv6:   result.IPv6,
+		Source: result.Source,
+		Geo:    result.Geo,
+
+		Interfaces:   result.Interfaces,
+		Route:        result.Route,
+		Connectivity: result.Connectivity,
 	}
+
+	m.history.Fill(&info)
+	info.Mask = m.masking.Mode()
+
+	return info
 }
 
 // Output updates the output format func.
@@ -119,6 +468,96 @@ func (m *Module) Every(interval time.Duration) *Module {
 	return m
 }
 
+// Enrich configures an Enricher which is used to populate Info.Geo.
+// Results are cached per IP, so the enricher is only queried when the IP
+// changes.
+func (m *Module) Enrich(enricher Enricher) *Module {
+	m.enrichment.Set(enricher)
+	return m
+}
+
+// RefreshOnChange configures a Watcher which triggers a refresh whenever the
+// network configuration changes, e.g. after connecting to a different network
+// or a VPN. Bursts of changes are debounced, so that the refresh happens
+// delay after the first change of a burst, once the network configuration
+// settled. With a watcher in place,
+// the refresh interval configured via Every can be relaxed.
+func (m *Module) RefreshOnChange(w Watcher, delay time.Duration) *Module {
+	m.watcher.Set(watcher{Watcher: w, delay: delay})
+	return m
+}
+
+// CheckConnectivity configures a ConnectivityChecker which is used to find
+// out why the public IP could not be looked up, e.g. because of a captive
+// portal. The result is exposed via Info.Connectivity.
+func (m *Module) CheckConnectivity(checker ConnectivityChecker) *Module {
+	m.checker.Set(checker)
+	return m
+}
+
+// HistorySize configures the number of distinct IPs kept in the history.
+// Defaults to 10. Passing zero keeps all IPs.
+func (m *Module) HistorySize(size int) *Module {
+	m.history.Lock()
+	defer m.history.Unlock()
+	m.history.size = size
+	return m
+}
+
+// UrgentFor configures the time window after an IP change during which
+// Info.RecentlyChanged is true. The default output is marked urgent during
+// this window. Disabled by default.
+func (m *Module) UrgentFor(d time.Duration) *Module {
+	m.history.Lock()
+	defer m.history.Unlock()
+	m.history.urgentFor = d
+	return m
+}
+
+// OnChange configures a func which is called whenever the public IPv4 or IPv6
+// address changes, e.g. NotifyDesktop to send a desktop notification. It is
+// called on a separate goroutine, so calls for changes in quick succession
+// may run concurrently. Info.Mask is set to the mask mode currently in
+// effect, use MaskIP to honor it.
+func (m *Module) OnChange(fn func(Info)) *Module {
+	m.history.Lock()
+	defer m.history.Unlock()
+	m.history.onChange = fn
+	return m
+}
+
+// Mask configures how the IP is masked in the bar, e.g. to avoid exposing it
+// while sharing the screen. If enabled, clicking on the bar output reveals
+// the full IP instead of refreshing it. Only the default output masks the IP,
+// the IP, IPv4, IPv6, Previous and History fields of the Info passed to
+// custom output funcs are never masked. These should use Info.CompactString or
+// MaskIP to honor the mask.
+func (m *Module) Mask(mode MaskMode) *Module {
+	m.masking.Lock()
+	defer m.masking.Unlock()
+	m.masking.mode = mode
+	return m
+}
+
+// RemaskAfter configures the time after which a revealed IP is masked again.
+// Defaults to 10 seconds. Passing zero keeps the IP revealed until the next
+// click.
+func (m *Module) RemaskAfter(timeout time.Duration) *Module {
+	m.masking.Lock()
+	defer m.masking.Unlock()
+	m.masking.timeout = timeout
+	return m
+}
+
+// CopyOnClick configures the module to copy the full IP to the clipboard when
+// the bar output is clicked, regardless of the mask.
+func (m *Module) CopyOnClick() *Module {
+	m.masking.Lock()
+	defer m.masking.Unlock()
+	m.masking.copyOnClick = true
+	return m
+}
+
 // Refresh forces a refresh of the module output.
 func (m *Module) Refresh() {
 	m.notifyFn()
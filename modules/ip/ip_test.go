@@ -1,14 +1,24 @@
 package ip
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/url"
+	"os"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"barista.run/bar"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testProvider struct {
@@ -90,3 +100,597 @@ func TestModule(t *testing.T) {
 	out = testBar.NextOutput("click")
 	out.AssertText([]string{"ip: 20.20.20.20"})
 }
+
+type testResultProvider struct {
+	testProvider
+	source string
+}
+
+func (p *testResultProvider) Lookup() (Result, error) {
+	ip, err := p.GetIP()
+	return Result{IP: ip, Source: p.source}, err
+}
+
+func TestModule_ResultProvider(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testResultProvider{
+		testProvider: testProvider{ip: net.ParseIP("1.1.1.1")},
+		source:       "ipify",
+	}
+
+	m := New(testProvider).Output(func(info Info) bar.Output {
+		return outputs.Textf("%s via %s", info.IP, info.Source)
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"1.1.1.1 via ipify"})
+}
+
+type testDualStackProvider struct {
+	sync.Mutex
+	v4, v6 net.IP
+}
+
+func (p *testDualStackProvider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+func (p *testDualStackProvider) Lookup() (Result, error) {
+	p.Lock()
+	defer p.Unlock()
+	return Result{IPv4: p.v4, IPv6: p.v6}, nil
+}
+
+func (p *testDualStackProvider) set(v4, v6 net.IP) {
+	p.Lock()
+	defer p.Unlock()
+	p.v4, p.v6 = v4, v6
+}
+
+func TestModule_DualStack(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testDualStackProvider{
+		v4: net.ParseIP("203.0.113.1"),
+		v6: net.ParseIP("2001:db8::1"),
+	}
+
+	m := New(testProvider)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.113.1 +v6"})
+
+	testProvider.set(nil, net.ParseIP("2001:db8::1"))
+	m.Refresh()
+	out = testBar.NextOutput("IPv6 only")
+	out.AssertText([]string{"2001:db8::1"})
+
+	testProvider.set(nil, nil)
+	m.Refresh()
+	out = testBar.NextOutput("offline")
+	out.AssertText([]string{"offline"})
+
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%v %v %v %v", info.IP, info.IPv4, info.IPv6, info.DualStack())
+	})
+	testProvider.set(net.ParseIP("203.0.113.1"), nil)
+	m.Refresh()
+	out = testBar.LatestOutput("IPv4 only")
+	out.AssertText([]string{"203.0.113.1 203.0.113.1 <nil> false"})
+}
+
+func TestResult_Normalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   Result
+		expected Result
+	}{
+		{
+			name:     "single IPv4",
+			result:   Result{IP: net.ParseIP("203.0.113.1")},
+			expected: Result{IP: net.ParseIP("203.0.113.1"), IPv4: net.ParseIP("203.0.113.1")},
+		},
+		{
+			name:     "single IPv6",
+			result:   Result{IP: net.ParseIP("2001:db8::1")},
+			expected: Result{IP: net.ParseIP("2001:db8::1"), IPv6: net.ParseIP("2001:db8::1")},
+		},
+		{
+			name:     "dual stack",
+			result:   Result{IPv4: net.ParseIP("203.0.113.1"), IPv6: net.ParseIP("2001:db8::1")},
+			expected: Result{IP: net.ParseIP("203.0.113.1"), IPv4: net.ParseIP("203.0.113.1"), IPv6: net.ParseIP("2001:db8::1")},
+		},
+		{
+			name: "offline",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.result.Normalize())
+		})
+	}
+}
+
+type testConnectivityProvider struct {
+	testProvider
+	connectivity Connectivity
+}
+
+func (p *testConnectivityProvider) Lookup() (Result, error) {
+	ip, err := p.GetIP()
+	return Result{IP: ip, Connectivity: p.connectivity}, err
+}
+
+func TestModule_Connectivity(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testConnectivityProvider{}
+
+	var mu sync.Mutex
+	var state Connectivity
+	var checkErr error
+
+	checker := ConnectivityCheckerFunc(func() (Connectivity, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return state, checkErr
+	})
+
+	setState := func(s Connectivity, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		state, checkErr = s, err
+	}
+
+	m := New(testProvider).Every(0)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"offline"})
+
+	testProvider.setError(&net.DNSError{Err: "server misbehaving", IsTemporary: true})
+	m.Refresh()
+	out = testBar.NextOutput("temporary error")
+	out.AssertText([]string{"offline"})
+
+	testProvider.setError(nil)
+	testProvider.Lock()
+	testProvider.connectivity = CaptivePortal
+	testProvider.Unlock()
+	m.Refresh()
+	out = testBar.NextOutput("reported by provider")
+	out.AssertText([]string{"captive portal"})
+
+	testProvider.Lock()
+	testProvider.connectivity = Unknown
+	testProvider.Unlock()
+	m.CheckConnectivity(checker)
+	setState(ProxyRequired, nil)
+	m.Refresh()
+	out = testBar.NextOutput("reported by checker")
+	out.AssertText([]string{"proxy required"})
+
+	testProvider.setError(errors.New("whoops"))
+	setState(DNSBroken, nil)
+	m.Refresh()
+	out = testBar.NextOutput("lookup error explained by checker")
+	out.AssertText([]string{"DNS broken"})
+
+	setState(Online, nil)
+	m.Refresh()
+	out = testBar.NextOutput("lookup error not explained by checker")
+	out.AssertError()
+
+	testProvider.setError(nil)
+	setState(Unknown, errors.New("check failed"))
+	m.Refresh()
+	out = testBar.NextOutput("check failed")
+	out.AssertText([]string{"offline"})
+
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%s %s", info.IP, info.Connectivity)
+	})
+	testProvider.setIP(net.ParseIP("203.0.113.1"))
+	m.Refresh()
+	out = testBar.LatestOutput("online")
+	out.AssertText([]string{"203.0.113.1 online"})
+}
+
+func TestErrorConnectivity(t *testing.T) {
+	assert.Equal(t, DNSBroken, ErrorConnectivity(&net.OpError{Err: &net.DNSError{IsNotFound: true}}))
+	assert.Equal(t, Offline, ErrorConnectivity(&net.DNSError{IsTimeout: true}))
+	assert.Equal(t, Unknown, ErrorConnectivity(errors.New("whoops")))
+
+	for _, errno := range []syscall.Errno{syscall.ENETUNREACH, syscall.EHOSTUNREACH, syscall.ECONNREFUSED} {
+		err := &url.Error{
+			Op:  "Get",
+			URL: "https://api.ipify.org",
+			Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)},
+		}
+
+		assert.Equal(t, Offline, ErrorConnectivity(err), errno.Error())
+	}
+}
+
+func TestConnectivity_MoreSpecific(t *testing.T) {
+	assert.Equal(t, Offline, Unknown.MoreSpecific(Offline))
+	assert.Equal(t, Offline, Offline.MoreSpecific(Unknown))
+	assert.Equal(t, CaptivePortal, Offline.MoreSpecific(CaptivePortal))
+	assert.Equal(t, DNSBroken, DNSBroken.MoreSpecific(Offline))
+	assert.Equal(t, ProxyRequired, ProxyRequired.MoreSpecific(CaptivePortal))
+}
+
+func TestModule_Enrich(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		ip: net.ParseIP("203.0.113.1"),
+	}
+
+	var mu sync.Mutex
+	var lookups []string
+
+	enricher := EnricherFunc(func(ip net.IP) (Geo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups = append(lookups, ip.String())
+
+		if ip.Equal(net.ParseIP("198.51.100.1")) {
+			return Geo{}, errors.New("whoops")
+		}
+
+		return Geo{Country: "Germany", CountryCode: "DE", City: "Berlin", ASN: 64496, Org: "Example"}, nil
+	})
+
+	m := New(testProvider).Enrich(enricher).Output(func(info Info) bar.Output {
+		return outputs.Textf("%s %s", info.IP, info.Geo)
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.113.1 DE AS64496 Example"})
+
+	m.Refresh()
+	out = testBar.NextOutput("refresh")
+	out.AssertText([]string{"203.0.113.1 DE AS64496 Example"})
+
+	testProvider.setIP(net.ParseIP("198.51.100.1"))
+	m.Refresh()
+	out = testBar.NextOutput("enrichment failed")
+	out.AssertText([]string{"198.51.100.1 "})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"203.0.113.1", "198.51.100.1"}, lookups, "results are cached")
+}
+
+func TestInfo_VPN(t *testing.T) {
+	info := Info{
+		Interfaces: []Interface{
+			{Name: "eth0", Up: true, Addrs: []*net.IPNet{{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}}},
+			{Name: "wg0", VPN: true},
+		},
+	}
+
+	assert.False(t, info.VPN(), "VPN interface without addresses")
+
+	info.Interfaces[1].Up = true
+	info.Interfaces[1].Addrs = []*net.IPNet{{IP: net.ParseIP("10.8.0.2"), Mask: net.CIDRMask(32, 32)}}
+	assert.True(t, info.VPN())
+
+	iface, ok := info.Interface("eth0")
+	assert.True(t, ok)
+	assert.Equal(t, net.ParseIP("192.168.1.10").To4(), iface.IPv4())
+	assert.Nil(t, iface.IPv6())
+
+	_, ok = info.Interface("eth1")
+	assert.False(t, ok)
+}
+
+type testWatcher struct {
+	ch  chan struct{}
+	ctx context.Context
+}
+
+func (w *testWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	w.ctx = ctx
+	return w.ch, nil
+}
+
+func TestModule_RefreshOnChange(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		ip: net.ParseIP("203.0.113.1"),
+	}
+
+	watcher := &testWatcher{ch: make(chan struct{})}
+
+	m := New(testProvider).Every(0).RefreshOnChange(watcher, 2*time.Second)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.113.1"})
+
+	// sync waits until the module processed all pending changes by forcing a
+	// refresh, which is handled by the same goroutine.
+	sync := func() {
+		m.Refresh()
+		testBar.NextOutput("refreshed")
+	}
+
+	watcher.ch <- struct{}{}
+	watcher.ch <- struct{}{}
+	sync()
+	testBar.AssertNoOutput("changes are debounced")
+
+	timing.AdvanceBy(time.Second)
+	watcher.ch <- struct{}{}
+	sync()
+
+	testProvider.setIP(net.ParseIP("198.51.100.1"))
+
+	timing.AdvanceBy(time.Second)
+	out = testBar.NextOutput("network changed")
+	out.AssertText([]string{"198.51.100.1"}, "debounce delay is not extended by further changes")
+
+	timing.AdvanceBy(2 * time.Second)
+	testBar.AssertNoOutput("burst causes a single refresh")
+
+	close(watcher.ch)
+	testBar.AssertNoOutput("watcher closed")
+
+	other := &testWatcher{ch: make(chan struct{})}
+	m.RefreshOnChange(other, time.Second)
+	sync()
+
+	select {
+	case <-watcher.ctx.Done():
+	default:
+		t.Fatal("previous watcher was not stopped")
+	}
+
+	assert.NoError(t, other.ctx.Err())
+
+	testProvider.setIP(net.ParseIP("192.0.2.1"))
+	other.ch <- struct{}{}
+	sync()
+
+	timing.AdvanceBy(time.Second)
+	out = testBar.NextOutput("network changed")
+	out.AssertText([]string{"192.0.2.1"})
+}
+
+func TestModule_History(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{
+		ip: net.ParseIP("203.0.113.1"),
+	}
+
+	var mu sync.Mutex
+	var changes []string
+
+	m := New(testProvider).Every(0).HistorySize(2).UrgentFor(time.Minute).OnChange(func(info Info) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, fmt.Sprintf("%s -> %s", info.Previous, info.IP))
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.113.1"})
+	assertUrgent(t, out, false)
+
+	testProvider.setIP(nil)
+	m.Refresh()
+	out = testBar.NextOutput("offline")
+	out.AssertText([]string{"offline"})
+
+	testProvider.setIP(net.ParseIP("203.0.113.1"))
+	m.Refresh()
+	out = testBar.NextOutput("back online")
+	out.AssertText([]string{"203.0.113.1"})
+	assertUrgent(t, out, false)
+
+	timing.AdvanceBy(time.Hour)
+	changedAt := timing.Now()
+
+	testProvider.setIP(net.ParseIP("198.51.100.1"))
+	m.Refresh()
+	out = testBar.NextOutput("ip changed")
+	out.AssertText([]string{"198.51.100.1"})
+	assertUrgent(t, out, true)
+
+	timing.AdvanceBy(time.Minute)
+	out = testBar.NextOutput("urgent window expired")
+	out.AssertText([]string{"198.51.100.1"})
+	assertUrgent(t, out, false)
+
+	testProvider.setIP(net.ParseIP("192.0.2.1"))
+
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%s %s %s %v", info.IP, info.Previous, info.SinceChange(), info.History)
+	})
+	m.Refresh()
+	out = testBar.LatestOutput("ip changed again")
+	out.AssertText([]string{fmt.Sprintf(
+		"192.0.2.1 198.51.100.1 0s [{192.0.2.1 %s} {198.51.100.1 %s}]",
+		timing.Now(), changedAt,
+	)})
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) == 2
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"203.0.113.1 -> 198.51.100.1", "198.51.100.1 -> 192.0.2.1"}, changes)
+}
+
+func TestModule_HistoryDualStack(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testDualStackProvider{
+		v4: net.ParseIP("203.0.113.1"),
+		v6: net.ParseIP("2001:db8::1"),
+	}
+
+	changes := make(chan Info, 10)
+
+	m := New(testProvider).Every(0).OnChange(func(info Info) {
+		changes <- info
+	})
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%v %v", info.IP, info.Previous)
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.113.1 <nil>"})
+
+	testProvider.set(nil, net.ParseIP("2001:db8::1"))
+	m.Refresh()
+	out = testBar.NextOutput("IPv4 lookup failed")
+	out.AssertText([]string{"2001:db8::1 <nil>"}, "falling back to IPv6 is not a change")
+
+	testProvider.set(net.ParseIP("203.0.113.1"), net.ParseIP("2001:db8::2"))
+	m.Refresh()
+	out = testBar.NextOutput("IPv6 changed")
+	out.AssertText([]string{"203.0.113.1 2001:db8::1"})
+
+	select {
+	case info := <-changes:
+		assert.Equal(t, net.ParseIP("2001:db8::1"), info.Previous)
+		assert.Equal(t, net.ParseIP("2001:db8::2"), info.IPv6)
+	case <-time.After(time.Second):
+		t.Fatal("OnChange was not called")
+	}
+
+	assert.Empty(t, changes)
+}
+
+func assertUrgent(t *testing.T, out testBar.Output, expected bool) {
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	assert.Equal(t, expected, urgent)
+}
+
+func TestModule_Mask(t *testing.T) {
+	testBar.New(t)
+
+	if display, ok := os.LookupEnv("WAYLAND_DISPLAY"); ok {
+		os.Unsetenv("WAYLAND_DISPLAY")
+		defer os.Setenv("WAYLAND_DISPLAY", display)
+	}
+
+	var mu sync.Mutex
+	var cmds []exec.Cmd
+
+	defer exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, cmd)
+		return nil
+	})()
+
+	testProvider := &testProvider{
+		ip: net.ParseIP("203.0.113.1"),
+	}
+
+	m := New(testProvider).Every(0).Mask(MaskPartial).RemaskAfter(time.Minute).CopyOnClick()
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"203.0.x.x"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("revealed")
+	out.AssertText([]string{"203.0.113.1"})
+
+	timing.AdvanceBy(time.Minute)
+	out = testBar.NextOutput("masked after timeout")
+	out.AssertText([]string{"203.0.x.x"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("revealed again")
+	out.AssertText([]string{"203.0.113.1"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("masked on click")
+	out.AssertText([]string{"203.0.x.x"})
+
+	m.Mask(MaskHidden)
+	m.Refresh()
+	out = testBar.NextOutput("hidden")
+	out.AssertText([]string{"hidden"})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, cmds, 3)
+	for _, cmd := range cmds {
+		assert.True(t, cmd.Matches("xclip", "-selection", "clipboard"))
+		assert.Equal(t, "203.0.113.1", string(cmd.Stdin))
+	}
+}
+
+func TestInfo_CompactString(t *testing.T) {
+	info := Info{
+		IP:   net.ParseIP("203.0.113.1"),
+		IPv4: net.ParseIP("203.0.113.1"),
+		IPv6: net.ParseIP("2001:db8::1"),
+	}
+
+	assert.Equal(t, "203.0.113.1 +v6", info.CompactString())
+
+	info.Mask = MaskPartial
+	assert.Equal(t, "203.0.x.x +v6", info.CompactString())
+
+	info.Mask = MaskHidden
+	assert.Equal(t, "hidden", info.CompactString())
+}
+
+func TestMaskIP(t *testing.T) {
+	tests := []struct {
+		ip       net.IP
+		mode     MaskMode
+		expected string
+	}{
+		{net.ParseIP("203.0.113.1"), Unmasked, "203.0.113.1"},
+		{net.ParseIP("203.0.113.1"), MaskPartial, "203.0.x.x"},
+		{net.ParseIP("2001:db8::1"), MaskPartial, "2001:db8:x:x:x:x:x:x"},
+		{net.ParseIP("2001:db8::1"), MaskHidden, "hidden"},
+		{nil, MaskPartial, "<nil>"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, MaskIP(test.ip, test.mode))
+	}
+}
+
+func TestNotifyDesktop(t *testing.T) {
+	var cmds []exec.Cmd
+
+	defer exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})()
+
+	NotifyDesktop(Info{IP: net.ParseIP("192.0.2.1"), IPv4: net.ParseIP("192.0.2.1"), Previous: net.ParseIP("198.51.100.1")})
+	NotifyDesktop(Info{IP: net.ParseIP("192.0.2.1"), IPv4: net.ParseIP("192.0.2.1"), IPv6: net.ParseIP("2001:db8::2"), Previous: net.ParseIP("2001:db8::1")})
+	NotifyDesktop(Info{IP: net.ParseIP("192.0.2.1"), IPv4: net.ParseIP("192.0.2.1"), Previous: net.ParseIP("198.51.100.1"), Mask: MaskPartial})
+	NotifyDesktop(Info{IP: net.ParseIP("192.0.2.1"), IPv4: net.ParseIP("192.0.2.1"), Previous: net.ParseIP("198.51.100.1"), Mask: MaskHidden})
+
+	require.Len(t, cmds, 4)
+	assert.True(t, cmds[0].Matches("notify-send", "-a", "barista", "Public IP changed", "198.51.100.1 → 192.0.2.1"))
+	assert.True(t, cmds[1].Matches("notify-send", "-a", "barista", "Public IP changed", "2001:db8::1 → 2001:db8::2"))
+	assert.True(t, cmds[2].Matches("notify-send", "-a", "barista", "Public IP changed", "198.51.x.x → 192.0.x.x"))
+	assert.True(t, cmds[3].Matches("notify-send", "-a", "barista", "Public IP changed", "hidden → hidden"))
+}
@@ -2,48 +2,324 @@ package ipify
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/martinohmann/barista-contrib/modules/ip"
 )
 
+// Default base URLs of the ipify API.
+const (
+	DefaultIPv4URL = "https://api.ipify.org"
+	DefaultIPv6URL = "https://api64.ipify.org"
+)
+
+// Format is the response format requested from the API.
+type Format string
+
+// Supported response formats.
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *provider)
+
+// BaseURL configures the URLs used to look up the IPv4 and IPv6 address, e.g.
+// to point the provider at a self-hosted instance. Passing an empty v6URL
+// disables the IPv6 lookup. Defaults to DefaultIPv4URL and DefaultIPv6URL.
+func BaseURL(v4URL, v6URL string) Option {
+	return func(p *provider) {
+		p.v4URL = v4URL
+		p.v6URL = v6URL
+	}
+}
+
+// Client configures the HTTP client used for requests, e.g. to route them
+// through a proxy. Defaults to http.DefaultClient. If the client uses an
+// *http.Transport, connections are forced to the IP version that is looked
+// up, otherwise the transport is used as is. Requests sent via the proxy of
+// the transport, e.g. from HTTPS_PROXY, are not forced to an IP version, as
+// that only affects the connection to the proxy. Which addresses are found
+// then depends on the proxy.
+func Client(client *http.Client) Option {
+	return func(p *provider) {
+		p.client = client
+	}
+}
+
+// Transport configures the http.RoundTripper used for requests. It is a
+// shorthand for Client with a client that only has its transport set.
+func Transport(transport http.RoundTripper) Option {
+	return Client(&http.Client{Transport: transport})
+}
+
+// Timeout configures the timeout for each request. Defaults to 10 seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(p *provider) {
+		p.timeout = timeout
+	}
+}
+
+// UserAgent configures the User-Agent header sent with each request.
+func UserAgent(userAgent string) Option {
+	return func(p *provider) {
+		p.userAgent = userAgent
+	}
+}
+
+// ResponseFormat configures the response format requested from the API.
+// Defaults to Text.
+func ResponseFormat(format Format) Option {
+	return func(p *provider) {
+		p.format = format
+	}
+}
+
 // New create a new *ip.Module using https://ipify.org to look up the current
 // public ip address.
-func New() *ip.Module {
-	return ip.New(Provider)
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new ip.ResultProvider which uses the ipify API and
+// configures it with the provided options.
+func NewProvider(options ...Option) ip.Provider {
+	p := &provider{
+		v4URL:   DefaultIPv4URL,
+		v6URL:   DefaultIPv6URL,
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+		format:  Text,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	p.clients = map[string]*http.Client{
+		"tcp4": newClient(p.client, "tcp4"),
+		"tcp6": newClient(p.client, "tcp6"),
+	}
+
+	return p
+}
+
+// Provider is an ip.ProviderFunc which retrieves the public ip via ipify
+// using the default options. It only returns the primary address and is kept
+// for compatibility. Use New or NewProvider to obtain the IPv4 and IPv6
+// address separately.
+var Provider = ip.ProviderFunc(NewProvider().GetIP)
+
+type provider struct {
+	v4URL     string
+	v6URL     string
+	client    *http.Client
+	timeout   time.Duration
+	userAgent string
+	format    Format
+
+	// clients contains HTTP clients which only dial connections of the
+	// network they are keyed by.
+	clients map[string]*http.Client
+}
+
+// GetIP implements ip.Provider.
+func (p *provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
 }
 
-// Provider is an ip.Provider which retrieves the public ip via
-// https://api.ipify.org.
-var Provider = ip.ProviderFunc(func() (net.IP, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://api.ipify.org", nil)
+// Lookup implements ip.ResultProvider. IPv4 and IPv6 addresses are looked up
+// in parallel with the address family of the connection forced to the
+// respective version, unless requests are sent via a proxy. An error is only
+// returned if both lookups failed. If neither lookup found an IP, the
+// result's Connectivity explains why, e.g. ip.CaptivePortal if the response
+// was not sent by ipify.
+func (p *provider) Lookup() (ip.Result, error) {
+	var wg sync.WaitGroup
+	var v4, v6 net.IP
+	var v4State, v6State ip.Connectivity
+	var v4Err, v6Err error
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		v4, v4State, v4Err = p.lookup(p.v4URL, "tcp4")
+	}()
+
+	go func() {
+		defer wg.Done()
+		v6, v6State, v6Err = p.lookup(p.v6URL, "tcp6")
+	}()
+
+	wg.Wait()
+
+	if v4Err != nil && v6Err != nil {
+		return ip.Result{}, v4Err
+	}
+
+	// Guard against services answering with an address of the wrong family.
+	if v4.To4() == nil {
+		v4 = nil
+	}
+
+	if v6.To4() != nil {
+		v6 = nil
+	}
+
+	if v4 == nil && v6 == nil {
+		// Prefer the more specific state in case only one of the address
+		// families is intercepted.
+		return ip.Result{Connectivity: v4State.MoreSpecific(v6State)}, nil
+	}
+
+	return ip.Result{IPv4: v4, IPv6: v6, Source: "ipify"}.Normalize(), nil
+}
+
+// newClient returns a copy of client which only dials connections of
+// network. Clients with transports other than *http.Transport are returned
+// unchanged.
+func newClient(client *http.Client, network string) *http.Client {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+
+	t = t.Clone()
+
+	dial := t.DialContext
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		dial = dialer.DialContext
+	}
+
+	t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dial(ctx, network, addr)
+	}
+
+	c := *client
+	c.Transport = t
+
+	return &c
+}
+
+// proxied returns true if req is sent via the proxy of the client's
+// transport.
+func (p *provider) proxied(req *http.Request) bool {
+	transport := p.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	t, ok := transport.(*http.Transport)
+	if !ok || t.Proxy == nil {
+		return false
+	}
+
+	proxyURL, err := t.Proxy(req)
+
+	return err != nil || proxyURL != nil
+}
+
+// lookup requests the IP from url. If no IP was found, the returned
+// connectivity state describes why.
+func (p *provider) lookup(rawURL, network string) (net.IP, ip.Connectivity, error) {
+	if rawURL == "" {
+		return nil, ip.Unknown, fmt.Errorf("no URL configured for %s", network)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ip.Unknown, err
+	}
+
+	if p.format != Text {
+		query := u.Query()
+		query.Set("format", string(p.format))
+		u.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, err
+		return nil, ip.Unknown, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
 	defer cancel()
 
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	client := p.clients[network]
+	if p.proxied(req) {
+		client = p.client
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		if netErr, ok := err.(net.Error); ok {
-			if netErr.Temporary() || netErr.Timeout() {
-				// Transient errors and timeouts indicate that we are offline.
-				return nil, nil
-			}
+		if state := ip.ErrorConnectivity(err); state != ip.Unknown {
+			return nil, state, nil
 		}
 
-		return nil, err
+		return nil, ip.Unknown, err
 	}
 	defer resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusProxyAuthRequired:
+		return nil, ip.ProxyRequired, nil
+	case http.StatusNetworkAuthenticationRequired:
+		return nil, ip.CaptivePortal, nil
+	default:
+		return nil, ip.Unknown, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
 	buf, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, ip.Unknown, err
 	}
 
-	return net.ParseIP(string(buf)), nil
-})
+	addr := p.parse(buf)
+	if addr == nil {
+		// Captive portals usually answer with their login page instead.
+		return nil, ip.CaptivePortal, nil
+	}
+
+	return addr, ip.Online, nil
+}
+
+// parse extracts the IP from a response body in the configured format.
+// Returns nil if the body does not contain a valid IP.
+func (p *provider) parse(body []byte) net.IP {
+	if p.format != JSON {
+		return net.ParseIP(strings.TrimSpace(string(body)))
+	}
+
+	var resp struct {
+		IP string `json:"ip"`
+	}
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+
+	return net.ParseIP(resp.IP)
+}
@@ -0,0 +1,245 @@
+package ipify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, network, addr, body string) *httptest.Server {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Skipf("%s not available: %v", network, err)
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	s.Listener.Close()
+	s.Listener = l
+	s.Start()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestProvider_DualStack(t *testing.T) {
+	v4 := newServer(t, "tcp4", "127.0.0.1:0", "203.0.113.1")
+	v6 := newServer(t, "tcp6", "[::1]:0", "2001:db8::1\n")
+
+	p := NewProvider(BaseURL(v4.URL, v6.URL)).(*provider)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), result.IPv4)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), result.IPv6)
+	assert.Equal(t, "ipify", result.Source)
+}
+
+func TestProvider_IPv4Only(t *testing.T) {
+	v4 := newServer(t, "tcp4", "127.0.0.1:0", "203.0.113.1")
+
+	// The IPv6 lookup must not succeed via IPv4.
+	p := NewProvider(BaseURL(v4.URL, v4.URL)).(*provider)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), result.IPv4)
+	assert.Nil(t, result.IPv6)
+
+	ip, err := p.GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), ip)
+}
+
+func TestProvider_Error(t *testing.T) {
+	p := NewProvider(BaseURL("gopher://127.0.0.1:1", "gopher://127.0.0.1:1")).(*provider)
+
+	_, err := p.Lookup()
+	require.Error(t, err)
+}
+
+func TestProvider_ConnectionRefused(t *testing.T) {
+	p := NewProvider(BaseURL("http://127.0.0.1:1", "http://127.0.0.1:1")).(*provider)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Offline, result.Connectivity)
+}
+
+func TestProvider_Connectivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected ip.Connectivity
+	}{
+		{
+			name: "captive portal login page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "<html>Please log in</html>")
+			},
+			expected: ip.CaptivePortal,
+		},
+		{
+			name: "network authentication required",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNetworkAuthenticationRequired)
+			},
+			expected: ip.CaptivePortal,
+		},
+		{
+			name: "proxy authentication required",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusProxyAuthRequired)
+			},
+			expected: ip.ProxyRequired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := httptest.NewServer(test.handler)
+			defer s.Close()
+
+			p := NewProvider(BaseURL(s.URL, "http://127.0.0.1:1")).(*provider)
+
+			result, err := p.Lookup()
+			require.NoError(t, err)
+			assert.Nil(t, result.IP)
+			assert.Equal(t, test.expected, result.Connectivity)
+		})
+	}
+}
+
+func TestProvider_UnexpectedStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	p := NewProvider(BaseURL(s.URL, "http://127.0.0.1:1")).(*provider)
+
+	_, err := p.Lookup()
+	require.EqualError(t, err, "unexpected status 503 Service Unavailable")
+}
+
+func TestProvider_Options(t *testing.T) {
+	var mu sync.Mutex
+	var userAgents []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		mu.Unlock()
+
+		if r.URL.Query().Get("format") == "json" {
+			fmt.Fprint(w, `{"ip":"203.0.113.1"}`)
+		} else {
+			fmt.Fprint(w, "203.0.113.2")
+		}
+	}))
+	defer s.Close()
+
+	p := NewProvider(BaseURL(s.URL, ""), UserAgent("barista"), ResponseFormat(JSON))
+
+	addr, err := p.GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), addr)
+
+	p = NewProvider(BaseURL(s.URL, ""), Transport(http.DefaultTransport))
+
+	addr, err = p.GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.2"), addr)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, userAgents, 2)
+	assert.Equal(t, "barista", userAgents[0])
+	assert.NotEqual(t, "barista", userAgents[1])
+}
+
+func TestProvider_Timeout(t *testing.T) {
+	done := make(chan struct{})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	p := NewProvider(BaseURL(s.URL, ""), Timeout(50*time.Millisecond)).(*provider)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Nil(t, result.IP)
+	assert.Equal(t, ip.Offline, result.Connectivity)
+}
+
+func TestProvider_CustomTransport(t *testing.T) {
+	var dialed []string
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, network)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+
+	v4 := newServer(t, "tcp4", "127.0.0.1:0", "203.0.113.1")
+
+	p := NewProvider(BaseURL(v4.URL, ""), Client(&http.Client{Transport: transport}))
+
+	addr, err := p.GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), addr)
+	assert.Equal(t, []string{"tcp4"}, dialed, "custom dialer is used with forced network")
+}
+
+func TestProvider_Proxy(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("tcp4 not available: %v", err)
+	}
+
+	// The proxy only listens on IPv4, so the IPv6 lookup must not force the
+	// connection to the proxy to IPv6.
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "v4.example":
+			fmt.Fprint(w, "203.0.113.1")
+		case "v6.example":
+			fmt.Fprint(w, "2001:db8::1")
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	proxy.Listener.Close()
+	proxy.Listener = l
+	proxy.Start()
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	p := NewProvider(
+		BaseURL("http://v4.example", "http://v6.example"),
+		Transport(&http.Transport{Proxy: http.ProxyURL(proxyURL)}),
+	).(*provider)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), result.IPv4)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), result.IPv6)
+}
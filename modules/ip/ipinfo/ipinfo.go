@@ -0,0 +1,215 @@
+// Package ipinfo provides an ip.Provider and ip.Enricher backed by the
+// https://ipinfo.io API or compatible services.
+package ipinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// DefaultBaseURL is the base URL of the ipinfo API.
+const DefaultBaseURL = "https://ipinfo.io"
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// BaseURL configures the base URL of the API. Defaults to DefaultBaseURL.
+func BaseURL(baseURL string) Option {
+	return func(p *Provider) {
+		p.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// Token configures the API access token. Requests without token are subject
+// to stricter rate limits.
+func Token(token string) Option {
+	return func(p *Provider) {
+		p.token = token
+	}
+}
+
+// Client configures the HTTP client used for requests. Defaults to
+// http.DefaultClient.
+func Client(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// Timeout configures the timeout for each request. Defaults to 10 seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// UserAgent configures the User-Agent header sent with each request.
+func UserAgent(userAgent string) Option {
+	return func(p *Provider) {
+		p.userAgent = userAgent
+	}
+}
+
+// New creates a new *ip.Module which uses the ipinfo API to look up the
+// public IP together with its location and network information.
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{
+		baseURL: DefaultBaseURL,
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is an ip.ResultProvider which also implements ip.Enricher, so it
+// can be used to enrich IPs obtained from other providers:
+//
+//	ipify.New().Enrich(ipinfo.NewProvider(ipinfo.Token("secret")))
+type Provider struct {
+	baseURL   string
+	token     string
+	client    *http.Client
+	timeout   time.Duration
+	userAgent string
+}
+
+type response struct {
+	IP      string `json:"ip"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+	Org     string `json:"org"`
+}
+
+// GetIP implements ip.Provider.
+func (p *Provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+// Lookup implements ip.ResultProvider. If the lookup failed because of the
+// network, the result's Connectivity explains why instead of returning an
+// error.
+func (p *Provider) Lookup() (ip.Result, error) {
+	resp, state, err := p.get("/json")
+	if err != nil {
+		if state != ip.Unknown {
+			return ip.Result{Connectivity: state}, nil
+		}
+
+		return ip.Result{}, err
+	}
+
+	addr := net.ParseIP(resp.IP)
+	if addr == nil {
+		return ip.Result{}, fmt.Errorf("invalid IP %q", resp.IP)
+	}
+
+	return ip.Result{IP: addr, Source: "ipinfo", Geo: resp.geo()}, nil
+}
+
+// Enrich implements ip.Enricher.
+func (p *Provider) Enrich(addr net.IP) (ip.Geo, error) {
+	resp, _, err := p.get("/" + addr.String() + "/json")
+	if err != nil {
+		return ip.Geo{}, err
+	}
+
+	return resp.geo(), nil
+}
+
+// get requests path from the API. If the request failed, the returned
+// connectivity state classifies the error.
+func (p *Provider) get(path string) (*response, ip.Connectivity, error) {
+	u, err := url.Parse(p.baseURL + path)
+	if err != nil {
+		return nil, ip.Unknown, err
+	}
+
+	if p.token != "" {
+		u.RawQuery = url.Values{"token": {p.token}}.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ip.Unknown, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, ip.ErrorConnectivity(err), err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusProxyAuthRequired:
+		return nil, ip.ProxyRequired, fmt.Errorf("ipinfo: unexpected status %s", resp.Status)
+	case http.StatusNetworkAuthenticationRequired:
+		return nil, ip.CaptivePortal, fmt.Errorf("ipinfo: unexpected status %s", resp.Status)
+	default:
+		return nil, ip.Unknown, fmt.Errorf("ipinfo: unexpected status %s", resp.Status)
+	}
+
+	var r response
+
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		// Captive portals usually answer with their login page instead.
+		return nil, ip.CaptivePortal, err
+	}
+
+	return &r, ip.Online, nil
+}
+
+// geo converts the response into ip.Geo. The org field has the format
+// "AS13335 Cloudflare, Inc.".
+func (r *response) geo() ip.Geo {
+	geo := ip.Geo{
+		CountryCode: r.Country,
+		City:        r.City,
+		Org:         r.Org,
+	}
+
+	if strings.HasPrefix(r.Org, "AS") {
+		parts := strings.SplitN(r.Org, " ", 2)
+
+		if asn, err := strconv.ParseUint(parts[0][2:], 10, 32); err == nil {
+			geo.ASN = uint32(asn)
+			geo.Org = ""
+			if len(parts) > 1 {
+				geo.Org = parts[1]
+			}
+		}
+	}
+
+	return geo
+}
@@ -0,0 +1,107 @@
+package ipinfo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/json":
+			fmt.Fprint(w, `{"ip":"203.0.113.1","city":"Berlin","country":"DE","org":"AS64496 Example Networks"}`)
+		case "/198.51.100.1/json":
+			fmt.Fprint(w, `{"ip":"198.51.100.1","city":"Amsterdam","country":"NL","org":"Some Org"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestProvider_Lookup(t *testing.T) {
+	s := newServer(t)
+
+	result, err := NewProvider(BaseURL(s.URL+"/"), Token("secret")).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Result{
+		IP:     net.ParseIP("203.0.113.1"),
+		Source: "ipinfo",
+		Geo: ip.Geo{
+			CountryCode: "DE",
+			City:        "Berlin",
+			ASN:         64496,
+			Org:         "Example Networks",
+		},
+	}, result)
+}
+
+func TestProvider_Enrich(t *testing.T) {
+	s := newServer(t)
+
+	geo, err := NewProvider(BaseURL(s.URL), Token("secret")).Enrich(net.ParseIP("198.51.100.1"))
+	require.NoError(t, err)
+	assert.Equal(t, ip.Geo{CountryCode: "NL", City: "Amsterdam", Org: "Some Org"}, geo)
+
+	_, err = NewProvider(BaseURL(s.URL)).Enrich(net.ParseIP("198.51.100.1"))
+	require.EqualError(t, err, "ipinfo: unexpected status 403 Forbidden")
+}
+
+func TestProvider_Connectivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected ip.Connectivity
+	}{
+		{name: "proxy", status: http.StatusProxyAuthRequired, expected: ip.ProxyRequired},
+		{name: "network auth", status: http.StatusNetworkAuthenticationRequired, expected: ip.CaptivePortal},
+		{name: "login page", status: http.StatusOK, body: "<html>Login</html>", expected: ip.CaptivePortal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}))
+			defer s.Close()
+
+			result, err := NewProvider(BaseURL(s.URL)).Lookup()
+			require.NoError(t, err)
+			assert.Equal(t, ip.Result{Connectivity: test.expected}, result)
+		})
+	}
+}
+
+func TestProvider_UserAgent(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "barista" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, `{"ip":"203.0.113.1"}`)
+	}))
+	defer s.Close()
+
+	addr, err := NewProvider(BaseURL(s.URL), UserAgent("barista"), Timeout(time.Second)).GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), addr)
+}
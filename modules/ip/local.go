@@ -0,0 +1,60 @@
+package ip
+
+import "net"
+
+// Interface is a local network interface.
+type Interface struct {
+	// Name is the interface name, e.g. "eth0".
+	Name string
+
+	// Addrs are the addresses assigned to the interface.
+	Addrs []*net.IPNet
+
+	// Up is true if the interface is up.
+	Up bool
+
+	// VPN is true if the interface is a VPN interface, e.g. a WireGuard or
+	// tun device.
+	VPN bool
+}
+
+// IPv4 returns the first IPv4 address of the interface or nil if it has none.
+func (i Interface) IPv4() net.IP {
+	for _, addr := range i.Addrs {
+		if v4 := addr.IP.To4(); v4 != nil {
+			return v4
+		}
+	}
+
+	return nil
+}
+
+// IPv6 returns the first global unicast IPv6 address of the interface or nil
+// if it has none.
+func (i Interface) IPv6() net.IP {
+	for _, addr := range i.Addrs {
+		if addr.IP.To4() == nil && addr.IP.IsGlobalUnicast() {
+			return addr.IP
+		}
+	}
+
+	return nil
+}
+
+// Route is a default route.
+type Route struct {
+	// Interface is the name of the interface carrying the route.
+	Interface string
+
+	// Gateway is the address of the default gateway. May be nil for
+	// point-to-point interfaces.
+	Gateway net.IP
+
+	// VPN is true if the route goes through a VPN interface.
+	VPN bool
+}
+
+// IsZero returns true if there is no default route.
+func (r Route) IsZero() bool {
+	return r.Interface == ""
+}
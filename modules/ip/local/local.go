@@ -0,0 +1,369 @@
+// Package local provides an ip.Provider which reports the local network
+// configuration, i.e. the addresses of all network interfaces and the default
+// route. It can be combined with a provider for the public IP.
+//
+// Routes are read from the main routing table via procfs. VPNs which route
+// all traffic through split routes covering the whole address space, like
+// 0.0.0.0/1 and 128.0.0.0/1 as used by OpenVPN's def1 option, are detected
+// if the interface matches the VPN patterns. Setups based on policy routing,
+// like wg-quick which puts the default route into a separate table that is
+// selected by a firewall mark, are not detected. In that case the default
+// route of the main table is reported.
+package local
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// DefaultProcPath is the default mount point of procfs.
+const DefaultProcPath = "/proc"
+
+// DefaultVPNPatterns are glob patterns for names of interfaces that are
+// flagged as VPN interfaces by default.
+var DefaultVPNPatterns = []string{"wg*", "tun*", "tap*", "ppp*"}
+
+// routeFlagUp is the RTF_UP route flag.
+const routeFlagUp = 0x1
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// ProcPath configures the mount point of procfs. Defaults to
+// DefaultProcPath.
+func ProcPath(path string) Option {
+	return func(p *Provider) {
+		p.procPath = path
+	}
+}
+
+// VPNPatterns configures glob patterns for interface names that should be
+// flagged as VPN interfaces. Defaults to DefaultVPNPatterns.
+func VPNPatterns(patterns ...string) Option {
+	return func(p *Provider) {
+		p.vpnPatterns = patterns
+	}
+}
+
+// Public configures a provider for the public IP. The local network
+// configuration is added to its results. Without a public provider, the
+// address of the interface carrying the default route is reported as IP.
+func Public(provider ip.Provider) Option {
+	return func(p *Provider) {
+		p.public = provider
+	}
+}
+
+// New creates a new *ip.Module which displays the local network
+// configuration.
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{
+		procPath:    DefaultProcPath,
+		vpnPatterns: DefaultVPNPatterns,
+		interfaces:  systemInterfaces,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is an ip.ResultProvider which reports local interfaces and the
+// default route read from /proc/net/route and /proc/net/ipv6_route.
+type Provider struct {
+	procPath    string
+	vpnPatterns []string
+	public      ip.Provider
+	interfaces  func() ([]ip.Interface, error)
+}
+
+// GetIP implements ip.Provider.
+func (p *Provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+// Lookup implements ip.ResultProvider.
+func (p *Provider) Lookup() (ip.Result, error) {
+	interfaces, err := p.interfaces()
+	if err != nil {
+		return ip.Result{}, err
+	}
+
+	for i := range interfaces {
+		interfaces[i].VPN = p.isVPN(interfaces[i].Name)
+	}
+
+	route, err := p.defaultRoute()
+	if err != nil {
+		return ip.Result{}, err
+	}
+
+	route.VPN = p.isVPN(route.Interface)
+
+	var result ip.Result
+
+	switch pub := p.public.(type) {
+	case nil:
+		result = localResult(interfaces, route)
+	case ip.ResultProvider:
+		result, err = pub.Lookup()
+	default:
+		result.IP, err = pub.GetIP()
+	}
+
+	if err != nil {
+		return ip.Result{}, err
+	}
+
+	result.Interfaces = interfaces
+	result.Route = route
+
+	return result, nil
+}
+
+// localResult reports the addresses of the interface carrying the default
+// route. The result is empty if there is no default route, which the module
+// treats as being offline.
+func localResult(interfaces []ip.Interface, route ip.Route) ip.Result {
+	for _, iface := range interfaces {
+		if iface.Name == route.Interface {
+			return ip.Result{IPv4: iface.IPv4(), IPv6: iface.IPv6(), Source: iface.Name}.Normalize()
+		}
+	}
+
+	return ip.Result{}
+}
+
+func (p *Provider) isVPN(name string) bool {
+	for _, pattern := range p.vpnPatterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// systemInterfaces returns all network interfaces of the system except
+// loopback interfaces.
+func systemInterfaces() ([]ip.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var interfaces []ip.Interface
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		i := ip.Interface{
+			Name: iface.Name,
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				i.Addrs = append(i.Addrs, ipNet)
+			}
+		}
+
+		interfaces = append(interfaces, i)
+	}
+
+	return interfaces, nil
+}
+
+type route struct {
+	ip.Route
+	metric uint64
+
+	// split is true for routes covering half of the address space via a VPN
+	// interface. They take precedence over default routes as they are more
+	// specific.
+	split bool
+}
+
+// defaultRoute returns the IPv4 default route with the lowest metric, falling
+// back to the IPv6 default route. Split routes via VPN interfaces are
+// preferred.
+func (p *Provider) defaultRoute() (ip.Route, error) {
+	routes, err := p.readRoutes()
+	if err != nil {
+		return ip.Route{}, err
+	}
+
+	if len(routes) == 0 {
+		routes, err = p.readIPv6Routes()
+		if err != nil {
+			return ip.Route{}, err
+		}
+	}
+
+	if len(routes) == 0 {
+		return ip.Route{}, nil
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].split != routes[j].split {
+			return routes[i].split
+		}
+
+		return routes[i].metric < routes[j].metric
+	})
+
+	return routes[0].Route, nil
+}
+
+// readRoutes reads the IPv4 default routes and split routes via VPN
+// interfaces from /proc/net/route.
+func (p *Provider) readRoutes() ([]route, error) {
+	var routes []route
+
+	err := readLines(filepath.Join(p.procPath, "net", "route"), func(fields []string) error {
+		if len(fields) < 8 || fields[0] == "Iface" {
+			return nil
+		}
+
+		// Only consider routes that are up with destination and mask 0.0.0.0,
+		// or 0.0.0.0/1 and 128.0.0.0/1 via VPN interfaces. Addresses are in
+		// host byte order.
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return err
+		}
+
+		if flags&routeFlagUp == 0 {
+			return nil
+		}
+
+		dest, mask := fields[1], fields[7]
+		split := mask == "00000080" && (dest == "00000000" || dest == "00000080") && p.isVPN(fields[0])
+
+		if !split && (dest != "00000000" || mask != "00000000") {
+			return nil
+		}
+
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			return fmt.Errorf("invalid gateway %q", fields[2])
+		}
+
+		metric, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			return err
+		}
+
+		r := route{Route: ip.Route{Interface: fields[0]}, metric: metric, split: split}
+
+		// The gateway is stored in host byte order, which is little endian on
+		// all relevant platforms.
+		if gateway := net.IPv4(gw[3], gw[2], gw[1], gw[0]); !gateway.Equal(net.IPv4zero) {
+			r.Gateway = gateway
+		}
+
+		routes = append(routes, r)
+		return nil
+	})
+
+	return routes, err
+}
+
+// readIPv6Routes reads the IPv6 default routes and split routes via VPN
+// interfaces from /proc/net/ipv6_route.
+func (p *Provider) readIPv6Routes() ([]route, error) {
+	var routes []route
+
+	err := readLines(filepath.Join(p.procPath, "net", "ipv6_route"), func(fields []string) error {
+		if len(fields) < 10 {
+			return nil
+		}
+
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil {
+			return err
+		}
+
+		if flags&routeFlagUp == 0 || fields[9] == "lo" {
+			return nil
+		}
+
+		// ::/1 and 8000::/1 are split routes.
+		dest, prefixLen := strings.TrimRight(fields[0], "0"), fields[1]
+		split := prefixLen == "01" && (dest == "" || dest == "8") && p.isVPN(fields[9])
+
+		if !split && (dest != "" || prefixLen != "00") {
+			return nil
+		}
+
+		gw, err := hex.DecodeString(fields[4])
+		if err != nil || len(gw) != net.IPv6len {
+			return fmt.Errorf("invalid gateway %q", fields[4])
+		}
+
+		metric, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil {
+			return err
+		}
+
+		r := route{Route: ip.Route{Interface: fields[9]}, metric: metric, split: split}
+
+		if gateway := net.IP(gw); !gateway.Equal(net.IPv6zero) {
+			r.Gateway = gateway
+		}
+
+		routes = append(routes, r)
+		return nil
+	})
+
+	return routes, err
+}
+
+// readLines calls fn with the whitespace separated fields of each line of the
+// file at path. A missing file is not an error as it just means that the
+// address family is not supported.
+func readLines(path string, fn func(fields []string) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if err := fn(strings.Fields(scanner.Text())); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,139 @@
+package local
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	addr, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	ipNet.IP = addr
+	return ipNet
+}
+
+func fakeInterfaces() ([]ip.Interface, error) {
+	return []ip.Interface{
+		{
+			Name: "eth0",
+			Up:   true,
+			Addrs: []*net.IPNet{
+				mustParseCIDR("fe80::1/64"),
+				mustParseCIDR("192.168.1.10/24"),
+				mustParseCIDR("2001:db8::10/64"),
+			},
+		},
+		{
+			Name:  "wg0",
+			Up:    true,
+			Addrs: []*net.IPNet{mustParseCIDR("10.8.0.2/32")},
+		},
+		{
+			Name: "wlan0",
+		},
+	}, nil
+}
+
+func newTestProvider(procPath string, options ...Option) *Provider {
+	p := NewProvider(append([]Option{ProcPath(procPath)}, options...)...)
+	p.interfaces = fakeInterfaces
+	return p
+}
+
+func TestProvider(t *testing.T) {
+	result, err := newTestProvider("testdata/dualstack").Lookup()
+	require.NoError(t, err)
+
+	assert.Equal(t, ip.Route{Interface: "wg0", VPN: true}, result.Route)
+	assert.Equal(t, net.ParseIP("10.8.0.2").To4(), result.IPv4)
+	assert.Nil(t, result.IPv6)
+	assert.Equal(t, "wg0", result.Source)
+
+	require.Len(t, result.Interfaces, 3)
+	assert.False(t, result.Interfaces[0].VPN)
+	assert.True(t, result.Interfaces[1].VPN)
+	assert.False(t, result.Interfaces[2].VPN)
+}
+
+func TestProvider_VPNPatterns(t *testing.T) {
+	result, err := newTestProvider("testdata/dualstack", VPNPatterns("tun*")).Lookup()
+	require.NoError(t, err)
+
+	assert.Equal(t, ip.Route{Interface: "wg0"}, result.Route)
+	assert.False(t, result.Interfaces[1].VPN)
+}
+
+func TestProvider_IPv6Only(t *testing.T) {
+	result, err := newTestProvider("testdata/ipv6only").Lookup()
+	require.NoError(t, err)
+
+	assert.Equal(t, ip.Route{Interface: "eth0", Gateway: net.ParseIP("fe80::1")}, result.Route)
+	assert.Equal(t, net.ParseIP("192.168.1.10").To4(), result.IPv4)
+	assert.Equal(t, net.ParseIP("2001:db8::10"), result.IPv6)
+}
+
+func TestProvider_SplitRoutes(t *testing.T) {
+	p := newTestProvider("testdata/split")
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Route{Interface: "tun0", Gateway: net.IPv4(10, 8, 0, 1), VPN: true}, result.Route)
+
+	routes, err := p.readRoutes()
+	require.NoError(t, err)
+	require.Len(t, routes, 3, "split routes via non-VPN interfaces are ignored")
+
+	routes, err = p.readIPv6Routes()
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+	assert.True(t, routes[1].split)
+	assert.True(t, routes[2].split)
+}
+
+func TestProvider_NoDefaultRoute(t *testing.T) {
+	result, err := newTestProvider("testdata/offline").Lookup()
+	require.NoError(t, err)
+
+	assert.True(t, result.Route.IsZero())
+	assert.Nil(t, result.IP)
+	assert.Nil(t, result.IPv4)
+	assert.Len(t, result.Interfaces, 3)
+}
+
+func TestProvider_Public(t *testing.T) {
+	public := ip.ProviderFunc(func() (net.IP, error) {
+		return net.ParseIP("203.0.113.1"), nil
+	})
+
+	result, err := newTestProvider("testdata/dualstack", Public(public)).Lookup()
+	require.NoError(t, err)
+
+	assert.Equal(t, net.ParseIP("203.0.113.1"), result.IP)
+	assert.Equal(t, "wg0", result.Route.Interface)
+	assert.Len(t, result.Interfaces, 3)
+
+	public = ip.ProviderFunc(func() (net.IP, error) {
+		return nil, errors.New("whoops")
+	})
+
+	_, err = newTestProvider("testdata/dualstack", Public(public)).Lookup()
+	require.EqualError(t, err, "whoops")
+}
+
+func TestProvider_Gateway(t *testing.T) {
+	p := newTestProvider("testdata/dualstack")
+
+	routes, err := p.readRoutes()
+	require.NoError(t, err)
+	require.Len(t, routes, 2, "routes that are not up are ignored")
+	assert.Equal(t, net.IPv4(192, 168, 1, 1), routes[0].Gateway)
+	assert.Equal(t, uint64(600), routes[0].metric)
+}
@@ -0,0 +1,132 @@
+package ip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"barista.run/base/notifier"
+	"barista.run/timing"
+	"github.com/martinohmann/barista-contrib/internal/exec"
+)
+
+// MaskMode configures how the public IP is masked in the bar, e.g. while
+// sharing the screen.
+type MaskMode int
+
+// Supported mask modes.
+const (
+	// Unmasked shows the full IP.
+	Unmasked MaskMode = iota
+
+	// MaskPartial only shows the leading part of the IP, e.g. "203.0.x.x".
+	MaskPartial
+
+	// MaskHidden hides the IP completely.
+	MaskHidden
+)
+
+// MaskIP formats ip according to mode. IPv4 addresses are reduced to their
+// first two octets and IPv6 addresses to their first two groups in
+// MaskPartial mode. MaskHidden always returns "hidden".
+func MaskIP(ip net.IP, mode MaskMode) string {
+	switch {
+	case ip == nil || mode == Unmasked:
+		return ip.String()
+	case mode == MaskHidden:
+		return "hidden"
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.x.x", v4[0], v4[1])
+	}
+
+	return fmt.Sprintf("%x:%x:x:x:x:x:x:x", binary.BigEndian.Uint16(ip), binary.BigEndian.Uint16(ip[2:]))
+}
+
+// CopyToClipboard copies text to the clipboard using wl-copy on Wayland and
+// xclip otherwise.
+func CopyToClipboard(text string) error {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return exec.CommandRunInput([]byte(text), "wl-copy")
+	}
+
+	return exec.CommandRunInput([]byte(text), "xclip", "-selection", "clipboard")
+}
+
+// masking keeps track of whether the IP is currently revealed.
+type masking struct {
+	sync.Mutex
+	mode        MaskMode
+	timeout     time.Duration
+	copyOnClick bool
+	revealed    bool
+	remask      *timing.Scheduler
+	notifyFn    func()
+	notifyCh    <-chan struct{}
+}
+
+func newMasking() *masking {
+	m := &masking{
+		timeout: 10 * time.Second,
+		remask:  timing.NewScheduler(),
+	}
+
+	m.notifyFn, m.notifyCh = notifier.New()
+
+	return m
+}
+
+// Mode returns the mask mode that is currently in effect.
+func (m *masking) Mode() MaskMode {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.revealed {
+		return Unmasked
+	}
+
+	return m.mode
+}
+
+// Toggle reveals the masked IP or masks it again. The IP is masked again
+// automatically once the timeout elapsed. Returns false if masking is
+// disabled.
+func (m *masking) Toggle() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.mode == Unmasked {
+		return false
+	}
+
+	m.revealed = !m.revealed
+
+	if m.revealed && m.timeout > 0 {
+		m.remask.After(m.timeout)
+	} else {
+		m.remask.Stop()
+	}
+
+	m.notifyFn()
+
+	return true
+}
+
+// Remask masks the IP again after it was revealed.
+func (m *masking) Remask() {
+	m.Lock()
+	defer m.Unlock()
+	m.revealed = false
+}
+
+// CopyOnClick returns true if the IP should be copied to the clipboard on
+// click.
+func (m *masking) CopyOnClick() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.copyOnClick
+}
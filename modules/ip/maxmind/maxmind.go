@@ -0,0 +1,77 @@
+// Package maxmind provides an ip.Enricher which looks up IP information in
+// local MaxMind DB files, e.g. the free GeoLite2 City and ASN databases.
+package maxmind
+
+import (
+	"net"
+
+	"github.com/martinohmann/barista-contrib/internal/mmdb"
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// Enricher is an ip.Enricher which looks up IPs in one or more MaxMind DB
+// files. Results of all databases are merged, so that a city and an ASN
+// database can be combined:
+//
+//	enricher, err := maxmind.Open(
+//		"/usr/share/GeoIP/GeoLite2-City.mmdb",
+//		"/usr/share/GeoIP/GeoLite2-ASN.mmdb",
+//	)
+//	if err != nil {
+//		panic(err)
+//	}
+//
+//	ipify.New().Enrich(enricher)
+type Enricher struct {
+	readers []*mmdb.Reader
+}
+
+// Open opens the MaxMind DB files at paths. The files are read into memory.
+func Open(paths ...string) (*Enricher, error) {
+	e := &Enricher{}
+
+	for _, path := range paths {
+		r, err := mmdb.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		e.readers = append(e.readers, r)
+	}
+
+	return e, nil
+}
+
+// Enrich implements ip.Enricher.
+func (e *Enricher) Enrich(addr net.IP) (ip.Geo, error) {
+	var geo ip.Geo
+
+	for _, r := range e.readers {
+		record, err := r.Lookup(addr)
+		if err != nil {
+			return ip.Geo{}, err
+		}
+
+		if record == nil {
+			continue
+		}
+
+		setString(&geo.Country, record, "country", "names", "en")
+		setString(&geo.CountryCode, record, "country", "iso_code")
+		setString(&geo.City, record, "city", "names", "en")
+		setString(&geo.Org, record, "autonomous_system_organization")
+
+		if asn, ok := mmdb.Path(record, "autonomous_system_number").(uint64); ok {
+			geo.ASN = uint32(asn)
+		}
+	}
+
+	return geo, nil
+}
+
+// setString sets dst to the string at path in record, if present.
+func setString(dst *string, record interface{}, path ...string) {
+	if s, ok := mmdb.Path(record, path...).(string); ok && s != "" {
+		*dst = s
+	}
+}
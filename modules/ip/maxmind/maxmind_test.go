@@ -0,0 +1,51 @@
+package maxmind
+
+import (
+	"net"
+	"testing"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnricher(t *testing.T) {
+	e, err := Open("testdata/city.mmdb", "testdata/asn.mmdb")
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip       string
+		expected ip.Geo
+	}{
+		{
+			ip: "203.0.113.42",
+			expected: ip.Geo{
+				Country:     "Germany",
+				CountryCode: "DE",
+				City:        "Berlin",
+				ASN:         64496,
+				Org:         "Example Networks",
+			},
+		},
+		{
+			ip:       "2001:db8::1",
+			expected: ip.Geo{Country: "Netherlands", CountryCode: "NL"},
+		},
+		{
+			ip: "198.51.100.1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			geo, err := e.Enrich(net.ParseIP(test.ip))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, geo)
+		})
+	}
+}
+
+func TestOpen_Error(t *testing.T) {
+	_, err := Open("testdata/city.mmdb", "testdata/nonexistent.mmdb")
+	require.Error(t, err)
+}
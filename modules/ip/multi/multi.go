@@ -0,0 +1,402 @@
+// Package multi provides an ip.Provider which queries multiple public IP
+// lookup services, so that an outage of a single service is not mistaken for
+// being offline.
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// ParseFunc extracts the IP from the response body of an endpoint.
+type ParseFunc func(body []byte) (net.IP, error)
+
+// PlainText parses a response body which only contains the IP, optionally
+// surrounded by whitespace.
+func PlainText(body []byte) (net.IP, error) {
+	return parseIP(strings.TrimSpace(string(body)))
+}
+
+// JSONField returns a ParseFunc which extracts the IP from a JSON object
+// field. Nested fields can be addressed using dots, e.g. "data.ip".
+func JSONField(field string) ParseFunc {
+	path := strings.Split(field, ".")
+
+	return func(body []byte) (net.IP, error) {
+		var value interface{}
+
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, err
+		}
+
+		for _, key := range path {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("field %q not found", field)
+			}
+
+			if value, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("field %q not found", field)
+			}
+		}
+
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %q is not a string", field)
+		}
+
+		return parseIP(str)
+	}
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", s)
+	}
+
+	return ip, nil
+}
+
+// Endpoint is a public IP lookup service.
+type Endpoint struct {
+	// Name is reported as source of the IP if the endpoint answered.
+	Name string
+
+	// URL is requested via HTTP GET.
+	URL string
+
+	// Parse extracts the IP from the response body. Defaults to PlainText.
+	Parse ParseFunc
+}
+
+// Predefined endpoints.
+var (
+	Ipify     = Endpoint{Name: "ipify", URL: "https://api.ipify.org"}
+	Icanhazip = Endpoint{Name: "icanhazip", URL: "https://icanhazip.com"}
+	Ifconfig  = Endpoint{Name: "ifconfig.me", URL: "https://ifconfig.me/ip"}
+	Ipinfo    = Endpoint{Name: "ipinfo", URL: "https://ipinfo.io/json", Parse: JSONField("ip")}
+)
+
+// DefaultEndpoints are used if no endpoints are configured.
+var DefaultEndpoints = []Endpoint{Ipify, Icanhazip, Ifconfig, Ipinfo}
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// Endpoints configures the endpoints to query. Defaults to
+// DefaultEndpoints.
+func Endpoints(endpoints ...Endpoint) Option {
+	return func(p *Provider) {
+		p.endpoints = endpoints
+	}
+}
+
+// Parallel configures the provider to query all endpoints in parallel and
+// only accept an IP if the majority of the endpoints that answered agree on
+// it. Votes are counted separately for IPv4 and IPv6 addresses, since
+// endpoints answer with either depending on how they are reached. By
+// default, endpoints are queried in order until one of them answers.
+func Parallel() Option {
+	return func(p *Provider) {
+		p.parallel = true
+	}
+}
+
+// Timeout configures the timeout for each endpoint request. Defaults to 10
+// seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// Client configures the HTTP client used for requests. Defaults to
+// http.DefaultClient.
+func Client(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// UserAgent configures the User-Agent header sent with each request.
+func UserAgent(userAgent string) Option {
+	return func(p *Provider) {
+		p.userAgent = userAgent
+	}
+}
+
+// New creates a new *ip.Module which queries multiple endpoints to look up
+// the current public ip address.
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{
+		endpoints: DefaultEndpoints,
+		timeout:   10 * time.Second,
+		client:    http.DefaultClient,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is an ip.ResultProvider which queries multiple endpoints.
+type Provider struct {
+	endpoints []Endpoint
+	parallel  bool
+	timeout   time.Duration
+	client    *http.Client
+	userAgent string
+}
+
+// GetIP implements ip.Provider.
+func (p *Provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+// Lookup implements ip.ResultProvider. If no endpoint answered, the result's
+// Connectivity explains why, e.g. ip.Offline or ip.CaptivePortal. An error is
+// returned if all endpoints failed for other reasons or, in parallel mode, if
+// there is no majority.
+func (p *Provider) Lookup() (ip.Result, error) {
+	if p.parallel {
+		return p.lookupParallel()
+	}
+
+	return p.lookupSequential()
+}
+
+func (p *Provider) lookupSequential() (ip.Result, error) {
+	var errs errorList
+	var state ip.Connectivity
+
+	for _, endpoint := range p.endpoints {
+		addr, s, err := p.query(endpoint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if addr != nil {
+			return ip.Result{IP: addr, Source: endpoint.Name}.Normalize(), nil
+		}
+
+		state = state.MoreSpecific(s)
+	}
+
+	return failed(state, errs)
+}
+
+// failed returns the result if no endpoint answered. The connectivity state
+// takes precedence over the errors of other endpoints.
+func failed(state ip.Connectivity, errs errorList) (ip.Result, error) {
+	if state != ip.Unknown {
+		return ip.Result{Connectivity: state}, nil
+	}
+
+	return ip.Result{}, errs.err()
+}
+
+type response struct {
+	endpoint Endpoint
+	ip       net.IP
+	state    ip.Connectivity
+	err      error
+}
+
+func (p *Provider) lookupParallel() (ip.Result, error) {
+	responses := make([]response, len(p.endpoints))
+
+	var wg sync.WaitGroup
+
+	for i, endpoint := range p.endpoints {
+		wg.Add(1)
+
+		go func(i int, endpoint Endpoint) {
+			defer wg.Done()
+			addr, state, err := p.query(endpoint)
+			responses[i] = response{endpoint: endpoint, ip: addr, state: state, err: err}
+		}(i, endpoint)
+	}
+
+	wg.Wait()
+
+	var errs errorList
+	var state ip.Connectivity
+	var answered [2]int
+	var votes [2]map[string][]string
+
+	// Endpoints may answer with an address of either family, e.g. on
+	// dual-stack hosts, so votes are counted per family.
+	for _, resp := range responses {
+		switch {
+		case resp.err != nil:
+			errs = append(errs, resp.err)
+		case resp.ip == nil:
+			state = state.MoreSpecific(resp.state)
+		default:
+			family := familyOf(resp.ip)
+			if votes[family] == nil {
+				votes[family] = make(map[string][]string)
+			}
+
+			answered[family]++
+			key := resp.ip.String()
+			votes[family][key] = append(votes[family][key], resp.endpoint.Name)
+		}
+	}
+
+	if answered[0]+answered[1] == 0 {
+		return failed(state, errs)
+	}
+
+	var addrs [2]net.IP
+	var sources []string
+
+	for family := range votes {
+		for addr, names := range votes[family] {
+			if len(names)*2 > answered[family] {
+				addrs[family] = net.ParseIP(addr)
+				sources = append(sources, names...)
+			}
+		}
+	}
+
+	if addrs[0] == nil && addrs[1] == nil {
+		return ip.Result{}, fmt.Errorf("no majority among %d endpoints: %v", answered[0]+answered[1], votes)
+	}
+
+	result := ip.Result{
+		IPv4:   addrs[0],
+		IPv6:   addrs[1],
+		Source: strings.Join(sources, ", "),
+	}
+
+	return result.Normalize(), nil
+}
+
+// familyOf returns 0 for IPv4 and 1 for IPv6 addresses.
+func familyOf(addr net.IP) int {
+	if addr.To4() != nil {
+		return 0
+	}
+
+	return 1
+}
+
+// query requests the IP from endpoint. If no IP was found, the returned
+// connectivity state describes why.
+func (p *Provider) query(endpoint Endpoint) (net.IP, ip.Connectivity, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint.URL, nil)
+	if err != nil {
+		return nil, ip.Unknown, err
+	}
+
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if state := ip.ErrorConnectivity(err); state != ip.Unknown {
+			return nil, state, nil
+		}
+
+		return nil, ip.Unknown, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusProxyAuthRequired:
+		return nil, ip.ProxyRequired, nil
+	case http.StatusNetworkAuthenticationRequired:
+		return nil, ip.CaptivePortal, nil
+	default:
+		return nil, ip.Unknown, fmt.Errorf("%s: unexpected status %s", endpoint.Name, resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ip.Unknown, err
+	}
+
+	parse := endpoint.Parse
+	if parse == nil {
+		parse = PlainText
+	}
+
+	addr, err := parse(buf)
+	if err != nil {
+		return nil, ip.Unknown, fmt.Errorf("%s: %w", endpoint.Name, err)
+	}
+
+	return addr, ip.Online, nil
+}
+
+// errorList collects the errors of all endpoints that failed. The errors stay
+// accessible via errors.Is and errors.As.
+type errorList []error
+
+func (l errorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// Error implements error.
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("all endpoints failed: %s", strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the errors matches target.
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error that matches target.
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,253 @@
+package multi
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, status int, body string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newSlowServer(t *testing.T) *httptest.Server {
+	done := make(chan struct{})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+
+	t.Cleanup(func() {
+		close(done)
+		s.Close()
+	})
+
+	return s
+}
+
+func TestProvider_Sequential(t *testing.T) {
+	down := newServer(t, http.StatusServiceUnavailable, "")
+	plain := newServer(t, http.StatusOK, "1.2.3.4\n")
+	json := newServer(t, http.StatusOK, `{"data":{"ip":"5.6.7.8"}}`)
+
+	tests := []struct {
+		name           string
+		endpoints      []Endpoint
+		expectedIP     net.IP
+		expectedSource string
+		expectedErrMsg string
+	}{
+		{
+			name: "first endpoint answers",
+			endpoints: []Endpoint{
+				{Name: "plain", URL: plain.URL},
+				{Name: "json", URL: json.URL, Parse: JSONField("data.ip")},
+			},
+			expectedIP:     net.ParseIP("1.2.3.4"),
+			expectedSource: "plain",
+		},
+		{
+			name: "fallback",
+			endpoints: []Endpoint{
+				{Name: "down", URL: down.URL},
+				{Name: "json", URL: json.URL, Parse: JSONField("data.ip")},
+			},
+			expectedIP:     net.ParseIP("5.6.7.8"),
+			expectedSource: "json",
+		},
+		{
+			name: "parse error",
+			endpoints: []Endpoint{
+				{Name: "json", URL: json.URL, Parse: JSONField("ip")},
+				{Name: "down", URL: down.URL},
+			},
+			expectedErrMsg: `all endpoints failed: json: field "ip" not found; down: unexpected status 503 Service Unavailable`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewProvider(Endpoints(test.endpoints...)).Lookup()
+			if test.expectedErrMsg != "" {
+				require.EqualError(t, err, test.expectedErrMsg)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedIP, result.IP)
+			assert.Equal(t, test.expectedSource, result.Source)
+		})
+	}
+}
+
+func TestProvider_Offline(t *testing.T) {
+	slow := newSlowServer(t)
+
+	p := NewProvider(
+		Endpoints(Endpoint{Name: "slow", URL: slow.URL}),
+		Timeout(50*time.Millisecond),
+	)
+
+	result, err := p.Lookup()
+	require.NoError(t, err)
+	assert.Nil(t, result.IP)
+	assert.Equal(t, ip.Offline, result.Connectivity)
+}
+
+func TestProvider_Connectivity(t *testing.T) {
+	down := newServer(t, http.StatusServiceUnavailable, "")
+	proxy := newServer(t, http.StatusProxyAuthRequired, "")
+	portal := newServer(t, http.StatusNetworkAuthenticationRequired, "")
+	slow := newSlowServer(t)
+
+	endpoints := []Endpoint{
+		{Name: "down", URL: down.URL},
+		{Name: "slow", URL: slow.URL},
+		{Name: "portal", URL: portal.URL},
+	}
+
+	for _, parallel := range []bool{false, true} {
+		options := []Option{Endpoints(endpoints...), Timeout(50 * time.Millisecond)}
+		if parallel {
+			options = append(options, Parallel())
+		}
+
+		result, err := NewProvider(options...).Lookup()
+		require.NoError(t, err)
+		assert.Nil(t, result.IP)
+		assert.Equal(t, ip.CaptivePortal, result.Connectivity, "parallel: %v", parallel)
+	}
+
+	result, err := NewProvider(Endpoints(Endpoint{Name: "proxy", URL: proxy.URL})).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.ProxyRequired, result.Connectivity)
+}
+
+func TestProvider_Parallel(t *testing.T) {
+	a := newServer(t, http.StatusOK, "1.2.3.4")
+	b := newServer(t, http.StatusOK, `{"ip":"1.2.3.4"}`)
+	c := newServer(t, http.StatusOK, "5.6.7.8")
+	v6 := newServer(t, http.StatusOK, "2001:db8::1")
+	down := newServer(t, http.StatusInternalServerError, "")
+
+	tests := []struct {
+		name           string
+		endpoints      []Endpoint
+		expectedIP     net.IP
+		expectedIPv6   net.IP
+		expectedSource string
+		expectedErrMsg string
+	}{
+		{
+			name: "majority",
+			endpoints: []Endpoint{
+				{Name: "a", URL: a.URL},
+				{Name: "c", URL: c.URL},
+				{Name: "b", URL: b.URL, Parse: JSONField("ip")},
+				{Name: "down", URL: down.URL},
+			},
+			expectedIP:     net.ParseIP("1.2.3.4"),
+			expectedSource: "a, b",
+		},
+		{
+			name: "no majority",
+			endpoints: []Endpoint{
+				{Name: "a", URL: a.URL},
+				{Name: "c", URL: c.URL},
+			},
+			expectedErrMsg: "no majority among 2 endpoints",
+		},
+		{
+			name: "dual-stack",
+			endpoints: []Endpoint{
+				{Name: "a", URL: a.URL},
+				{Name: "v6", URL: v6.URL},
+				{Name: "b", URL: b.URL, Parse: JSONField("ip")},
+				{Name: "v6-2", URL: v6.URL},
+			},
+			expectedIP:     net.ParseIP("1.2.3.4"),
+			expectedIPv6:   net.ParseIP("2001:db8::1"),
+			expectedSource: "a, b, v6, v6-2",
+		},
+		{
+			name: "all failed",
+			endpoints: []Endpoint{
+				{Name: "down", URL: down.URL},
+			},
+			expectedErrMsg: "all endpoints failed: down: unexpected status 500 Internal Server Error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewProvider(Endpoints(test.endpoints...), Parallel()).Lookup()
+			if test.expectedErrMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErrMsg)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedIP, result.IP)
+			assert.Equal(t, test.expectedIPv6, result.IPv6)
+			assert.Equal(t, test.expectedSource, result.Source)
+		})
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}
+	err := errorList{errors.New("whoops"), fmt.Errorf("lookup: %w", dnsErr)}.err()
+
+	require.EqualError(t, err, "all endpoints failed: whoops; lookup: lookup example.com: no such host")
+	assert.True(t, errors.Is(err, dnsErr))
+
+	var target *net.DNSError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, dnsErr, target)
+
+	assert.NoError(t, errorList(nil).err())
+}
+
+func TestPlainText(t *testing.T) {
+	ip, err := PlainText([]byte(" 2001:db8::1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), ip)
+
+	_, err = PlainText([]byte("<html>"))
+	require.EqualError(t, err, `invalid IP "<html>"`)
+}
+
+func TestProvider_UserAgent(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "barista" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, "203.0.113.1")
+	}))
+	defer s.Close()
+
+	addr, err := NewProvider(Endpoints(Endpoint{Name: "test", URL: s.URL}), UserAgent("barista")).GetIP()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("203.0.113.1"), addr)
+}
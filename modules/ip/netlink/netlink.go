@@ -0,0 +1,21 @@
+// Package netlink provides an ip.Watcher which subscribes to rtnetlink
+// notifications about address, route and link changes. It is only supported
+// on Linux:
+//
+//	ipify.New().
+//		RefreshOnChange(netlink.NewWatcher(), 2*time.Second).
+//		Every(time.Hour)
+package netlink
+
+import "errors"
+
+// ErrUnsupported is returned by Watch on platforms other than Linux.
+var ErrUnsupported = errors.New("netlink is only supported on linux")
+
+// Watcher is an ip.Watcher backed by rtnetlink.
+type Watcher struct{}
+
+// NewWatcher creates a new *Watcher.
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
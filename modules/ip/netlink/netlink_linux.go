@@ -0,0 +1,117 @@
+package netlink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+
+	l "barista.run/logging"
+)
+
+// rtnetlink multicast groups from linux/rtnetlink.h, which are not defined
+// by the syscall package.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// groups are the rtnetlink multicast groups the watcher subscribes to.
+const groups = rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv4Route | rtmgrpIPv6IfAddr | rtmgrpIPv6Route
+
+// Watch implements ip.Watcher. The returned channel is closed once ctx is
+// done or if reading from the netlink socket fails.
+func (w *Watcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: groups,
+	}
+
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// The socket is non-blocking, so reads go through the runtime poller and
+	// closing the file interrupts a pending read.
+	f := os.NewFile(uintptr(fd), "netlink")
+
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		f.Close()
+	}()
+
+	go func() {
+		defer close(ch)
+		defer close(done)
+
+		buf := make([]byte, syscall.Getpagesize()*4)
+
+		for {
+			n, err := f.Read(buf)
+			switch {
+			case err == nil:
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, syscall.ENOBUFS):
+				// The socket buffer overflowed and notifications were lost,
+				// so something must have changed.
+				notify(ch)
+				continue
+			default:
+				l.Log("Error reading from netlink socket: %v", err)
+				return
+			}
+
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				l.Log("Error parsing netlink messages: %v", err)
+				continue
+			}
+
+			if changed(msgs) {
+				notify(ch)
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// changed returns true if msgs contain notifications about address, route or
+// link changes.
+func changed(msgs []syscall.NetlinkMessage) bool {
+	for _, msg := range msgs {
+		switch msg.Header.Type {
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR,
+			syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE,
+			syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			return true
+		}
+	}
+
+	return false
+}
+
+// notify sends to ch without blocking. Pending notifications are coalesced.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
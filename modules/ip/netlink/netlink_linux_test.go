@@ -0,0 +1,60 @@
+package netlink
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func message(typ uint16) syscall.NetlinkMessage {
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: typ}}
+}
+
+func TestChanged(t *testing.T) {
+	assert.False(t, changed(nil))
+	assert.False(t, changed([]syscall.NetlinkMessage{message(syscall.NLMSG_DONE)}))
+	assert.True(t, changed([]syscall.NetlinkMessage{message(syscall.NLMSG_NOOP), message(syscall.RTM_NEWADDR)}))
+	assert.True(t, changed([]syscall.NetlinkMessage{message(syscall.RTM_DELROUTE)}))
+	assert.True(t, changed([]syscall.NetlinkMessage{message(syscall.RTM_NEWLINK)}))
+}
+
+func TestWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := NewWatcher().Watch(ctx)
+	if err == syscall.EPERM || err == syscall.EACCES || err == syscall.EAFNOSUPPORT {
+		t.Skipf("netlink not available: %v", err)
+	}
+
+	require.NoError(t, err)
+	require.NotNil(t, ch)
+
+	cancel()
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel was not closed after cancel")
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ch := make(chan struct{}, 1)
+
+	notify(ch)
+	notify(ch)
+
+	assert.Len(t, ch, 1, "notifications are coalesced")
+}
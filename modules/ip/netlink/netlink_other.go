@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package netlink
+
+import "context"
+
+// Watch implements ip.Watcher. It always returns ErrUnsupported.
+func (w *Watcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,249 @@
+// Package stun provides an ip.Provider which looks up the public IP using a
+// STUN binding request as specified in RFC 5389. STUN uses UDP, so it also
+// works on networks where HTTP based lookups are blocked.
+package stun
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+)
+
+// DefaultServers are the STUN servers queried by default.
+var DefaultServers = []string{
+	"stun.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+const (
+	magicCookie = 0x2112a442
+
+	bindingRequest  = 0x0001
+	bindingResponse = 0x0101
+
+	attrMappedAddress    = 0x0001
+	attrXORMappedAddress = 0x0020
+
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+
+	headerSize = 20
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// Servers configures the STUN servers to query in order until one of them
+// answers. Defaults to DefaultServers.
+func Servers(servers ...string) Option {
+	return func(p *Provider) {
+		p.servers = servers
+	}
+}
+
+// Timeout configures the timeout for each binding request. Defaults to 3
+// seconds.
+func Timeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.timeout = timeout
+	}
+}
+
+// New creates a new *ip.Module which uses STUN to look up the public IP.
+func New(options ...Option) *ip.Module {
+	return ip.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{
+		servers: DefaultServers,
+		timeout: 3 * time.Second,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is an ip.ResultProvider which looks up the public IP via STUN.
+type Provider struct {
+	servers []string
+	timeout time.Duration
+}
+
+// GetIP implements ip.Provider.
+func (p *Provider) GetIP() (net.IP, error) {
+	result, err := p.Lookup()
+	return result.IP, err
+}
+
+// Lookup implements ip.ResultProvider. Servers are queried in order until one
+// of them answers. If all servers failed because of the network, e.g. because
+// they timed out, the result's Connectivity explains why instead of returning
+// an error.
+func (p *Provider) Lookup() (ip.Result, error) {
+	var errs []string
+	var state ip.Connectivity
+
+	for _, server := range p.servers {
+		addr, err := p.query(server)
+		if err == nil {
+			return ip.Result{IP: addr, Source: server}.Normalize(), nil
+		}
+
+		if s := ip.ErrorConnectivity(err); s != ip.Unknown {
+			state = state.MoreSpecific(s)
+			continue
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", server, err))
+	}
+
+	if state == ip.Unknown && len(errs) > 0 {
+		return ip.Result{}, fmt.Errorf("all STUN servers failed: %s", strings.Join(errs, "; "))
+	}
+
+	return ip.Result{Connectivity: state}, nil
+}
+
+func (p *Provider) query(server string) (net.IP, error) {
+	conn, err := net.DialTimeout("udp", server, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		return nil, err
+	}
+
+	req := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(req, bindingRequest)
+	binary.BigEndian.PutUint32(req[4:], magicCookie)
+
+	if _, err := rand.Read(req[8:headerSize]); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1500)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		// Ignore responses to other requests.
+		if n < headerSize || !bytes.Equal(buf[8:headerSize], req[8:headerSize]) {
+			continue
+		}
+
+		return parseResponse(buf[:n])
+	}
+}
+
+// parseResponse extracts the mapped address from a binding response. The
+// XOR-MAPPED-ADDRESS attribute is preferred over MAPPED-ADDRESS which is only
+// sent by servers implementing the obsolete RFC 3489.
+func parseResponse(msg []byte) (net.IP, error) {
+	if typ := binary.BigEndian.Uint16(msg); typ != bindingResponse {
+		return nil, fmt.Errorf("unexpected message type %#04x", typ)
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:]))
+	if headerSize+length > len(msg) {
+		return nil, errors.New("truncated message")
+	}
+
+	var mapped net.IP
+
+	attrs := msg[headerSize : headerSize+length]
+
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs)
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+
+		if 4+n > len(attrs) {
+			return nil, errors.New("truncated attribute")
+		}
+
+		value := attrs[4 : 4+n]
+
+		switch typ {
+		case attrXORMappedAddress:
+			addr, err := parseAddress(value)
+			if err != nil {
+				return nil, err
+			}
+
+			// The address is XORed with the magic cookie followed by the
+			// transaction ID.
+			for i := range addr {
+				addr[i] ^= msg[4+i]
+			}
+
+			return addr, nil
+		case attrMappedAddress:
+			addr, err := parseAddress(value)
+			if err != nil {
+				return nil, err
+			}
+
+			mapped = addr
+		}
+
+		// Attributes are padded to a multiple of 4 bytes.
+		padded := 4 + (n+3)&^3
+		if padded > len(attrs) {
+			break
+		}
+
+		attrs = attrs[padded:]
+	}
+
+	if mapped == nil {
+		return nil, errors.New("no mapped address in response")
+	}
+
+	return mapped, nil
+}
+
+// parseAddress parses the value of a (XOR-)MAPPED-ADDRESS attribute.
+func parseAddress(value []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, errors.New("invalid address attribute")
+	}
+
+	var size int
+
+	switch value[1] {
+	case familyIPv4:
+		size = net.IPv4len
+	case familyIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("invalid address family %#02x", value[1])
+	}
+
+	if len(value) < 4+size {
+		return nil, errors.New("invalid address attribute")
+	}
+
+	return append(net.IP(nil), value[4:4+size]...), nil
+}
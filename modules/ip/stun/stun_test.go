@@ -0,0 +1,154 @@
+package stun
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attribute encodes a STUN attribute including padding.
+func attribute(typ uint16, value []byte) []byte {
+	attr := make([]byte, 4, 4+len(value)+3)
+	binary.BigEndian.PutUint16(attr, typ)
+	binary.BigEndian.PutUint16(attr[2:], uint16(len(value)))
+	attr = append(attr, value...)
+	return append(attr, make([]byte, (4-len(value)%4)%4)...)
+}
+
+// addressValue encodes the value of a (XOR-)MAPPED-ADDRESS attribute. If
+// header is non-nil, the address is XORed with the magic cookie and
+// transaction ID.
+func addressValue(addr net.IP, port int, header []byte) []byte {
+	family := byte(familyIPv6)
+	if v4 := addr.To4(); v4 != nil {
+		family = familyIPv4
+		addr = v4
+	}
+
+	value := []byte{0, family, byte(port >> 8), byte(port)}
+	value = append(value, addr...)
+
+	if header != nil {
+		value[2] ^= header[4]
+		value[3] ^= header[5]
+		for i := range addr {
+			value[4+i] ^= header[4+i]
+		}
+	}
+
+	return value
+}
+
+// response builds a binding response for req with attrs.
+func response(req []byte, attrs ...[]byte) []byte {
+	msg := make([]byte, headerSize)
+	copy(msg, req[:headerSize])
+	binary.BigEndian.PutUint16(msg, bindingResponse)
+
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-headerSize))
+	return msg
+}
+
+// newFakeServer starts a UDP server which answers binding requests with the
+// datagrams returned by handler.
+func newFakeServer(t *testing.T, handler func(req []byte, from *net.UDPAddr) [][]byte) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	go func() {
+		buf := make([]byte, 1500)
+
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			for _, resp := range handler(buf[:n], from) {
+				_, _ = conn.WriteToUDP(resp, from)
+			}
+		}
+	}()
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestProvider(t *testing.T) {
+	server := newFakeServer(t, func(req []byte, from *net.UDPAddr) [][]byte {
+		if binary.BigEndian.Uint16(req) != bindingRequest || binary.BigEndian.Uint32(req[4:]) != magicCookie {
+			return nil
+		}
+
+		// A response to another transaction which must be ignored.
+		other := append([]byte(nil), req...)
+		other[8] ^= 0xff
+
+		return [][]byte{
+			response(other, attribute(attrXORMappedAddress, addressValue(net.ParseIP("192.0.2.1"), 1, other))),
+			response(req,
+				attribute(0x8022, []byte("fake")), // SOFTWARE
+				attribute(attrMappedAddress, addressValue(net.ParseIP("192.0.2.2"), from.Port, nil)),
+				attribute(attrXORMappedAddress, addressValue(from.IP, from.Port, req)),
+			),
+		}
+	})
+
+	result, err := NewProvider(Servers(server)).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("127.0.0.1").To4(), result.IP.To4())
+	assert.Equal(t, server, result.Source)
+}
+
+func TestProvider_Fallback(t *testing.T) {
+	broken := newFakeServer(t, func(req []byte, from *net.UDPAddr) [][]byte {
+		return [][]byte{response(req)}
+	})
+
+	working := newFakeServer(t, func(req []byte, from *net.UDPAddr) [][]byte {
+		return [][]byte{response(req, attribute(attrMappedAddress, addressValue(net.ParseIP("2001:db8::1"), from.Port, nil)))}
+	})
+
+	result, err := NewProvider(Servers(broken, working)).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), result.IP)
+	assert.Equal(t, working, result.Source)
+
+	_, err = NewProvider(Servers(broken)).Lookup()
+	require.EqualError(t, err, "all STUN servers failed: "+broken+": no mapped address in response")
+}
+
+func TestProvider_Offline(t *testing.T) {
+	silent := newFakeServer(t, func(req []byte, from *net.UDPAddr) [][]byte {
+		return nil
+	})
+
+	result, err := NewProvider(Servers(silent), Timeout(50*time.Millisecond)).Lookup()
+	require.NoError(t, err)
+	assert.Equal(t, ip.Result{Connectivity: ip.Offline}, result)
+}
+
+func TestParseResponse_XORIPv6(t *testing.T) {
+	req := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(req[4:], magicCookie)
+	copy(req[8:], "transaction!")
+
+	addr := net.ParseIP("2001:db8::1")
+
+	ip, err := parseResponse(response(req, attribute(attrXORMappedAddress, addressValue(addr, 4242, req))))
+	require.NoError(t, err)
+	assert.Equal(t, addr, ip)
+
+	_, err = parseResponse(response(req)[:10])
+	require.Error(t, err)
+}
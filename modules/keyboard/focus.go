@@ -0,0 +1,121 @@
+package keyboard
+
+import (
+	"context"
+
+	l "barista.run/logging"
+)
+
+// Window describes the window which has the input focus.
+type Window struct {
+	// ID uniquely identifies the window, e.g. the X11 window id.
+	ID string
+
+	// Class is the class of the window, e.g. "firefox". On Wayland this is
+	// the app id.
+	Class string
+}
+
+// FocusWatcher notifies about changes of the focused window.
+type FocusWatcher interface {
+	// WatchFocus returns a channel which receives the focused window
+	// whenever the focus changes, starting with the currently focused
+	// window. The zero Window is sent if no window has the focus. Watching
+	// stops and the channel is closed once ctx is done.
+	WatchFocus(ctx context.Context) (<-chan Window, error)
+}
+
+// Memory configures which windows share a remembered layout.
+type Memory int
+
+const (
+	// PerWindow remembers the layout of each window separately.
+	PerWindow Memory = iota
+
+	// PerClass remembers the layout of each window class, so that e.g. all
+	// browser windows share the same layout.
+	PerClass
+)
+
+// key returns the key under which the layout of w is remembered. Returns an
+// empty string if the layout of w should not be remembered.
+func (m Memory) key(w Window) string {
+	if m == PerClass {
+		return w.Class
+	}
+
+	return w.ID
+}
+
+// maxRemembered limits the number of remembered layouts. Windows are not
+// forgotten when they are closed, so the layouts of the least recently
+// focused windows are dropped instead.
+const maxRemembered = 100
+
+// layoutMemory remembers the layout per window and restores it on focus
+// changes.
+type layoutMemory struct {
+	watcher FocusWatcher
+	mode    Memory
+	layouts map[string]string
+	order   []string // keys of layouts, least recently focused first
+	focused string
+}
+
+func newLayoutMemory(watcher FocusWatcher, mode Memory) *layoutMemory {
+	return &layoutMemory{
+		watcher: watcher,
+		mode:    mode,
+		layouts: make(map[string]string),
+	}
+}
+
+// focus remembers the current layout for the previously focused window and
+// restores the remembered layout of w, if any. Windows which were not
+// focused before keep the current layout.
+func (m *layoutMemory) focus(w Window, provider Provider, controller Controller) {
+	key := m.mode.key(w)
+	if key == m.focused {
+		return
+	}
+
+	current, err := provider.GetLayout()
+	if err != nil {
+		l.Log("Error getting keyboard layout: %v", err)
+		m.focused = key
+		return
+	}
+
+	current = normalizeSpec(current)
+
+	if m.focused != "" {
+		m.remember(m.focused, current)
+	}
+
+	m.focused = key
+
+	if layout, ok := m.layouts[key]; ok && key != "" && layout != current {
+		controller.SetLayout(layout)
+	}
+}
+
+// remember stores the layout for key, evicting the least recently focused
+// entry if there are more than maxRemembered.
+func (m *layoutMemory) remember(key, layout string) {
+	if _, ok := m.layouts[key]; ok {
+		for i, k := range m.order {
+			if k == key {
+				m.order = append(m.order[:i], m.order[i+1:]...)
+				break
+			}
+		}
+	}
+
+	m.layouts[key] = layout
+	m.order = append(m.order, key)
+
+	if len(m.order) > maxRemembered {
+		delete(m.layouts, m.order[0])
+		m.order = m.order[1:]
+	}
+}
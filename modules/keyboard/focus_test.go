@@ -0,0 +1,25 @@
+package keyboard
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutMemory_Evict(t *testing.T) {
+	m := newLayoutMemory(nil, PerWindow)
+
+	for i := 0; i < maxRemembered; i++ {
+		m.remember(fmt.Sprintf("%#x", i), "us")
+	}
+
+	m.remember("0x0", "de")
+	m.remember("0xffff", "fr")
+
+	assert.Len(t, m.layouts, maxRemembered)
+	assert.Len(t, m.order, maxRemembered)
+	assert.Equal(t, "de", m.layouts["0x0"], "refocused window is kept")
+	assert.Equal(t, "fr", m.layouts["0xffff"])
+	assert.NotContains(t, m.layouts, "0x1", "least recently focused window is evicted")
+}
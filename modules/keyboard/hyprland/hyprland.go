@@ -0,0 +1,159 @@
+// Package hyprland provides a keyboard layout provider for the Hyprland
+// Wayland compositor which uses hyprctl. Layouts are identified by the
+// layout names configured via input:kb_layout, e.g. "us".
+package hyprland
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/martinohmann/barista-contrib/modules/keyboard"
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// Device configures the name of the keyboard whose layout is displayed and
+// switched, e.g. "at-translated-set-2-keyboard". Defaults to the main
+// keyboard.
+func Device(name string) Option {
+	return func(p *Provider) {
+		p.device = name
+	}
+}
+
+// New creates a new *keyboard.Module using Hyprland as keyboard layout
+// provider. If no layouts are given, the module cycles through the layouts
+// configured for the keyboard.
+func New(options ...Option) *keyboard.Module {
+	return keyboard.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is a keyboard.Provider for Hyprland.
+type Provider struct {
+	device string
+}
+
+type device struct {
+	Name              string `json:"name"`
+	Layout            string `json:"layout"`
+	ActiveKeymap      string `json:"active_keymap"`
+	ActiveLayoutIndex *int   `json:"active_layout_index"`
+	Main              bool   `json:"main"`
+}
+
+// layouts returns the layouts configured for the device.
+func (d device) layouts() []string {
+	return strings.Split(d.Layout, ",")
+}
+
+// keyboard returns the keyboard selected by the provider options.
+func (p *Provider) keyboard() (device, error) {
+	output, err := exec.CommandOutput("hyprctl", "devices", "-j")
+	if err != nil {
+		return device{}, err
+	}
+
+	var devices struct {
+		Keyboards []device `json:"keyboards"`
+	}
+
+	if err := json.Unmarshal(output, &devices); err != nil {
+		return device{}, err
+	}
+
+	for _, kbd := range devices.Keyboards {
+		if kbd.Name == p.device || p.device == "" && kbd.Main {
+			return kbd, nil
+		}
+	}
+
+	if p.device != "" {
+		return device{}, fmt.Errorf("keyboard %q not found", p.device)
+	}
+
+	if len(devices.Keyboards) == 0 {
+		return device{}, fmt.Errorf("no keyboard found")
+	}
+
+	return devices.Keyboards[0], nil
+}
+
+// Layouts implements keyboard.ListingProvider.
+func (p *Provider) Layouts() ([]string, error) {
+	kbd, err := p.keyboard()
+	if err != nil {
+		return nil, err
+	}
+
+	return kbd.layouts(), nil
+}
+
+// GetLayout implements keyboard.Provider. It requires a Hyprland version
+// which reports the active layout index of keyboards if more than one
+// layout is configured.
+func (p *Provider) GetLayout() (string, error) {
+	kbd, err := p.keyboard()
+	if err != nil {
+		return "", err
+	}
+
+	layouts := kbd.layouts()
+
+	index := 0
+	if kbd.ActiveLayoutIndex != nil {
+		index = *kbd.ActiveLayoutIndex
+	} else if len(layouts) > 1 {
+		return "", fmt.Errorf("active layout index of keyboard %q is unknown (active keymap %q)", kbd.Name, kbd.ActiveKeymap)
+	}
+
+	if index < 0 || index >= len(layouts) {
+		return "", fmt.Errorf("active layout %d of keyboard %q is unknown", index, kbd.Name)
+	}
+
+	return layouts[index], nil
+}
+
+// SetLayout implements keyboard.Provider.
+func (p *Provider) SetLayout(layout string) error {
+	kbd, err := p.keyboard()
+	if err != nil {
+		return err
+	}
+
+	for i, name := range kbd.layouts() {
+		if name != layout {
+			continue
+		}
+
+		output, err := exec.CommandOutput("hyprctl", "switchxkblayout", kbd.Name, strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+
+		// hyprctl exits successfully even if the command failed.
+		if msg := strings.TrimSpace(string(output)); msg != "ok" {
+			return fmt.Errorf("switching layout of keyboard %q failed: %s", kbd.Name, msg)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("layout %q is not configured for keyboard %q", layout, kbd.Name)
+}
@@ -0,0 +1,89 @@
+package hyprland
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHyprctl fakes hyprctl for a main keyboard with the us and de layouts.
+type fakeHyprctl struct {
+	active int
+	cmds   []exec.Cmd
+}
+
+func (h *fakeHyprctl) output(cmd exec.Cmd) ([]byte, error) {
+	h.cmds = append(h.cmds, cmd)
+
+	switch {
+	case cmd.Matches("hyprctl", "devices", "-j"):
+		return []byte(fmt.Sprintf(`{
+			"mice": [{"name": "mouse"}],
+			"keyboards": [
+				{"name": "power-button", "layout": "us", "active_keymap": "English (US)", "active_layout_index": 0, "main": false},
+				{"name": "kbd", "layout": "us,de", "active_keymap": "German", "active_layout_index": %d, "main": true}
+			]
+		}`, h.active)), nil
+	case cmd.Matches("hyprctl", "switchxkblayout", "kbd", "0"):
+		h.active = 0
+		return []byte("ok"), nil
+	case cmd.Matches("hyprctl", "switchxkblayout", "kbd", "1"):
+		h.active = 1
+		return []byte("ok"), nil
+	case cmd.Name == "hyprctl" && len(cmd.Args) > 0 && cmd.Args[0] == "switchxkblayout":
+		return []byte("device not found"), nil
+	default:
+		return nil, errors.New("unexpected command")
+	}
+}
+
+func TestProvider(t *testing.T) {
+	hyprctl := &fakeHyprctl{}
+	defer exec.FakeCommandOutput(hyprctl.output)()
+
+	p := NewProvider()
+
+	layouts, err := p.Layouts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us", "de"}, layouts)
+
+	layout, err := p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "us", layout)
+
+	require.NoError(t, p.SetLayout("de"))
+
+	layout, err = p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "de", layout)
+
+	require.EqualError(t, p.SetLayout("fr"), `layout "fr" is not configured for keyboard "kbd"`)
+
+	layouts, err = NewProvider(Device("power-button")).Layouts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us"}, layouts)
+
+	_, err = NewProvider(Device("unknown")).GetLayout()
+	require.EqualError(t, err, `keyboard "unknown" not found`)
+}
+
+func TestProvider_SwitchFailed(t *testing.T) {
+	defer exec.FakeCommandOutput(func(cmd exec.Cmd) ([]byte, error) {
+		if cmd.Matches("hyprctl", "devices", "-j") {
+			return []byte(`{"keyboards": [{"name": "kbd", "layout": "us,de", "main": true}]}`), nil
+		}
+
+		return []byte("device not found"), nil
+	})()
+
+	p := NewProvider()
+
+	_, err := p.GetLayout()
+	require.EqualError(t, err, `active layout index of keyboard "kbd" is unknown (active keymap "")`)
+
+	require.EqualError(t, p.SetLayout("de"), `switching layout of keyboard "kbd" failed: device not found`)
+}
@@ -1,6 +1,8 @@
 package keyboard
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 )
 
 // Provider provides the current keyboard layout and is also able to change it.
+// Providers which support XKB variants use layout specs like "us(intl)" or
+// "us(intl),de" as layout names, see ParseSpec.
 type Provider interface {
 	// GetLayout retrieves the name of the currently active keyboard layout.
 	GetLayout() (string, error)
@@ -22,6 +26,39 @@ type Provider interface {
 	SetLayout(layout string) error
 }
 
+// OptionsProvider is a Provider which knows the active XKB options, e.g.
+// "caps:escape". The options are exposed on the Layout passed to the output
+// func.
+type OptionsProvider interface {
+	Provider
+
+	// GetLayoutOptions retrieves the name of the currently active keyboard
+	// layout together with the active XKB options. It is used instead of
+	// GetLayout to obtain both at once.
+	GetLayoutOptions() (string, []string, error)
+}
+
+// ListingProvider is a Provider which knows the available layouts, e.g. the
+// groups of a multi-layout keymap. If no layouts are passed to New, the
+// module cycles through the layouts returned by Layouts.
+type ListingProvider interface {
+	Provider
+
+	// Layouts returns the names of the available layouts.
+	Layouts() ([]string, error)
+}
+
+// WatchingProvider is a Provider which is able to notify about layout
+// changes, so that the module updates instantly instead of waiting for the
+// next refresh.
+type WatchingProvider interface {
+	Provider
+
+	// Watch returns a channel which receives a value whenever the layout
+	// changes. The channel is closed when watching stops.
+	Watch() (<-chan struct{}, error)
+}
+
 // Controller can switch between keyboard layouts.
 type Controller interface {
 	// Next switches to the next layout in the layout list. This will wrap
@@ -39,20 +76,94 @@ type Controller interface {
 	// GetLayouts returns all layouts that are configured on the keyboard module
 	// instance that the controller belongs to.
 	GetLayouts() []string
+
+	// AddLayout adds a layout to the end of the layout list. Returns an error
+	// if the layout is not available in the XKB rules registry. Adding a
+	// layout which is already configured is a no-op.
+	AddLayout(layout string) error
+
+	// RemoveLayout removes a layout from the layout list. Returns an error if
+	// the layout is not configured or currently active.
+	RemoveLayout(layout string) error
 }
 
+// Display configures which representation of a layout is shown by the
+// default output of the module.
+type Display int
+
+const (
+	// ShowName shows the layout spec, e.g. "us(intl)".
+	ShowName Display = iota
+
+	// ShowDescription shows the description, e.g. "English (US)".
+	ShowDescription
+
+	// ShowCode shows the short code, e.g. "en".
+	ShowCode
+
+	// ShowFlag shows the flag emoji, e.g. "🇺🇸".
+	ShowFlag
+)
+
 // Layout contains the name of the currently set keyboard layout. It also
 // exposes a Controller to switch between available layouts.
 type Layout struct {
 	Controller
+	Metadata
 
-	// Name is the name of the keyboard layout, e.g "us".
+	// Name is the name of the keyboard layout, e.g "us". For multi-group
+	// layouts it contains the comma-separated layouts of all groups, e.g.
+	// "us,de".
 	Name string
+
+	// Variant is the XKB variant of the keyboard layout, e.g. "intl". For
+	// multi-group layouts it contains the comma-separated variants of all
+	// groups, e.g. "intl,".
+	Variant string
+
+	// Options are the active XKB options, e.g. "caps:escape". They are only
+	// populated if the provider is an OptionsProvider.
+	Options []string
 }
 
-// String implements fmt.Stringer.
+// newLayout creates a new Layout from the layout spec returned by a
+// Provider.
+func newLayout(spec string, options []string, controller Controller) Layout {
+	name, variant := ParseSpec(spec)
+
+	return Layout{
+		Controller: controller,
+		Name:       name,
+		Variant:    variant,
+		Options:    options,
+	}
+}
+
+// String implements fmt.Stringer. It returns the layout spec, e.g. "us" or
+// "us(intl)".
 func (l Layout) String() string {
-	return l.Name
+	return FormatSpec(l.Name, l.Variant)
+}
+
+// Display returns the representation of the layout selected by d. It falls
+// back to the layout spec if the metadata of the layout is unknown.
+func (l Layout) Display(d Display) string {
+	var s string
+
+	switch d {
+	case ShowDescription:
+		s = l.Description
+	case ShowCode:
+		s = l.Code
+	case ShowFlag:
+		s = l.Flag
+	}
+
+	if s == "" {
+		return l.String()
+	}
+
+	return s
 }
 
 type controller struct {
@@ -62,40 +173,135 @@ type controller struct {
 	current   int
 	provider  Provider
 	update    func()
+
+	// listing is the provider to obtain the layouts from if none were
+	// configured. It is reset once the layouts were listed.
+	listing ListingProvider
+	loaded  bool
 }
 
 func newController(provider Provider, layouts []string, updateFn func()) *controller {
 	c := &controller{
-		layouts:   layouts,
 		layoutMap: make(map[string]int),
 		provider:  provider,
 		update:    updateFn,
 	}
 
-	for i, layout := range layouts {
-		c.layoutMap[layout] = i
+	if p, ok := provider.(ListingProvider); ok && len(layouts) == 0 {
+		c.listing = p
 	}
 
-	currentLayout, _ := provider.GetLayout()
+	for _, layout := range layouts {
+		c.addLayout(normalizeSpec(layout))
+	}
+
+	return c
+}
+
+// load lists the layouts of a ListingProvider and activates the current
+// layout of the provider. This is deferred until the module is streaming and
+// retried on every refresh until it succeeded, so that a provider which is
+// not ready yet, e.g. because the X server is still starting, does not leave
+// the module without layouts.
+func (c *controller) load() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.loaded {
+		return
+	}
+
+	if c.listing != nil {
+		layouts, err := c.listing.Layouts()
+		if err != nil {
+			l.Log("Error listing keyboard layouts: %v", err)
+			return
+		}
+
+		for _, layout := range layouts {
+			c.addLayout(normalizeSpec(layout))
+		}
+
+		c.listing = nil
+	}
+
+	currentLayout, err := c.provider.GetLayout()
+	if err != nil {
+		return
+	}
+
+	currentLayout = normalizeSpec(currentLayout)
 
 	// Set the current layout as active, add it to the list of layouts if not
 	// present yet.
-	i, ok := c.layoutMap[currentLayout]
-	if ok {
-		c.current = i
-	} else {
-		c.current = len(c.layouts)
-		c.layoutMap[currentLayout] = c.current
-		c.layouts = append(c.layouts, currentLayout)
+	c.addLayout(currentLayout)
+	c.current = c.layoutMap[currentLayout]
+	c.loaded = true
+}
+
+func (c *controller) GetLayouts() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.layouts...)
+}
+
+func (c *controller) AddLayout(layout string) error {
+	if err := ValidateLayout(layout); err != nil {
+		return err
 	}
 
-	return c
+	c.Lock()
+	defer c.Unlock()
+
+	if c.addLayout(normalizeSpec(layout)) {
+		c.update()
+	}
+
+	return nil
 }
 
-func (c *controller) GetLayouts() []string {
+// addLayout appends layout to the layout list if it is not present yet.
+// Returns true if the layout was added.
+func (c *controller) addLayout(layout string) bool {
+	if _, ok := c.layoutMap[layout]; ok {
+		return false
+	}
+
+	c.layoutMap[layout] = len(c.layouts)
+	c.layouts = append(c.layouts, layout)
+
+	return true
+}
+
+func (c *controller) RemoveLayout(layout string) error {
 	c.Lock()
 	defer c.Unlock()
-	return c.layouts
+
+	layout = normalizeSpec(layout)
+
+	index, ok := c.layoutMap[layout]
+	if !ok {
+		return fmt.Errorf("keyboard layout %q is not configured", layout)
+	}
+
+	if index == c.current {
+		return fmt.Errorf("cannot remove active keyboard layout %q", layout)
+	}
+
+	c.layouts = append(c.layouts[:index], c.layouts[index+1:]...)
+
+	delete(c.layoutMap, layout)
+	for i := index; i < len(c.layouts); i++ {
+		c.layoutMap[c.layouts[i]] = i
+	}
+
+	if index < c.current {
+		c.current--
+	}
+
+	c.update()
+
+	return nil
 }
 
 func (c *controller) Next() {
@@ -116,8 +322,9 @@ func (c *controller) SetLayout(layout string) {
 	c.Lock()
 	defer c.Unlock()
 
-	index, ok := c.layoutMap[layout]
+	index, ok := c.layoutMap[normalizeSpec(layout)]
 	if !ok {
+		l.Log("Ignoring keyboard layout %q which is not configured", layout)
 		return
 	}
 
@@ -126,6 +333,9 @@ func (c *controller) SetLayout(layout string) {
 
 func (c *controller) setLayout(index int) {
 	count := len(c.layouts)
+	if count == 0 {
+		return
+	}
 
 	// handle wrap around on either side
 	index = (index + count) % count
@@ -145,18 +355,25 @@ func (c *controller) setLayout(index int) {
 // Module is a module for displaying and interacting with the keyboard layout
 // that is configured by the user.
 type Module struct {
-	controller Controller
+	controller *controller
 	provider   Provider
 	outputFunc value.Value // of func(Info) bar.Output
+	metadata   value.Value // of map[string]Metadata
 	notifyCh   <-chan struct{}
 	notifyFn   func()
 	scheduler  *timing.Scheduler
+	memory     value.Value // of *layoutMemory
 }
 
 // New creates a new *Module with given keyboard provider. By default, the
 // lists of layouts is cycled through whenever the keyboard layout display in
-// the bar is clicked or scrolled. By default, the module will refresh every 10
-// seconds. The refresh interval can be configured using `Every`.
+// the bar is clicked or scrolled. Layouts may be given as specs with
+// variants, e.g. "us(intl)" or "de(nodeadkeys)". Layouts are not validated,
+// so that custom layouts which are missing from the XKB rules registry can be
+// used, see NewValidated. If no layouts are given and the provider is a
+// ListingProvider, the layouts are obtained from the provider once the
+// module is streaming. By default, the module will refresh every 10 seconds.
+// The refresh interval can be configured using `Every`.
 func New(provider Provider, layouts ...string) *Module {
 	m := &Module{
 		provider:  provider,
@@ -165,6 +382,8 @@ func New(provider Provider, layouts ...string) *Module {
 
 	m.notifyFn, m.notifyCh = notifier.New()
 	m.controller = newController(provider, layouts, m.notifyFn)
+	m.metadata.Set(map[string]Metadata{})
+	m.memory.Set((*layoutMemory)(nil))
 	m.outputFunc.Set(func(layout Layout) bar.Output {
 		return outputs.Text(layout.String())
 	})
@@ -174,6 +393,18 @@ func New(provider Provider, layouts ...string) *Module {
 	return m
 }
 
+// NewValidated is like New, but returns an error if any of the layouts is not
+// available in the XKB rules registry, see ValidateLayout.
+func NewValidated(provider Provider, layouts ...string) (*Module, error) {
+	for _, layout := range layouts {
+		if err := ValidateLayout(layout); err != nil {
+			return nil, err
+		}
+	}
+
+	return New(provider, layouts...), nil
+}
+
 // RateLimiter throttles layout updates to once every ~20ms to avoid unexpected
 // behaviour.
 var RateLimiter = rate.NewLimiter(rate.Every(20*time.Millisecond), 1)
@@ -195,35 +426,140 @@ func defaultClickHandler(l Layout) func(bar.Event) {
 
 // Stream implements bar.Module.
 func (m *Module) Stream(s bar.Sink) {
-	layout, err := m.provider.GetLayout()
+	var watchCh <-chan struct{}
+	if p, ok := m.provider.(WatchingProvider); ok {
+		var err error
+		if watchCh, err = p.Watch(); err != nil {
+			l.Log("Error watching keyboard layout: %v", err)
+		}
+	}
+
+	memory := m.memory.Get().(*layoutMemory)
+	focusCh, stopFocus := watchFocus(memory)
+
+	layout, err := m.getLayout()
 	outputFunc := m.outputFunc.Get().(func(Layout) bar.Output)
 	for {
 		if !s.Error(err) {
-			l := Layout{
-				Name:       layout,
-				Controller: m.controller,
-			}
-
-			s.Output(outputs.Group(outputFunc(l)).OnClick(defaultClickHandler(l)))
+			s.Output(outputs.Group(outputFunc(layout)).OnClick(defaultClickHandler(layout)))
 		}
 
-		select {
-		case <-m.outputFunc.Next():
-			outputFunc = m.outputFunc.Get().(func(Layout) bar.Output)
-		case <-m.notifyCh:
-			layout, err = m.provider.GetLayout()
-		case <-m.scheduler.C:
-			layout, err = m.provider.GetLayout()
+		for updated := false; !updated; {
+			updated = true
+
+			select {
+			case <-m.outputFunc.Next():
+				outputFunc = m.outputFunc.Get().(func(Layout) bar.Output)
+			case <-m.metadata.Next():
+				layout, err = m.getLayout()
+			case <-m.memory.Next():
+				updated = false
+				stopFocus()
+				memory = m.memory.Get().(*layoutMemory)
+				focusCh, stopFocus = watchFocus(memory)
+			case <-m.notifyCh:
+				layout, err = m.getLayout()
+			case <-m.scheduler.C:
+				layout, err = m.getLayout()
+			case _, ok := <-watchCh:
+				if !ok {
+					l.Log("Stopped watching keyboard layout")
+					watchCh = nil
+				}
+				layout, err = m.getLayout()
+			case window, ok := <-focusCh:
+				// Restored layouts are picked up via the controller's
+				// update notification.
+				updated = false
+				if !ok {
+					l.Log("Stopped watching window focus")
+					focusCh = nil
+					continue
+				}
+				memory.focus(window, m.provider, m.controller)
+			}
 		}
 	}
 }
 
+// watchFocus starts watching the window focus if memory is configured. The
+// returned func stops watching.
+func watchFocus(memory *layoutMemory) (<-chan Window, func()) {
+	if memory == nil {
+		return nil, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := memory.watcher.WatchFocus(ctx)
+	if err != nil {
+		l.Log("Error watching window focus: %v", err)
+		cancel()
+		return nil, cancel
+	}
+
+	return ch, cancel
+}
+
+func (m *Module) getLayout() (Layout, error) {
+	m.controller.load()
+
+	var spec string
+	var options []string
+	var err error
+
+	if p, ok := m.provider.(OptionsProvider); ok {
+		spec, options, err = p.GetLayoutOptions()
+	} else {
+		spec, err = m.provider.GetLayout()
+	}
+
+	if err != nil {
+		return Layout{}, err
+	}
+
+	layout := newLayout(spec, options, m.controller)
+	layout.Metadata = LookupMetadata(spec)
+
+	overrides := m.metadata.Get().(map[string]Metadata)
+	if metadata, ok := overrides[layout.String()]; ok {
+		layout.Metadata = layout.Metadata.merge(metadata)
+	}
+
+	return layout, nil
+}
+
 // Output updates the output format func.
 func (m *Module) Output(format func(Layout) bar.Output) *Module {
 	m.outputFunc.Set(format)
 	return m
 }
 
+// Display configures the default output to show the representation of the
+// layout selected by d, e.g. ShowFlag.
+func (m *Module) Display(d Display) *Module {
+	return m.Output(func(layout Layout) bar.Output {
+		return outputs.Text(layout.Display(d))
+	})
+}
+
+// Metadata overrides the metadata of the layout described by spec, e.g. to
+// show "DE" instead of "de" as code. Empty fields of metadata keep the
+// values from the XKB rules registry.
+func (m *Module) Metadata(spec string, metadata Metadata) *Module {
+	overrides := m.metadata.Get().(map[string]Metadata)
+
+	updated := make(map[string]Metadata, len(overrides)+1)
+	for k, v := range overrides {
+		updated[k] = v
+	}
+
+	updated[normalizeSpec(spec)] = metadata
+	m.metadata.Set(updated)
+
+	return m
+}
+
 // Every configures the refresh interval for the module. Passing a zero
 // interval will disable refreshing.
 func (m *Module) Every(interval time.Duration) *Module {
@@ -235,6 +571,17 @@ func (m *Module) Every(interval time.Duration) *Module {
 	return m
 }
 
+// RememberLayout makes the module remember the layout of each window and
+// restore it when the window receives the focus again. If mode is PerClass,
+// the layout is remembered per window class instead. The focused window is
+// obtained from watcher, e.g. the x11 or sway keyboard provider. Only the
+// layouts of the 100 most recently focused windows or classes are
+// remembered.
+func (m *Module) RememberLayout(watcher FocusWatcher, mode Memory) *Module {
+	m.memory.Set(newLayoutMemory(watcher, mode))
+	return m
+}
+
 // Refresh forces a refresh of the module output.
 func (m *Module) Refresh() {
 	m.notifyFn()
@@ -1,13 +1,17 @@
 package keyboard
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"barista.run/bar"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
 )
 
@@ -167,3 +171,352 @@ func TestModule_NoLayouts(t *testing.T) {
 	m.Refresh()
 	testBar.LatestOutput().AssertText([]string{"keyboard: us"}, "layout de ignored")
 }
+
+type testWatchingProvider struct {
+	testProvider
+	layouts    []string
+	layoutsErr error
+	ch         chan struct{}
+}
+
+func (p *testWatchingProvider) Layouts() ([]string, error) {
+	p.Lock()
+	defer p.Unlock()
+	return p.layouts, p.layoutsErr
+}
+
+func (p *testWatchingProvider) setLayoutsError(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.layoutsErr = err
+}
+
+func (p *testWatchingProvider) Watch() (<-chan struct{}, error) {
+	return p.ch, nil
+}
+
+func TestModule_WatchingProvider(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testWatchingProvider{
+		testProvider: testProvider{layout: "us"},
+		layouts:      []string{"us", "de"},
+		ch:           make(chan struct{}),
+	}
+
+	m := New(testProvider).Every(0)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"us"})
+
+	oldRateLimiter := RateLimiter
+	defer func() { RateLimiter = oldRateLimiter }()
+	RateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"de"}, "layouts are obtained from the provider")
+
+	_ = testProvider.SetLayout("us")
+	testProvider.ch <- struct{}{}
+	out = testBar.NextOutput("layout changed")
+	out.AssertText([]string{"us"})
+
+	close(testProvider.ch)
+	out = testBar.NextOutput("watcher closed")
+	out.AssertText([]string{"us"})
+}
+
+func TestModule_ListingProviderNotReady(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testWatchingProvider{
+		testProvider: testProvider{layout: "de", err: errors.New("no display")},
+		layouts:      []string{"us", "de"},
+		layoutsErr:   errors.New("no display"),
+	}
+
+	m := New(testProvider).Every(0)
+	testBar.Run(m)
+
+	testBar.NextOutput("on start").AssertError()
+
+	testProvider.setError(nil)
+	m.Refresh()
+	out := testBar.NextOutput("provider ready, listing failed")
+	out.AssertText([]string{"de"})
+
+	testProvider.setLayoutsError(nil)
+	m.Refresh()
+	out = testBar.NextOutput("listing ready")
+	out.AssertText([]string{"de"})
+
+	oldRateLimiter := RateLimiter
+	defer func() { RateLimiter = oldRateLimiter }()
+	RateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"us"}, "layouts are listed once the provider is ready")
+}
+
+type testOptionsProvider struct {
+	testProvider
+	options []string
+}
+
+func (p *testOptionsProvider) GetLayoutOptions() (string, []string, error) {
+	layout, err := p.GetLayout()
+	return layout, p.options, err
+}
+
+func TestModule_Variants(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testOptionsProvider{
+		testProvider: testProvider{layout: "de(nodeadkeys)"},
+		options:      []string{"caps:escape"},
+	}
+
+	var layouts []Layout
+	var mu sync.Mutex
+
+	m := New(testProvider, "us()", "de(nodeadkeys)", "us(intl),de").Output(func(layout Layout) bar.Output {
+		mu.Lock()
+		layouts = append(layouts, layout)
+		mu.Unlock()
+		return outputs.Text(layout.String())
+	})
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"de(nodeadkeys)"})
+
+	oldRateLimiter := RateLimiter
+	defer func() { RateLimiter = oldRateLimiter }()
+	RateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"us(intl),de"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("layout wrap around")
+	out.AssertText([]string{"us"}, "specs are normalized")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, layouts, 3)
+	assert.Equal(t, []string{"us", "de(nodeadkeys)", "us(intl),de"}, layouts[0].GetLayouts())
+	assert.Equal(t, "de", layouts[0].Name)
+	assert.Equal(t, "nodeadkeys", layouts[0].Variant)
+	assert.Equal(t, []string{"caps:escape"}, layouts[0].Options)
+	assert.Equal(t, "us,de", layouts[1].Name)
+	assert.Equal(t, "intl,", layouts[1].Variant)
+	assert.Equal(t, "us", layouts[2].Name)
+	assert.Equal(t, "", layouts[2].Variant)
+}
+
+type testFocusWatcher chan Window
+
+func (w testFocusWatcher) WatchFocus(context.Context) (<-chan Window, error) {
+	return w, nil
+}
+
+// contextFocusWatcher passes the context of each WatchFocus call to the
+// test.
+type contextFocusWatcher chan context.Context
+
+func (w contextFocusWatcher) WatchFocus(ctx context.Context) (<-chan Window, error) {
+	w <- ctx
+	return nil, nil
+}
+
+func TestModule_RememberLayoutReplaced(t *testing.T) {
+	testBar.New(t)
+
+	watcher := make(contextFocusWatcher, 1)
+
+	m := New(&testProvider{layout: "us"}, "us").Every(0).RememberLayout(watcher, PerWindow)
+	testBar.Run(m)
+	testBar.NextOutput("on start")
+
+	first := nextContext(t, watcher)
+	require.NoError(t, first.Err())
+
+	m.RememberLayout(watcher, PerClass)
+
+	second := nextContext(t, watcher)
+	assert.Error(t, first.Err(), "old watcher stopped")
+	assert.NoError(t, second.Err(), "new watcher running")
+}
+
+func nextContext(t *testing.T, watcher contextFocusWatcher) context.Context {
+	select {
+	case ctx := <-watcher:
+		return ctx
+	case <-time.After(time.Second):
+		t.Fatal("WatchFocus not called")
+		return nil
+	}
+}
+
+func TestModule_RememberLayout(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{layout: "us"}
+	watcher := make(testFocusWatcher)
+
+	m := New(testProvider, "us", "de").Every(0).RememberLayout(watcher, PerWindow)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"us"})
+
+	oldRateLimiter := RateLimiter
+	defer func() { RateLimiter = oldRateLimiter }()
+	RateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	watcher <- Window{ID: "0x1", Class: "firefox"}
+	m.Refresh()
+	out = testBar.NextOutput("unknown window keeps layout")
+	out.AssertText([]string{"us"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"de"})
+
+	watcher <- Window{ID: "0x2", Class: "firefox"}
+	m.Refresh()
+	out = testBar.NextOutput("unknown window keeps layout")
+	out.AssertText([]string{"de"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"us"})
+
+	watcher <- Window{ID: "0x1", Class: "firefox"}
+	out = testBar.NextOutput("layout restored")
+	out.AssertText([]string{"de"})
+
+	watcher <- Window{ID: "0x2", Class: "firefox"}
+	out = testBar.NextOutput("layout restored")
+	out.AssertText([]string{"us"})
+
+	watcher <- Window{}
+	m.Refresh()
+	out = testBar.NextOutput("no focused window")
+	out.AssertText([]string{"us"})
+
+	close(watcher)
+	m.Refresh()
+	out = testBar.NextOutput("watcher closed")
+	out.AssertText([]string{"us"})
+}
+
+func TestModule_RememberLayoutPerClass(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{layout: "us"}
+	watcher := make(testFocusWatcher)
+
+	m := New(testProvider, "us", "de").Every(0).RememberLayout(watcher, PerClass)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"us"})
+
+	oldRateLimiter := RateLimiter
+	defer func() { RateLimiter = oldRateLimiter }()
+	RateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	watcher <- Window{ID: "0x1", Class: "firefox"}
+	m.Refresh()
+	testBar.NextOutput("focus changed")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"de"})
+
+	watcher <- Window{ID: "0x2", Class: "emacs"}
+	m.Refresh()
+	testBar.NextOutput("focus changed")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("next layout")
+	out.AssertText([]string{"us"})
+
+	watcher <- Window{ID: "0x3", Class: "firefox"}
+	out = testBar.NextOutput("layout of class restored")
+	out.AssertText([]string{"de"})
+
+	watcher <- Window{ID: "0x4", Class: "firefox"}
+	m.Refresh()
+	out = testBar.NextOutput("same class keeps layout")
+	out.AssertText([]string{"de"})
+}
+
+func TestModule_AddRemoveLayout(t *testing.T) {
+	useRegistry(t, testRegistry)
+	testBar.New(t)
+
+	testProvider := &testProvider{layout: "us"}
+
+	var layout Layout
+	var mu sync.Mutex
+
+	m := New(testProvider, "us", "fr", "de(intl)", "de").Every(0).Output(func(l Layout) bar.Output {
+		mu.Lock()
+		layout = l
+		mu.Unlock()
+		return outputs.Text(l.String())
+	})
+	testBar.Run(m)
+
+	testBar.NextOutput("on start").AssertText([]string{"us"})
+
+	mu.Lock()
+	controller := layout.Controller
+	mu.Unlock()
+
+	assert.Equal(t, []string{"us", "fr", "de(intl)", "de"}, controller.GetLayouts(), "unknown layouts are kept")
+
+	require.EqualError(t, controller.AddLayout("de(unknown)"), `unknown variant "unknown" of keyboard layout "de"`)
+	require.NoError(t, controller.AddLayout("us(intl)"))
+	testBar.NextOutput("layout added")
+	require.NoError(t, controller.AddLayout("us(intl)"))
+	assert.Equal(t, []string{"us", "fr", "de(intl)", "de", "us(intl)"}, controller.GetLayouts())
+
+	require.EqualError(t, controller.RemoveLayout("us"), `cannot remove active keyboard layout "us"`)
+	require.EqualError(t, controller.RemoveLayout("epo"), `keyboard layout "epo" is not configured`)
+
+	controller.SetLayout("us(intl)")
+	testBar.NextOutput("layout changed").AssertText([]string{"us(intl)"})
+
+	require.NoError(t, controller.RemoveLayout("de"))
+	testBar.NextOutput("layout removed")
+	require.NoError(t, controller.RemoveLayout("fr"))
+	testBar.NextOutput("layout removed")
+	require.NoError(t, controller.RemoveLayout("de(intl)"))
+	testBar.NextOutput("layout removed")
+	assert.Equal(t, []string{"us", "us(intl)"}, controller.GetLayouts())
+
+	controller.Previous()
+	testBar.NextOutput("previous layout").AssertText([]string{"us"}, "active index is kept in sync")
+
+	controller.SetLayout("de")
+	testBar.AssertNoOutput("removed layouts are ignored")
+}
+
+func TestNewValidated(t *testing.T) {
+	useRegistry(t, testRegistry)
+
+	_, err := NewValidated(&testProvider{layout: "us"}, "us", "fr")
+	require.EqualError(t, err, `unknown keyboard layout "fr"`)
+
+	m, err := NewValidated(&testProvider{layout: "us"}, "us", "apl(dyalog)")
+	require.NoError(t, err, "layouts from the extras registry are valid")
+	assert.Equal(t, []string{"us", "apl(dyalog)"}, m.controller.GetLayouts())
+}
@@ -0,0 +1,103 @@
+package keyboard
+
+import (
+	"strings"
+
+	"github.com/martinohmann/barista-contrib/internal/xkbregistry"
+)
+
+// Metadata contains human readable information about a layout.
+type Metadata struct {
+	// Description is the human readable name of the layout, e.g.
+	// "English (US)".
+	Description string
+
+	// Code is a short code of the layout, usually the two-letter language
+	// code, e.g. "en".
+	Code string
+
+	// Flag is the flag emoji of the country the layout is used in, e.g.
+	// "🇺🇸". It is empty for layouts which are not associated with a
+	// country, e.g. "epo".
+	Flag string
+}
+
+// merge returns m with all non-empty fields of other applied.
+func (m Metadata) merge(other Metadata) Metadata {
+	if other.Description != "" {
+		m.Description = other.Description
+	}
+
+	if other.Code != "" {
+		m.Code = other.Code
+	}
+
+	if other.Flag != "" {
+		m.Flag = other.Flag
+	}
+
+	return m
+}
+
+// LookupMetadata looks up the metadata of the layout described by spec in
+// the XKB rules registry, e.g. "de(nodeadkeys)" yields "German (no dead
+// keys)", "de" and "🇩🇪". The descriptive layout names of some providers,
+// e.g. "English (US)", are looked up as well. For multi-group layouts the
+// metadata of the first group is returned. The zero Metadata is returned if
+// the layout is unknown.
+func LookupMetadata(spec string) Metadata {
+	r := loadRegistry()
+
+	name, variant := ParseSpec(spec)
+	name = strings.Split(name, ",")[0]
+	variant = strings.Split(variant, ",")[0]
+
+	if layout, ok := r.Layout(name); ok {
+		metadata := newMetadata(layout.ConfigItem)
+
+		if v, ok := layout.Variant(variant); ok {
+			metadata = metadata.merge(newMetadata(v.ConfigItem))
+		}
+
+		return metadata
+	}
+
+	if info, ok := findByDescription(r, spec); ok {
+		return info.Metadata
+	}
+
+	return Metadata{}
+}
+
+func newMetadata(item xkbregistry.ConfigItem) Metadata {
+	metadata := Metadata{
+		Description: item.Description,
+		Code:        item.ShortDescription,
+	}
+
+	if len(item.Countries) > 0 {
+		metadata.Flag = flag(item.Countries[0])
+	}
+
+	return metadata
+}
+
+// flag converts an ISO 3166 country code into a flag emoji which consists
+// of the regional indicator symbols of both letters.
+func flag(country string) string {
+	if len(country) != 2 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	for _, c := range strings.ToUpper(country) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+
+		sb.WriteRune(0x1F1E6 + c - 'A')
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,108 @@
+package keyboard
+
+import (
+	"sync"
+	"testing"
+
+	testBar "barista.run/testing/bar"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRegistry is the XKB rules registry fixture shared with the
+// xkbregistry package.
+const testRegistry = "../../internal/xkbregistry/testdata/evdev.xml"
+
+// useRegistry makes the module load the XKB rules registry from path.
+func useRegistry(t *testing.T, path string) {
+	oldPath := RegistryPath
+	RegistryPath = path
+	registryOnce = sync.Once{}
+
+	t.Cleanup(func() {
+		RegistryPath = oldPath
+		registryOnce = sync.Once{}
+	})
+}
+
+func TestLookupMetadata(t *testing.T) {
+	useRegistry(t, testRegistry)
+
+	tests := []struct {
+		spec     string
+		expected Metadata
+	}{
+		{"us", Metadata{Description: "English (US)", Code: "en", Flag: "🇺🇸"}},
+		{"us(intl)", Metadata{Description: "English (US, intl., with dead keys)", Code: "en", Flag: "🇺🇸"}},
+		{"us(chr)", Metadata{Description: "Cherokee", Code: "chr", Flag: "🇺🇸"}},
+		{"de(ch)", Metadata{Description: "German (Switzerland)", Code: "de", Flag: "🇨🇭"}},
+		{"de(unknown)", Metadata{Description: "German", Code: "de", Flag: "🇩🇪"}},
+		{"de,us(intl)", Metadata{Description: "German", Code: "de", Flag: "🇩🇪"}},
+		{"epo", Metadata{Description: "Esperanto", Code: "eo"}},
+		{"English (US)", Metadata{Description: "English (US)", Code: "en", Flag: "🇺🇸"}},
+		{"German (no dead keys)", Metadata{Description: "German (no dead keys)", Code: "de", Flag: "🇩🇪"}},
+		{"fr", Metadata{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			assert.Equal(t, test.expected, LookupMetadata(test.spec))
+		})
+	}
+}
+
+func TestLookupMetadata_RegistryNotFound(t *testing.T) {
+	useRegistry(t, "nonexistent.xml")
+
+	assert.Equal(t, Metadata{}, LookupMetadata("us"))
+}
+
+func TestLayout_Display(t *testing.T) {
+	layout := Layout{
+		Name:     "us",
+		Variant:  "intl",
+		Metadata: Metadata{Description: "English (US, intl., with dead keys)", Code: "en", Flag: "🇺🇸"},
+	}
+
+	assert.Equal(t, "us(intl)", layout.Display(ShowName))
+	assert.Equal(t, "English (US, intl., with dead keys)", layout.Display(ShowDescription))
+	assert.Equal(t, "en", layout.Display(ShowCode))
+	assert.Equal(t, "🇺🇸", layout.Display(ShowFlag))
+
+	layout.Metadata = Metadata{}
+	assert.Equal(t, "us(intl)", layout.Display(ShowFlag), "falls back to the spec")
+}
+
+func TestModule_Display(t *testing.T) {
+	useRegistry(t, testRegistry)
+	testBar.New(t)
+
+	testProvider := &testProvider{layout: "us"}
+
+	m := New(testProvider, "us", "de(nodeadkeys)", "fr").Every(0).Display(ShowCode)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"en"})
+
+	m.Metadata("us", Metadata{Code: "EN"})
+	out = testBar.NextOutput("metadata overridden")
+	out.AssertText([]string{"EN"})
+
+	m.Display(ShowFlag)
+	out = testBar.NextOutput("display changed")
+	out.AssertText([]string{"🇺🇸"}, "flag is not overridden")
+
+	_ = testProvider.SetLayout("de(nodeadkeys)")
+	m.Refresh()
+	out = testBar.NextOutput("layout changed")
+	out.AssertText([]string{"🇩🇪"})
+
+	m.Display(ShowDescription)
+	out = testBar.NextOutput("display changed")
+	out.AssertText([]string{"German (no dead keys)"})
+
+	_ = testProvider.SetLayout("fr")
+	m.Refresh()
+	out = testBar.NextOutput("unknown layout")
+	out.AssertText([]string{"fr"}, "falls back to the spec")
+}
@@ -0,0 +1,149 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	l "barista.run/logging"
+	"github.com/martinohmann/barista-contrib/internal/xkbregistry"
+)
+
+// RegistryPath is the path of the XKB rules registry which provides layout
+// metadata and the list of available layouts. It is loaded once on first
+// use, together with the extras registry next to it, e.g. evdev.extras.xml.
+var RegistryPath = xkbregistry.DefaultPath
+
+var (
+	registryOnce sync.Once
+	registry     *xkbregistry.Registry
+)
+
+// loadRegistry loads the registry from RegistryPath. An empty registry is
+// returned if it cannot be loaded.
+func loadRegistry() *xkbregistry.Registry {
+	registryOnce.Do(func() {
+		var err error
+		if registry, err = xkbregistry.LoadWithExtras(RegistryPath); err != nil {
+			l.Log("Error loading XKB registry: %v", err)
+			registry = &xkbregistry.Registry{}
+		}
+	})
+
+	return registry
+}
+
+// LayoutInfo describes a layout or variant which is available in the XKB
+// rules registry.
+type LayoutInfo struct {
+	Metadata
+
+	// Spec is the layout spec which can be passed to New or
+	// Controller.AddLayout, e.g. "us(intl)".
+	Spec string
+}
+
+// AvailableLayouts returns all layouts and their variants from the XKB rules
+// registry. Each layout is directly followed by its variants.
+func AvailableLayouts() []LayoutInfo {
+	r := loadRegistry()
+
+	var infos []LayoutInfo
+
+	for _, layout := range r.Layouts {
+		infos = append(infos, newLayoutInfo(layout, nil))
+
+		for i := range layout.Variants {
+			infos = append(infos, newLayoutInfo(layout, &layout.Variants[i]))
+		}
+	}
+
+	return infos
+}
+
+// SearchLayouts returns the layouts and variants from the XKB rules registry
+// whose spec, description or code contains query. The search is case
+// insensitive.
+func SearchLayouts(query string) []LayoutInfo {
+	query = strings.ToLower(query)
+
+	var infos []LayoutInfo
+
+	for _, info := range AvailableLayouts() {
+		for _, s := range []string{info.Spec, info.Description, info.Code} {
+			if strings.Contains(strings.ToLower(s), query) {
+				infos = append(infos, info)
+				break
+			}
+		}
+	}
+
+	return infos
+}
+
+// ValidateLayout returns an error if the layout or variant of any group of
+// spec is not available in the XKB rules registry. The descriptive layout
+// names of some providers, e.g. "English (US)", are accepted as well.
+// Validation is skipped if the registry cannot be loaded.
+func ValidateLayout(spec string) error {
+	r := loadRegistry()
+	if len(r.Layouts) == 0 {
+		return nil
+	}
+
+	if _, ok := findByDescription(r, spec); ok {
+		return nil
+	}
+
+	name, variant := ParseSpec(spec)
+	variants := strings.Split(variant, ",")
+
+	for i, name := range strings.Split(name, ",") {
+		layout, ok := r.Layout(name)
+		if !ok {
+			return fmt.Errorf("unknown keyboard layout %q", name)
+		}
+
+		if i >= len(variants) || variants[i] == "" {
+			continue
+		}
+
+		if _, ok := layout.Variant(variants[i]); !ok {
+			return fmt.Errorf("unknown variant %q of keyboard layout %q", variants[i], name)
+		}
+	}
+
+	return nil
+}
+
+// findByDescription finds the layout or variant whose description is
+// exactly description.
+func findByDescription(r *xkbregistry.Registry, description string) (LayoutInfo, bool) {
+	for _, layout := range r.Layouts {
+		if layout.ConfigItem.Description == description {
+			return newLayoutInfo(layout, nil), true
+		}
+
+		for i, v := range layout.Variants {
+			if v.ConfigItem.Description == description {
+				return newLayoutInfo(layout, &layout.Variants[i]), true
+			}
+		}
+	}
+
+	return LayoutInfo{}, false
+}
+
+func newLayoutInfo(layout xkbregistry.Layout, variant *xkbregistry.Variant) LayoutInfo {
+	info := LayoutInfo{
+		Metadata: newMetadata(layout.ConfigItem),
+		Spec:     layout.ConfigItem.Name,
+	}
+
+	if variant != nil {
+		info.Metadata = info.Metadata.merge(newMetadata(variant.ConfigItem))
+		info.Spec = FormatSpec(layout.ConfigItem.Name, variant.ConfigItem.Name)
+	}
+
+	return info
+}
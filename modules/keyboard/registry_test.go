@@ -0,0 +1,80 @@
+package keyboard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailableLayouts(t *testing.T) {
+	useRegistry(t, testRegistry)
+
+	var specs []string
+	for _, info := range AvailableLayouts() {
+		specs = append(specs, info.Spec)
+	}
+
+	assert.Equal(t, []string{"us", "us(intl)", "us(chr)", "us(drix)", "de", "de(nodeadkeys)", "de(ch)", "epo", "apl", "apl(dyalog)"}, specs)
+}
+
+func TestSearchLayouts(t *testing.T) {
+	useRegistry(t, testRegistry)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"german", []string{"de", "de(nodeadkeys)", "de(ch)"}},
+		{"DEAD KEYS", []string{"us(intl)", "de(nodeadkeys)"}},
+		{"eo", []string{"epo"}},
+		{"us(", []string{"us(intl)", "us(chr)", "us(drix)"}},
+		{"french", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			var specs []string
+			for _, info := range SearchLayouts(test.query) {
+				specs = append(specs, info.Spec)
+			}
+
+			assert.Equal(t, test.expected, specs)
+		})
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	useRegistry(t, testRegistry)
+
+	tests := []struct {
+		spec        string
+		expectedErr string
+	}{
+		{spec: "us"},
+		{spec: "us(intl),de(nodeadkeys)"},
+		{spec: "apl(dyalog)"},
+		{spec: "English (US)"},
+		{spec: "fr", expectedErr: `unknown keyboard layout "fr"`},
+		{spec: "us,fr", expectedErr: `unknown keyboard layout "fr"`},
+		{spec: "de(intl)", expectedErr: `unknown variant "intl" of keyboard layout "de"`},
+		{spec: "French", expectedErr: `unknown keyboard layout "French"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			err := ValidateLayout(test.spec)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestValidateLayout_RegistryNotFound(t *testing.T) {
+	useRegistry(t, "nonexistent.xml")
+
+	require.NoError(t, ValidateLayout("fr"), "validation is skipped")
+}
@@ -0,0 +1,65 @@
+package keyboard
+
+import (
+	"regexp"
+	"strings"
+)
+
+var specGroupRegexp = regexp.MustCompile(`^([\w-]+)(?:\(([\w-]*)\))?$`)
+
+// ParseSpec splits an XKB layout spec into its layout and variant, e.g.
+// "us(intl)" yields "us" and "intl". Specs of multi-group layouts are
+// comma-separated, e.g. "us(intl),de" yields "us,de" and "intl,". The
+// variant is empty if none of the groups has a variant. Strings which are
+// not XKB layout specs, like the descriptive layout names of some
+// providers, are returned unchanged as layout.
+func ParseSpec(spec string) (layout, variant string) {
+	groups := strings.Split(spec, ",")
+	layouts := make([]string, len(groups))
+	variants := make([]string, len(groups))
+	hasVariant := false
+
+	for i, group := range groups {
+		submatches := specGroupRegexp.FindStringSubmatch(group)
+		if submatches == nil {
+			return spec, ""
+		}
+
+		layouts[i] = submatches[1]
+		variants[i] = submatches[2]
+		hasVariant = hasVariant || variants[i] != ""
+	}
+
+	layout = strings.Join(layouts, ",")
+	if hasVariant {
+		variant = strings.Join(variants, ",")
+	}
+
+	return layout, variant
+}
+
+// FormatSpec is the inverse of ParseSpec. It combines the comma-separated
+// layouts and variants of each group into a layout spec, e.g. "us,de" and
+// "intl," yield "us(intl),de".
+func FormatSpec(layout, variant string) string {
+	if variant == "" {
+		return layout
+	}
+
+	layouts := strings.Split(layout, ",")
+	variants := strings.Split(variant, ",")
+
+	for i, variant := range variants {
+		if i < len(layouts) && variant != "" {
+			layouts[i] += "(" + variant + ")"
+		}
+	}
+
+	return strings.Join(layouts, ",")
+}
+
+// normalizeSpec brings spec into the canonical form returned by FormatSpec,
+// so that equivalent specs like "us()" and "us" compare equal.
+func normalizeSpec(spec string) string {
+	return FormatSpec(ParseSpec(spec))
+}
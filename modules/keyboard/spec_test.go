@@ -0,0 +1,32 @@
+package keyboard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec            string
+		layout, variant string
+		formatted       string
+	}{
+		{"us", "us", "", "us"},
+		{"us(intl)", "us", "intl", "us(intl)"},
+		{"us()", "us", "", "us"},
+		{"us,de", "us,de", "", "us,de"},
+		{"us(intl),de", "us,de", "intl,", "us(intl),de"},
+		{"us,de(nodeadkeys)", "us,de", ",nodeadkeys", "us,de(nodeadkeys)"},
+		{"English (US)", "English (US)", "", "English (US)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			layout, variant := ParseSpec(test.spec)
+			assert.Equal(t, test.layout, layout)
+			assert.Equal(t, test.variant, variant)
+			assert.Equal(t, test.formatted, FormatSpec(layout, variant))
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Package sway provides a keyboard layout provider for the sway Wayland
+// compositor which uses the sway IPC socket. Layouts are identified by the
+// descriptive names sway reports, e.g. "English (US)".
+package sway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/martinohmann/barista-contrib/internal/swayipc"
+	"github.com/martinohmann/barista-contrib/modules/keyboard"
+)
+
+// Option is a func that can be passed to New or NewProvider to configure the
+// provider.
+type Option func(p *Provider)
+
+// SocketPath configures the path of the sway IPC socket. Defaults to the
+// value of the SWAYSOCK environment variable.
+func SocketPath(path string) Option {
+	return func(p *Provider) {
+		p.socketPath = path
+	}
+}
+
+// Identifier configures the identifier of the keyboard whose layout is
+// displayed, e.g. "1:1:AT_Translated_Set_2_keyboard". Defaults to the first
+// keyboard with more than one layout, falling back to the first keyboard.
+func Identifier(identifier string) Option {
+	return func(p *Provider) {
+		p.identifier = identifier
+	}
+}
+
+// New creates a new *keyboard.Module using sway as keyboard layout provider.
+// If no layouts are given, the module cycles through the layouts configured
+// for the keyboard.
+func New(options ...Option) *keyboard.Module {
+	return keyboard.New(NewProvider(options...))
+}
+
+// NewProvider creates a new *Provider and configures it with the provided
+// options.
+func NewProvider(options ...Option) *Provider {
+	p := &Provider{}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Provider is a keyboard.Provider for sway. The connection to the IPC socket
+// is established lazily and re-established after errors.
+type Provider struct {
+	sync.Mutex
+	socketPath string
+	identifier string
+	conn       *swayipc.Conn
+}
+
+type input struct {
+	Identifier        string   `json:"identifier"`
+	Type              string   `json:"type"`
+	LayoutNames       []string `json:"xkb_layout_names"`
+	ActiveLayoutIndex int      `json:"xkb_active_layout_index"`
+}
+
+// do calls fn with the connection to the IPC socket, dialing it if
+// necessary. The connection is dropped if fn returns an error.
+func (p *Provider) do(fn func(conn *swayipc.Conn) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn == nil {
+		conn, err := swayipc.Dial(p.socketPath)
+		if err != nil {
+			return err
+		}
+
+		p.conn = conn
+	}
+
+	err := fn(p.conn)
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+
+	return err
+}
+
+// keyboard returns the keyboard input selected by the provider options.
+func (p *Provider) keyboard(conn *swayipc.Conn) (input, error) {
+	reply, err := conn.Request(swayipc.GetInputs, nil)
+	if err != nil {
+		return input{}, err
+	}
+
+	var inputs []input
+
+	if err := json.Unmarshal(reply, &inputs); err != nil {
+		return input{}, err
+	}
+
+	var candidates []input
+
+	for _, in := range inputs {
+		if in.Type != "keyboard" {
+			continue
+		}
+
+		if p.identifier != "" {
+			if in.Identifier == p.identifier {
+				return in, nil
+			}
+
+			continue
+		}
+
+		if len(in.LayoutNames) > 1 {
+			return in, nil
+		}
+
+		candidates = append(candidates, in)
+	}
+
+	if len(candidates) == 0 {
+		if p.identifier != "" {
+			return input{}, fmt.Errorf("keyboard %q not found", p.identifier)
+		}
+
+		return input{}, fmt.Errorf("no keyboard found")
+	}
+
+	return candidates[0], nil
+}
+
+// Layouts implements keyboard.ListingProvider.
+func (p *Provider) Layouts() (layouts []string, err error) {
+	err = p.do(func(conn *swayipc.Conn) error {
+		kbd, err := p.keyboard(conn)
+		layouts = kbd.LayoutNames
+		return err
+	})
+
+	return layouts, err
+}
+
+// GetLayout implements keyboard.Provider.
+func (p *Provider) GetLayout() (layout string, err error) {
+	err = p.do(func(conn *swayipc.Conn) error {
+		kbd, err := p.keyboard(conn)
+		if err != nil {
+			return err
+		}
+
+		if kbd.ActiveLayoutIndex >= len(kbd.LayoutNames) {
+			return fmt.Errorf("active layout %d of keyboard %q is unknown", kbd.ActiveLayoutIndex, kbd.Identifier)
+		}
+
+		layout = kbd.LayoutNames[kbd.ActiveLayoutIndex]
+		return nil
+	})
+
+	return layout, err
+}
+
+// SetLayout implements keyboard.Provider. The layout is only switched on the
+// keyboard selected by the provider options, as other keyboards may have
+// different layouts configured.
+func (p *Provider) SetLayout(layout string) error {
+	return p.do(func(conn *swayipc.Conn) error {
+		kbd, err := p.keyboard(conn)
+		if err != nil {
+			return err
+		}
+
+		for i, name := range kbd.LayoutNames {
+			if name == layout {
+				return conn.Command(fmt.Sprintf("input %q xkb_switch_layout %d", kbd.Identifier, i))
+			}
+		}
+
+		return fmt.Errorf("layout %q is not configured for keyboard %q", layout, kbd.Identifier)
+	})
+}
+
+// Watch implements keyboard.WatchingProvider. It subscribes to input events
+// on a dedicated connection to the IPC socket. The returned channel is
+// closed when the connection is lost.
+func (p *Provider) Watch() (<-chan struct{}, error) {
+	conn, err := swayipc.Dial(p.socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := conn.Subscribe("input")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+
+		for ev := range events {
+			var payload struct {
+				Change string `json:"change"`
+			}
+
+			if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+				continue
+			}
+
+			if payload.Change != "xkb_layout" && payload.Change != "xkb_keymap" {
+				continue
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// node is a node of the sway layout tree.
+type node struct {
+	ID               int64  `json:"id"`
+	Type             string `json:"type"`
+	Focused          bool   `json:"focused"`
+	AppID            string `json:"app_id"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+	Nodes         []node `json:"nodes"`
+	FloatingNodes []node `json:"floating_nodes"`
+}
+
+// window converts n into a keyboard.Window. The zero keyboard.Window is
+// returned if n is not a window, e.g. an empty workspace.
+func (n node) window() keyboard.Window {
+	if n.Type != "con" && n.Type != "floating_con" {
+		return keyboard.Window{}
+	}
+
+	window := keyboard.Window{
+		ID:    strconv.FormatInt(n.ID, 10),
+		Class: n.AppID,
+	}
+
+	// Xwayland windows do not have an app id.
+	if window.Class == "" {
+		window.Class = n.WindowProperties.Class
+	}
+
+	return window
+}
+
+// findFocused returns the focused node of the tree rooted at n.
+func (n node) findFocused() (node, bool) {
+	if n.Focused {
+		return n, true
+	}
+
+	for _, children := range [][]node{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			if focused, ok := child.findFocused(); ok {
+				return focused, true
+			}
+		}
+	}
+
+	return node{}, false
+}
+
+// WatchFocus implements keyboard.FocusWatcher. It subscribes to window
+// events on a dedicated connection to the IPC socket. The returned channel
+// is closed once ctx is done or the connection is lost.
+func (p *Provider) WatchFocus(ctx context.Context) (<-chan keyboard.Window, error) {
+	conn, err := swayipc.Dial(p.socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.Request(swayipc.GetTree, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var tree node
+
+	if err := json.Unmarshal(reply, &tree); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	events, err := conn.Subscribe("window")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	focused, _ := tree.findFocused()
+
+	ch := make(chan keyboard.Window, 1)
+	ch <- focused.window()
+
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(ch)
+		defer close(done)
+
+		for ev := range events {
+			var payload struct {
+				Change    string `json:"change"`
+				Container node   `json:"container"`
+			}
+
+			if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+				continue
+			}
+
+			if ev.Type != swayipc.WindowEvent || payload.Change != "focus" {
+				continue
+			}
+
+			select {
+			case ch <- payload.Container.window():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,211 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/internal/swayipc"
+	"github.com/martinohmann/barista-contrib/modules/keyboard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSway emulates the keyboard related parts of the sway IPC.
+type fakeSway struct {
+	*swayipc.FakeServer
+	sync.Mutex
+	active int
+}
+
+func newFakeSway(t *testing.T) *fakeSway {
+	dir, err := ioutil.TempDir("", "sway")
+	require.NoError(t, err)
+
+	s, err := swayipc.NewFakeServer(filepath.Join(dir, "sway.sock"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+
+	sway := &fakeSway{FakeServer: s}
+
+	s.Handle(swayipc.GetInputs, func(payload []byte) []byte {
+		sway.Lock()
+		defer sway.Unlock()
+
+		return []byte(fmt.Sprintf(`[
+			{"identifier":"1:1:mouse","type":"pointer"},
+			{"identifier":"1:1:power","type":"keyboard","xkb_layout_names":["English (US)"],"xkb_active_layout_index":0},
+			{"identifier":"1:1:kbd","type":"keyboard","xkb_layout_names":["English (US)","German"],"xkb_active_layout_index":%d}
+		]`, sway.active))
+	})
+
+	s.Handle(swayipc.RunCommand, func(payload []byte) []byte {
+		sway.Lock()
+		defer sway.Unlock()
+
+		var identifier string
+		var index int
+		if _, err := fmt.Sscanf(string(payload), "input %q xkb_switch_layout %d", &identifier, &index); err != nil {
+			return []byte(`[{"success":false,"error":"Unknown command"}]`)
+		}
+
+		if identifier == "1:1:kbd" {
+			sway.active = index
+		}
+
+		return []byte(`[{"success":true}]`)
+	})
+
+	return sway
+}
+
+func TestProvider(t *testing.T) {
+	s := newFakeSway(t)
+
+	p := NewProvider(SocketPath(s.Path()))
+
+	layouts, err := p.Layouts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"English (US)", "German"}, layouts)
+
+	layout, err := p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "English (US)", layout)
+
+	require.NoError(t, p.SetLayout("German"))
+
+	layout, err = p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "German", layout)
+
+	require.Error(t, p.SetLayout("French"))
+
+	var commands []string
+	for _, req := range s.Requests() {
+		if req.Type == swayipc.RunCommand {
+			commands = append(commands, string(req.Payload))
+		}
+	}
+
+	assert.Equal(t, []string{`input "1:1:kbd" xkb_switch_layout 1`}, commands)
+}
+
+func TestProvider_Identifier(t *testing.T) {
+	s := newFakeSway(t)
+
+	layouts, err := NewProvider(SocketPath(s.Path()), Identifier("1:1:power")).Layouts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"English (US)"}, layouts)
+
+	_, err = NewProvider(SocketPath(s.Path()), Identifier("1:1:unknown")).GetLayout()
+	require.EqualError(t, err, `keyboard "1:1:unknown" not found`)
+}
+
+func TestProvider_Watch(t *testing.T) {
+	s := newFakeSway(t)
+
+	ch, err := NewProvider(SocketPath(s.Path())).Watch()
+	require.NoError(t, err)
+
+	s.SendEvent(swayipc.InputEvent, []byte(`{"change":"added"}`))
+	s.SendEvent(swayipc.InputEvent, []byte(`{"change":"xkb_layout"}`))
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for layout change")
+	}
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected layout change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Close()
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "channel is closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for channel to be closed")
+	}
+}
+
+func TestProvider_WatchFocusCanceled(t *testing.T) {
+	s := newFakeSway(t)
+
+	s.Handle(swayipc.GetTree, func(payload []byte) []byte {
+		return []byte(`{"id":1,"type":"root"}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := NewProvider(SocketPath(s.Path())).WatchFocus(ctx)
+	require.NoError(t, err)
+
+	// Leave the initial window unread, so that sending the focus change
+	// blocks until ctx is done.
+	s.SendEvent(swayipc.WindowEvent, []byte(`{"change":"focus","container":{"id":4,"type":"con","app_id":"foot"}}`))
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+
+	assert.Equal(t, keyboard.Window{}, <-ch, "initially focused window")
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "channel is closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for channel to be closed")
+	}
+}
+
+func TestProvider_WatchFocus(t *testing.T) {
+	s := newFakeSway(t)
+
+	s.Handle(swayipc.GetTree, func(payload []byte) []byte {
+		return []byte(`{"id":1,"type":"root","nodes":[
+			{"id":2,"type":"output","nodes":[
+				{"id":3,"type":"workspace","nodes":[
+					{"id":4,"type":"con","app_id":"foot"}
+				],"floating_nodes":[
+					{"id":5,"type":"floating_con","app_id":null,"window_properties":{"class":"Firefox"},"focused":true}
+				]}
+			]}
+		]}`)
+	})
+
+	ch, err := NewProvider(SocketPath(s.Path())).WatchFocus(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, keyboard.Window{ID: "5", Class: "Firefox"}, <-ch, "initially focused window")
+
+	s.SendEvent(swayipc.WindowEvent, []byte(`{"change":"title","container":{"id":5,"type":"floating_con"}}`))
+	s.SendEvent(swayipc.WindowEvent, []byte(`{"change":"focus","container":{"id":4,"type":"con","app_id":"foot"}}`))
+
+	select {
+	case window := <-ch:
+		assert.Equal(t, keyboard.Window{ID: "4", Class: "foot"}, window)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for focus change")
+	}
+
+	s.Close()
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "channel is closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for channel to be closed")
+	}
+}
@@ -0,0 +1,339 @@
+// Package x11 provides a keyboard layout provider which talks to the X
+// server directly using the XKB extension instead of spawning setxkbmap.
+// Layouts are switched by changing the group of a multi-layout keymap, e.g.
+// one configured via `setxkbmap us,de`, so that XKB options are preserved.
+package x11
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/martinohmann/barista-contrib/internal/x11"
+	"github.com/martinohmann/barista-contrib/modules/keyboard"
+)
+
+// New creates a new *keyboard.Module using the X server of the display from
+// the DISPLAY environment variable as keyboard layout provider. If no
+// layouts are given, the module cycles through the groups of the keymap.
+func New(layouts ...string) *keyboard.Module {
+	return keyboard.New(NewProvider(os.Getenv("DISPLAY")), layouts...)
+}
+
+// Provider is a keyboard.Provider which uses the XKB extension of an X
+// server. The connection to the X server is established lazily and
+// re-established after errors.
+type Provider struct {
+	sync.Mutex
+	display string
+	conn    *x11.Conn
+}
+
+// NewProvider creates a new *Provider for display.
+func NewProvider(display string) *Provider {
+	return &Provider{display: display}
+}
+
+// dial connects to the X server and initializes the XKB extension.
+func (p *Provider) dial() (*x11.Conn, error) {
+	conn, err := x11.Dial(p.display)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.XKBUseExtension(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// do calls fn with the connection to the X server, dialing it if necessary.
+// The connection is dropped if fn returns an error which is not an X protocol
+// error, so that the next call will dial again.
+func (p *Provider) do(fn func(conn *x11.Conn) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn == nil {
+		conn, err := p.dial()
+		if err != nil {
+			return err
+		}
+
+		p.conn = conn
+	}
+
+	err := fn(p.conn)
+	if _, ok := err.(*x11.Error); err != nil && !ok {
+		p.conn.Close()
+		p.conn = nil
+	}
+
+	return err
+}
+
+// Layouts implements keyboard.ListingProvider. It returns the layouts of the
+// groups of the keymap in order.
+func (p *Provider) Layouts() (layouts []string, err error) {
+	err = p.do(func(conn *x11.Conn) error {
+		layouts, err = getLayouts(conn)
+		return err
+	})
+
+	return layouts, err
+}
+
+// GetLayout implements keyboard.Provider.
+func (p *Provider) GetLayout() (layout string, err error) {
+	err = p.do(func(conn *x11.Conn) error {
+		layouts, err := getLayouts(conn)
+		if err != nil {
+			return err
+		}
+
+		group, err := conn.XKBGroup()
+		if err != nil {
+			return err
+		}
+
+		if group >= len(layouts) {
+			return fmt.Errorf("active group %d is not part of the keymap %v", group, layouts)
+		}
+
+		layout = layouts[group]
+		return nil
+	})
+
+	return layout, err
+}
+
+// SetLayout implements keyboard.Provider. It switches to the group of the
+// keymap that contains layout. Layouts which are not part of the keymap are
+// rejected.
+func (p *Provider) SetLayout(layout string) error {
+	return p.do(func(conn *x11.Conn) error {
+		layouts, err := getLayouts(conn)
+		if err != nil {
+			return err
+		}
+
+		for group, name := range layouts {
+			if name == layout {
+				return conn.XKBLockGroup(group)
+			}
+		}
+
+		return fmt.Errorf("layout %q is not part of the keymap %v", layout, layouts)
+	})
+}
+
+// Watch implements keyboard.WatchingProvider. It uses a dedicated
+// connection to the X server which receives XKB events whenever the active
+// group or the keymap changes. The returned channel is closed when the
+// connection is lost.
+func (p *Provider) Watch() (<-chan struct{}, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.XKBSelectEvents(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+
+		for ev := range conn.Events() {
+			if !conn.IsXKBLayoutNotify(ev) {
+				continue
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// WatchFocus implements keyboard.FocusWatcher. It uses a dedicated
+// connection to the X server which receives events whenever the
+// _NET_ACTIVE_WINDOW property of the root window changes. X protocol errors,
+// e.g. for windows which are destroyed while being inspected, are skipped.
+// The returned channel is closed once ctx is done or the connection is lost.
+func (p *Provider) WatchFocus(ctx context.Context) (<-chan keyboard.Window, error) {
+	conn, err := x11.Dial(p.display)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SelectPropertyChanges(conn.Root()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	window, err := activeWindow(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ch := make(chan keyboard.Window, 1)
+	ch <- window
+
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(ch)
+		defer close(done)
+
+		for ev := range conn.Events() {
+			if !conn.IsPropertyNotify(ev, conn.Root(), "_NET_ACTIVE_WINDOW") {
+				continue
+			}
+
+			window, err := activeWindow(conn)
+			if _, ok := err.(*x11.Error); ok {
+				// The window may have been destroyed in the meantime,
+				// resulting in a BadWindow error.
+				continue
+			} else if err != nil {
+				return
+			}
+
+			select {
+			case ch <- window:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// activeWindow returns the window referenced by the _NET_ACTIVE_WINDOW
+// property of the root window. The zero keyboard.Window is returned if no
+// window is active.
+func activeWindow(conn *x11.Conn) (keyboard.Window, error) {
+	prop, err := conn.GetProperty(conn.Root(), "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return keyboard.Window{}, err
+	}
+
+	windows := prop.Uint32s()
+	if len(windows) == 0 || windows[0] == 0 {
+		return keyboard.Window{}, nil
+	}
+
+	prop, err = conn.GetProperty(windows[0], "WM_CLASS")
+	if err != nil {
+		return keyboard.Window{}, err
+	}
+
+	window := keyboard.Window{ID: fmt.Sprintf("%#x", windows[0])}
+
+	// WM_CLASS contains the instance name followed by the class name.
+	if classes := prop.Strings(); len(classes) > 0 {
+		window.Class = classes[len(classes)-1]
+	}
+
+	return window, nil
+}
+
+func getLayouts(conn *x11.Conn) ([]string, error) {
+	names, err := conn.XKBNames()
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := parseSymbols(names.Symbols)
+	if len(layouts) == 0 {
+		return nil, fmt.Errorf("no layouts found in symbols %q", names.Symbols)
+	}
+
+	return layouts, nil
+}
+
+// nonLayoutSymbols are symbols files which appear in the symbols name of a
+// keymap but do not describe a layout.
+var nonLayoutSymbols = map[string]bool{
+	"altwin":    true,
+	"capslock":  true,
+	"compose":   true,
+	"ctrl":      true,
+	"eurosign":  true,
+	"evdev":     true,
+	"group":     true,
+	"inet":      true,
+	"keypad":    true,
+	"kpdl":      true,
+	"level3":    true,
+	"level5":    true,
+	"lv3":       true,
+	"lv5":       true,
+	"nbsp":      true,
+	"pc":        true,
+	"shift":     true,
+	"srvr_ctrl": true,
+	"terminate": true,
+	"typo":      true,
+}
+
+// parseSymbols extracts the layouts of each group from the symbols name of a
+// keymap, e.g. "pc+us(intl)+de:2+inet(evdev)" yields ["us(intl)", "de"].
+// The layouts are specs as described by keyboard.ParseSpec.
+func parseSymbols(symbols string) []string {
+	var layouts []string
+
+	for _, part := range strings.Split(symbols, "+") {
+		group := 0
+
+		if i := strings.Index(part, ":"); i >= 0 {
+			var n int
+			if _, err := fmt.Sscanf(part[i+1:], "%d", &n); err != nil || n < 1 {
+				continue
+			}
+
+			group = n - 1
+			part = part[:i]
+		} else if len(layouts) > 0 {
+			// Symbols without group index after the first layout are
+			// options which are merged into the first group.
+			continue
+		}
+
+		name, variant := keyboard.ParseSpec(part)
+		if name == "" || nonLayoutSymbols[name] {
+			continue
+		}
+
+		for len(layouts) <= group {
+			layouts = append(layouts, "")
+		}
+
+		layouts[group] = keyboard.FormatSpec(name, variant)
+	}
+
+	return layouts
+}
@@ -0,0 +1,112 @@
+package x11
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/barista-contrib/modules/keyboard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSymbols(t *testing.T) {
+	tests := []struct {
+		symbols  string
+		expected []string
+	}{
+		{"pc+us+inet(evdev)", []string{"us"}},
+		{"pc+us+de:2+inet(evdev)+group(alt_shift_toggle)", []string{"us", "de"}},
+		{"pc+us(intl)+ru(phonetic):2+ua:3+inet(evdev)+compose(ralt)", []string{"us(intl)", "ru(phonetic)", "ua"}},
+		{"pc+de+custom(foo)", []string{"de"}},
+		{"pc+inet(evdev)", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.symbols, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseSymbols(test.symbols))
+		})
+	}
+}
+
+// startXvfb starts an Xvfb server with a us,de keymap and returns its
+// display. The test is skipped if Xvfb or setxkbmap are not installed.
+func startXvfb(t *testing.T) string {
+	for _, name := range []string{"Xvfb", "setxkbmap"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not installed", name)
+		}
+	}
+
+	display := fmt.Sprintf(":%d", 100+os.Getpid()%100)
+
+	cmd := exec.Command("Xvfb", display, "-nolisten", "tcp")
+	require.NoError(t, cmd.Start())
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = exec.Command("setxkbmap", "-display", display, "us,de").Run(); err == nil {
+			return display
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	require.NoError(t, err, "configuring keymap")
+
+	return display
+}
+
+func TestProvider_Xvfb(t *testing.T) {
+	display := startXvfb(t)
+
+	p := NewProvider(display)
+
+	layouts, err := p.Layouts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us", "de"}, layouts)
+
+	layout, err := p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "us", layout)
+
+	ch, err := p.Watch()
+	require.NoError(t, err)
+
+	require.NoError(t, p.SetLayout("de"))
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for layout change event")
+	}
+
+	layout, err = p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "de", layout)
+
+	require.Error(t, p.SetLayout("fr"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	focusCh, err := p.WatchFocus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, keyboard.Window{}, <-focusCh, "Xvfb has no window manager")
+
+	cancel()
+
+	select {
+	case _, ok := <-focusCh:
+		assert.False(t, ok, "channel is closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for channel to be closed")
+	}
+}
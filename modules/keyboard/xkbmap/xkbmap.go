@@ -6,7 +6,9 @@ import (
 )
 
 // New creates a new *keyboard.Module using xkbmap as provider for keyboard
-// layouts.
+// layouts. Layouts may include variants, e.g. "us(intl)", or describe
+// multi-group layouts, e.g. "us,de". Active XKB options are preserved when
+// switching layouts.
 func New(layouts ...string) *keyboard.Module {
 	return keyboard.New(&provider{}, layouts...)
 }
@@ -14,16 +16,30 @@ func New(layouts ...string) *keyboard.Module {
 type provider struct{}
 
 // SetLayout implements keyboard.Provider.
-func (p *provider) SetLayout(layout string) error {
-	return xkbmap.SetLayout(layout)
+func (p *provider) SetLayout(spec string) error {
+	info, err := xkbmap.Query()
+	if err != nil {
+		return err
+	}
+
+	layout, variant := keyboard.ParseSpec(spec)
+
+	return xkbmap.SetLayout(layout, variant, info.Options)
 }
 
 // GetLayout implements keyboard.Provider.
 func (p *provider) GetLayout() (string, error) {
+	layout, _, err := p.GetLayoutOptions()
+	return layout, err
+}
+
+// GetLayoutOptions implements keyboard.OptionsProvider. Layout and options
+// are obtained from a single setxkbmap query.
+func (p *provider) GetLayoutOptions() (string, []string, error) {
 	info, err := xkbmap.Query()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return info.Layout, nil
+	return keyboard.FormatSpec(info.Layout, info.Variant), info.Options, nil
 }
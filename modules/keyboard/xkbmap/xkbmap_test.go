@@ -0,0 +1,39 @@
+package xkbmap
+
+import (
+	"testing"
+
+	"github.com/martinohmann/barista-contrib/internal/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	var cmds []exec.Cmd
+	var queries int
+
+	defer exec.FakeCommandOutput(func(cmd exec.Cmd) ([]byte, error) {
+		queries++
+		return []byte("layout:     us,de\nvariant:    intl,\noptions:    caps:escape\n"), nil
+	})()
+	defer exec.FakeCommandRun(func(cmd exec.Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})()
+
+	p := &provider{}
+
+	layout, err := p.GetLayout()
+	require.NoError(t, err)
+	assert.Equal(t, "us(intl),de", layout)
+
+	layout, options, err := p.GetLayoutOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "us(intl),de", layout)
+	assert.Equal(t, []string{"caps:escape"}, options)
+	assert.Equal(t, 2, queries, "layout and options are queried at once")
+
+	require.NoError(t, p.SetLayout("de(nodeadkeys)"))
+	require.Len(t, cmds, 1)
+	assert.True(t, cmds[0].Matches("setxkbmap", "-layout", "de", "-variant", "nodeadkeys", "-option", "", "-option", "caps:escape"))
+}
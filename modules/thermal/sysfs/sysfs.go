@@ -0,0 +1,228 @@
+// Package sysfs contains a thermal.Provider that reads temperature sensors
+// from /sys/class/thermal and /sys/class/hwmon.
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/martinlindhe/unit"
+	"github.com/martinohmann/barista-contrib/modules/thermal"
+)
+
+// DefaultMountPoint is the default mount point of sysfs.
+const DefaultMountPoint = "/sys"
+
+// New creates a new *thermal.Module using the sysfs mounted at
+// DefaultMountPoint as temperature sensor provider.
+func New() *thermal.Module {
+	return thermal.New(NewProvider(DefaultMountPoint))
+}
+
+// NewProvider creates a new *Provider which reads temperature sensors from
+// the sysfs mounted at mountPoint.
+func NewProvider(mountPoint string) *Provider {
+	return &Provider{mountPoint: mountPoint}
+}
+
+// Provider is a thermal.Provider which reads temperature sensors from thermal
+// zones and hwmon devices.
+type Provider struct {
+	mountPoint string
+}
+
+// Sensors implements thermal.Provider.
+func (p *Provider) Sensors() ([]thermal.Sensor, error) {
+	hwmonSensors, err := p.hwmonSensors()
+	if err != nil {
+		return nil, err
+	}
+
+	zoneSensors, err := p.thermalZoneSensors()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(hwmonSensors, zoneSensors...), nil
+}
+
+// hwmonSensors reads the temp*_input sensors of all hwmon devices.
+func (p *Provider) hwmonSensors() ([]thermal.Sensor, error) {
+	devices, err := filepath.Glob(filepath.Join(p.mountPoint, "class/hwmon/hwmon[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sortNumerically(devices)
+
+	sensors := make([]thermal.Sensor, 0)
+
+	for _, device := range devices {
+		// Some devices do not have a name, e.g. because the driver does
+		// not set one. Unreadable devices are skipped, so that they do not
+		// hide the sensors of all other devices.
+		chip, err := readString(filepath.Join(device, "name"))
+		if os.IsNotExist(err) {
+			chip = filepath.Base(device)
+		} else if err != nil {
+			continue
+		}
+
+		inputs, err := filepath.Glob(filepath.Join(device, "temp[0-9]*_input"))
+		if err != nil {
+			return nil, err
+		}
+
+		sortNumerically(inputs)
+
+		for _, input := range inputs {
+			prefix := strings.TrimSuffix(input, "_input")
+
+			temp, err := readMillidegrees(input)
+			if err != nil {
+				// Some drivers expose inputs that fail to read, e.g.
+				// because the sensor is disabled.
+				continue
+			}
+
+			// Labels and limits are optional and some drivers fail to
+			// read them, e.g. with EIO or ENODATA. The sensor is kept
+			// without them in that case.
+			label, err := readString(prefix + "_label")
+			if err != nil {
+				label = filepath.Base(prefix)
+			}
+
+			sensors = append(sensors, thermal.Sensor{
+				Chip:        chip,
+				Label:       label,
+				Temperature: temp,
+				High:        readOptionalMillidegrees(prefix + "_max"),
+				Critical:    readOptionalMillidegrees(prefix + "_crit"),
+			})
+		}
+	}
+
+	return sensors, nil
+}
+
+// thermalZoneSensors reads the temperatures of all thermal zones. The "hot"
+// and "critical" trip points are used as thresholds.
+func (p *Provider) thermalZoneSensors() ([]thermal.Sensor, error) {
+	zones, err := filepath.Glob(filepath.Join(p.mountPoint, "class/thermal/thermal_zone[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sortNumerically(zones)
+
+	sensors := make([]thermal.Sensor, 0, len(zones))
+
+	for _, zone := range zones {
+		zoneType, err := readString(filepath.Join(zone, "type"))
+		if err != nil {
+			zoneType = filepath.Base(zone)
+		}
+
+		temp, err := readMillidegrees(filepath.Join(zone, "temp"))
+		if err != nil {
+			// Disabled thermal zones fail to report their temperature.
+			continue
+		}
+
+		sensor := thermal.Sensor{
+			Chip:        zoneType,
+			Temperature: temp,
+		}
+
+		tripPoints, err := filepath.Glob(filepath.Join(zone, "trip_point_[0-9]*_type"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tripPoint := range tripPoints {
+			// Unreadable trip points are skipped like missing ones.
+			tripType, err := readString(tripPoint)
+			if err != nil || (tripType != "hot" && tripType != "critical") {
+				continue
+			}
+
+			tripTemp, err := readMillidegrees(strings.TrimSuffix(tripPoint, "_type") + "_temp")
+			if err != nil {
+				continue
+			}
+
+			if tripType == "hot" {
+				sensor.High = tripTemp
+			} else {
+				sensor.Critical = tripTemp
+			}
+		}
+
+		sensors = append(sensors, sensor)
+	}
+
+	return sensors, nil
+}
+
+// sortNumerically sorts paths by the first number in their base name, so
+// that temp10_input comes after temp2_input.
+func sortNumerically(paths []string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return firstNumber(filepath.Base(paths[i])) < firstNumber(filepath.Base(paths[j]))
+	})
+}
+
+func firstNumber(s string) int {
+	start := strings.IndexAny(s, "0123456789")
+	if start < 0 {
+		return 0
+	}
+
+	end := start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+
+	n, _ := strconv.Atoi(s[start:end])
+	return n
+}
+
+func readString(path string) (string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// readMillidegrees reads a temperature in millidegrees Celsius.
+func readMillidegrees(path string) (unit.Temperature, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	millidegrees, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return unit.FromCelsius(float64(millidegrees) / 1000), nil
+}
+
+// readOptionalMillidegrees is like readMillidegrees but returns zero if the
+// file does not exist or cannot be read.
+func readOptionalMillidegrees(path string) unit.Temperature {
+	temp, err := readMillidegrees(path)
+	if err != nil {
+		return 0
+	}
+
+	return temp
+}
@@ -0,0 +1,60 @@
+package sysfs
+
+import (
+	"testing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/martinohmann/barista-contrib/modules/thermal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	p := NewProvider("testdata")
+
+	sensors, err := p.Sensors()
+	require.NoError(t, err)
+
+	expected := []thermal.Sensor{
+		{
+			Chip:        "coretemp",
+			Label:       "Package id 0",
+			Temperature: unit.FromCelsius(52),
+			High:        unit.FromCelsius(80),
+			Critical:    unit.FromCelsius(100),
+		},
+		{Chip: "coretemp", Label: "Core 0", Temperature: unit.FromCelsius(48)},
+		{Chip: "coretemp", Label: "Core 8", Temperature: unit.FromCelsius(50)},
+		{
+			Chip:        "nvme",
+			Label:       "Composite",
+			Temperature: unit.FromCelsius(38.85),
+			Critical:    unit.FromCelsius(84.85),
+		},
+		{Chip: "nvme", Label: "temp2", Temperature: unit.FromCelsius(41)},
+		{Chip: "hwmon2", Label: "temp1", Temperature: unit.FromCelsius(45)},
+		{
+			Chip:        "acpitz",
+			Label:       "temp1",
+			Temperature: unit.FromCelsius(30),
+			Critical:    unit.FromCelsius(90),
+		},
+		{
+			Chip:        "x86_pkg_temp",
+			Temperature: unit.FromCelsius(53),
+			High:        unit.FromCelsius(95),
+			Critical:    unit.FromCelsius(105),
+		},
+		{Chip: "thermal_zone2", Temperature: unit.FromCelsius(40)},
+	}
+
+	assert.Equal(t, expected, sensors)
+}
+
+func TestProvider_NoSensors(t *testing.T) {
+	p := NewProvider("nonexistent")
+
+	sensors, err := p.Sensors()
+	require.NoError(t, err)
+	assert.Empty(t, sensors)
+}
@@ -0,0 +1,309 @@
+package thermal
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/colors"
+	"barista.run/outputs"
+	"barista.run/timing"
+	"github.com/martinlindhe/unit"
+)
+
+// Provider provides temperature sensor readings.
+type Provider interface {
+	// Sensors retrieves the current readings of all available temperature
+	// sensors.
+	Sensors() ([]Sensor, error)
+}
+
+// ProviderFunc is a func that satisfies the Provider interface.
+type ProviderFunc func() ([]Sensor, error)
+
+// Sensors implements Provider.
+func (f ProviderFunc) Sensors() ([]Sensor, error) {
+	return f()
+}
+
+// Status describes a sensor's temperature relative to its thresholds.
+type Status int
+
+// Possible sensor statuses.
+const (
+	StatusNormal Status = iota
+	StatusHigh
+	StatusCritical
+)
+
+// Sensor is a single temperature sensor reading.
+type Sensor struct {
+	// Chip is the name of the device the sensor belongs to, e.g. "coretemp",
+	// "nvme" or the type of a thermal zone like "x86_pkg_temp".
+	Chip string
+
+	// Label is the sensor label, e.g. "Package id 0" or "Composite". May be
+	// empty for devices with a single sensor.
+	Label string
+
+	// Temperature is the current temperature.
+	Temperature unit.Temperature
+
+	// High is the temperature above which the sensor is considered to be
+	// running hot. Zero if unknown.
+	High unit.Temperature
+
+	// Critical is the temperature above which the sensor is considered to be
+	// in a critical state. Zero if unknown.
+	Critical unit.Temperature
+}
+
+// Name returns the sensor name in the form "chip/label", or just the chip
+// name if the sensor does not have a label.
+func (s Sensor) Name() string {
+	if s.Label == "" {
+		return s.Chip
+	}
+
+	return s.Chip + "/" + s.Label
+}
+
+// Status returns the status of the sensor based on its thresholds.
+func (s Sensor) Status() Status {
+	switch {
+	case s.Critical > 0 && s.Temperature >= s.Critical:
+		return StatusCritical
+	case s.High > 0 && s.Temperature >= s.High:
+		return StatusHigh
+	default:
+		return StatusNormal
+	}
+}
+
+// Matches returns true if the sensor's name or label matches the glob
+// pattern. See filepath.Match for the pattern syntax.
+func (s Sensor) Matches(pattern string) bool {
+	if ok, _ := filepath.Match(pattern, s.Name()); ok {
+		return true
+	}
+
+	ok, _ := filepath.Match(pattern, s.Label)
+	return ok
+}
+
+// String implements fmt.Stringer.
+func (s Sensor) String() string {
+	return fmt.Sprintf("%.0f°C", s.Temperature.Celsius())
+}
+
+// Info contains the readings of the selected temperature sensors.
+type Info struct {
+	Sensors []Sensor
+}
+
+// Hottest returns the sensor with the highest temperature. The second return
+// value is false if there are no sensors.
+func (i Info) Hottest() (Sensor, bool) {
+	if len(i.Sensors) == 0 {
+		return Sensor{}, false
+	}
+
+	hottest := i.Sensors[0]
+	for _, sensor := range i.Sensors[1:] {
+		if sensor.Temperature > hottest.Temperature {
+			hottest = sensor
+		}
+	}
+
+	return hottest, true
+}
+
+// Sensor returns the first sensor matching the glob pattern. The second
+// return value is false if no sensor matches.
+func (i Info) Sensor(pattern string) (Sensor, bool) {
+	for _, sensor := range i.Sensors {
+		if sensor.Matches(pattern) {
+			return sensor, true
+		}
+	}
+
+	return Sensor{}, false
+}
+
+// Status returns the most severe status of all sensors.
+func (i Info) Status() Status {
+	status := StatusNormal
+	for _, sensor := range i.Sensors {
+		if s := sensor.Status(); s > status {
+			status = s
+		}
+	}
+
+	return status
+}
+
+// Module is a module for displaying temperature sensor readings in the bar.
+type Module struct {
+	provider   Provider
+	patterns   value.Value // of []string
+	thresholds value.Value // of thresholds
+	outputFunc value.Value // of func(Info) bar.Output
+	notifyCh   <-chan struct{}
+	notifyFn   func()
+	scheduler  *timing.Scheduler
+}
+
+type thresholds struct {
+	high     unit.Temperature
+	critical unit.Temperature
+}
+
+// New creates a new *Module with the given temperature sensor provider. By
+// default, all sensors are selected and the temperature of the hottest one is
+// displayed. The output is colored using the "degraded" color of the
+// colorscheme if a sensor runs hot and is marked urgent if a sensor reaches a
+// critical temperature. By default, the module will refresh every 5 seconds.
+// The refresh interval can be configured using `Every`.
+func New(provider Provider) *Module {
+	m := &Module{
+		provider:  provider,
+		scheduler: timing.NewScheduler(),
+	}
+
+	m.notifyFn, m.notifyCh = notifier.New()
+	m.patterns.Set([]string(nil))
+	m.thresholds.Set(thresholds{})
+	m.outputFunc.Set(func(info Info) bar.Output {
+		sensor, ok := info.Hottest()
+		if !ok {
+			return nil
+		}
+
+		out := outputs.Text(sensor.String())
+
+		switch info.Status() {
+		case StatusCritical:
+			out.Urgent(true)
+		case StatusHigh:
+			out.Color(colors.Scheme("degraded"))
+		}
+
+		return out
+	})
+
+	m.Every(5 * time.Second)
+
+	return m
+}
+
+// Stream implements bar.Module.
+func (m *Module) Stream(s bar.Sink) {
+	info, err := m.getInfo()
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	for {
+		if !s.Error(err) {
+			s.Output(outputFunc(info))
+		}
+
+		select {
+		case <-m.outputFunc.Next():
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-m.patterns.Next():
+			info, err = m.getInfo()
+		case <-m.thresholds.Next():
+			info, err = m.getInfo()
+		case <-m.notifyCh:
+			info, err = m.getInfo()
+		case <-m.scheduler.C:
+			info, err = m.getInfo()
+		}
+	}
+}
+
+func (m *Module) getInfo() (Info, error) {
+	sensors, err := m.provider.Sensors()
+	if err != nil {
+		return Info{}, err
+	}
+
+	patterns := m.patterns.Get().([]string)
+	thresholds := m.thresholds.Get().(thresholds)
+
+	info := Info{
+		Sensors: make([]Sensor, 0, len(sensors)),
+	}
+
+	for _, sensor := range sensors {
+		if !matchesAny(sensor, patterns) {
+			continue
+		}
+
+		if sensor.High == 0 {
+			sensor.High = thresholds.high
+		}
+
+		if sensor.Critical == 0 {
+			sensor.Critical = thresholds.critical
+		}
+
+		info.Sensors = append(info.Sensors, sensor)
+	}
+
+	return info, nil
+}
+
+func matchesAny(sensor Sensor, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if sensor.Matches(pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Select restricts the sensors passed to the output func to the ones whose
+// name ("chip/label") or label matches any of the glob patterns, e.g.
+// "coretemp/Package*", "nvme/*" or "Tctl". Passing no patterns selects all
+// sensors.
+func (m *Module) Select(patterns ...string) *Module {
+	m.patterns.Set(patterns)
+	return m
+}
+
+// Thresholds configures the high and critical temperatures for sensors that
+// do not report thresholds themselves. Passing zero disables the respective
+// threshold.
+func (m *Module) Thresholds(high, critical unit.Temperature) *Module {
+	m.thresholds.Set(thresholds{high: high, critical: critical})
+	return m
+}
+
+// Output updates the output format func.
+func (m *Module) Output(format func(Info) bar.Output) *Module {
+	m.outputFunc.Set(format)
+	return m
+}
+
+// Every configures the refresh interval for the module. Passing a zero
+// interval will disable refreshing.
+func (m *Module) Every(interval time.Duration) *Module {
+	if interval == 0 {
+		m.scheduler.Stop()
+	} else {
+		m.scheduler.Every(interval)
+	}
+	return m
+}
+
+// Refresh forces a refresh of the module output.
+func (m *Module) Refresh() {
+	m.notifyFn()
+}
@@ -0,0 +1,135 @@
+package thermal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/assert"
+)
+
+type testProvider struct {
+	sync.Mutex
+	err     error
+	sensors []Sensor
+}
+
+func (p *testProvider) Sensors() ([]Sensor, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return p.sensors, nil
+}
+
+func (p *testProvider) setSensors(sensors ...Sensor) {
+	p.Lock()
+	defer p.Unlock()
+	p.sensors = sensors
+}
+
+func (p *testProvider) setError(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.err = err
+}
+
+func assertUrgent(t *testing.T, out testBar.Output, expected bool) {
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	assert.Equal(t, expected, urgent)
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+
+	testProvider := &testProvider{}
+	testProvider.setSensors(
+		Sensor{Chip: "coretemp", Label: "Package id 0", Temperature: unit.FromCelsius(52), Critical: unit.FromCelsius(100)},
+		Sensor{Chip: "nvme", Label: "Composite", Temperature: unit.FromCelsius(38)},
+	)
+
+	m := New(testProvider)
+	testBar.Run(m)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"52°C"})
+	assertUrgent(t, out, false)
+
+	testProvider.setSensors(
+		Sensor{Chip: "coretemp", Label: "Package id 0", Temperature: unit.FromCelsius(101), Critical: unit.FromCelsius(100)},
+		Sensor{Chip: "nvme", Label: "Composite", Temperature: unit.FromCelsius(38)},
+	)
+	m.Refresh()
+	out = testBar.NextOutput("critical temperature")
+	out.AssertText([]string{"101°C"})
+	assertUrgent(t, out, true)
+
+	m.Select("nvme/*")
+	out = testBar.NextOutput("sensors selected")
+	out.AssertText([]string{"38°C"})
+	assertUrgent(t, out, false)
+
+	m.Thresholds(unit.FromCelsius(30), unit.FromCelsius(35))
+	out = testBar.NextOutput("fallback thresholds")
+	out.AssertText([]string{"38°C"})
+	assertUrgent(t, out, true)
+
+	testProvider.setError(errors.New("whoops"))
+	testBar.Tick()
+	out = testBar.NextOutput("error")
+	out.AssertError()
+
+	testProvider.setError(nil)
+
+	m.Select("Package*", "nonexistent")
+	out = testBar.NextOutput("select by label")
+	out.AssertText([]string{"101°C"})
+
+	m.Select("nonexistent")
+	out = testBar.NextOutput("no sensors selected")
+	out.AssertEmpty()
+
+	m.Select()
+	out = testBar.NextOutput("all sensors selected")
+	out.AssertText([]string{"101°C"})
+
+	m.Output(func(info Info) bar.Output {
+		return outputs.Textf("%d sensors", len(info.Sensors))
+	})
+
+	out = testBar.NextOutput("output func changed")
+	out.AssertText([]string{"2 sensors"})
+}
+
+func TestSensor(t *testing.T) {
+	s := Sensor{
+		Chip:        "coretemp",
+		Label:       "Core 0",
+		Temperature: unit.FromCelsius(70),
+		High:        unit.FromCelsius(80),
+		Critical:    unit.FromCelsius(90),
+	}
+
+	assert.Equal(t, "coretemp/Core 0", s.Name())
+	assert.Equal(t, "70°C", s.String())
+	assert.Equal(t, StatusNormal, s.Status())
+	assert.True(t, s.Matches("coretemp/*"))
+	assert.True(t, s.Matches("Core ?"))
+	assert.False(t, s.Matches("nvme/*"))
+
+	s.Temperature = unit.FromCelsius(85)
+	assert.Equal(t, StatusHigh, s.Status())
+
+	s.Temperature = unit.FromCelsius(90)
+	assert.Equal(t, StatusCritical, s.Status())
+
+	s = Sensor{Chip: "acpitz", Temperature: unit.FromCelsius(120)}
+	assert.Equal(t, "acpitz", s.Name())
+	assert.Equal(t, StatusNormal, s.Status())
+}